@@ -294,6 +294,13 @@ func TestSimpleConfig(t *testing.T) {
 	}
 }
 
+func TestExpandEnvEscapedReferences(t *testing.T) {
+	// The references resolved by the components, see
+	// confighttp.HTTPClientSettings.Headers, are escaped from the expansion.
+	assert.Equal(t, "${env:CONFIG_TEST_TOKEN}", expandEnv("$${env:CONFIG_TEST_TOKEN}"))
+	assert.Equal(t, "Bearer ${file:/var/run/secrets/token}", expandEnv("Bearer $${file:/var/run/secrets/token}"))
+}
+
 func TestEscapedEnvVars(t *testing.T) {
 	const receiverExtraMapValue = "some receiver map value"
 	assert.NoError(t, os.Setenv("RECEIVERS_EXAMPLERECEIVER_EXTRA_MAP_RECV_VALUE_2", receiverExtraMapValue))
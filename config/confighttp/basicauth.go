@@ -0,0 +1,45 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"net/http"
+)
+
+// BasicAuthSettings configures the HTTP Basic authentication of the requests.
+type BasicAuthSettings struct {
+	// Username is the user name of the requests.
+	Username string `mapstructure:"username"`
+	// Password is the password of the requests.
+	Password string `mapstructure:"password"`
+}
+
+// basicAuthRoundTripper sets the HTTP Basic authentication credentials of the
+// requests without an Authorization header.
+type basicAuthRoundTripper struct {
+	transport http.RoundTripper
+	username  string
+	password  string
+}
+
+func (rt *basicAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return rt.transport.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request, see http.RoundTripper.
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(rt.username, rt.password)
+	return rt.transport.RoundTrip(req)
+}
@@ -0,0 +1,70 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name: "basic_auth",
+			// base64 of "user:p@ss:word"
+			want: "Basic dXNlcjpwQHNzOndvcmQ=",
+		},
+		{
+			name:    "headers_precedence",
+			headers: map[string]string{"authorization": "Bearer token"},
+			want:    "Bearer token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				got = req.Header.Get("Authorization")
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})
+			hcs := &HTTPClientSettings{
+				Headers: tt.headers,
+				BasicAuth: &BasicAuthSettings{
+					Username: "user",
+					Password: "p@ss:word",
+				},
+			}
+			client, err := hcs.ToClientWithBase(base)
+			require.NoError(t, err)
+			req, err := http.NewRequest("GET", "http://localhost:1234", nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.want, got)
+			// The request of the caller is not modified.
+			if tt.headers == nil {
+				assert.Empty(t, req.Header.Get("Authorization"))
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+	defaultHalfOpenProbes   = 1
+)
+
+// ErrCircuitOpen is returned by the clients with a circuit breaker when the
+// circuit of the requested endpoint is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerSettings configures a circuit breaker that fails the requests
+// fast, without sending them, while an endpoint keeps failing. The requests
+// failing with a transport error or with a 429, 502, 503 or 504 response status
+// count as failures, the requests canceled by the caller do not count.
+type CircuitBreakerSettings struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// circuit of an endpoint. (optional, default 5)
+	FailureThreshold int `mapstructure:"failure_threshold,omitempty"`
+
+	// OpenDuration is how long the circuit stays open before probe requests are
+	// allowed through. (optional, default 30s)
+	OpenDuration time.Duration `mapstructure:"open_duration,omitempty"`
+
+	// HalfOpenProbes is the number of probe requests that must succeed to close
+	// the circuit again; more concurrent requests fail while they are in flight.
+	// (optional, default 1)
+	HalfOpenProbes int `mapstructure:"half_open_probes,omitempty"`
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuit is the state of the breaker of one endpoint. The generation changes
+// with every state transition.
+type circuit struct {
+	state      circuitState
+	generation uint64
+	failures   int
+	openedAt   time.Time
+	probes     int
+	successes  int
+}
+
+// circuitToken is the state of the circuit that let a request through, the
+// outcomes of the requests let through by a past state are ignored.
+type circuitToken struct {
+	state      circuitState
+	generation uint64
+}
+
+// circuitBreakerRoundTripper tracks the failures per endpoint, the host of the
+// request URL, and returns ErrCircuitOpen for the requests to an endpoint with
+// an open circuit.
+type circuitBreakerRoundTripper struct {
+	transport        http.RoundTripper
+	failureThreshold int
+	openDuration     time.Duration
+	halfOpenProbes   int
+	now              func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func newCircuitBreakerRoundTripper(transport http.RoundTripper, cbs *CircuitBreakerSettings) *circuitBreakerRoundTripper {
+	rt := &circuitBreakerRoundTripper{
+		transport:        transport,
+		failureThreshold: cbs.FailureThreshold,
+		openDuration:     cbs.OpenDuration,
+		halfOpenProbes:   cbs.HalfOpenProbes,
+		now:              time.Now,
+		circuits:         map[string]*circuit{},
+	}
+	if rt.failureThreshold <= 0 {
+		rt.failureThreshold = defaultFailureThreshold
+	}
+	if rt.openDuration <= 0 {
+		rt.openDuration = defaultOpenDuration
+	}
+	if rt.halfOpenProbes <= 0 {
+		rt.halfOpenProbes = defaultHalfOpenProbes
+	}
+	return rt
+}
+
+func (rt *circuitBreakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.URL.Host
+	token, ok := rt.allow(endpoint)
+	if !ok {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+	resp, err := rt.transport.RoundTrip(req)
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(req.Context().Err(), context.Canceled)) {
+		rt.release(endpoint, token)
+	} else {
+		rt.done(endpoint, token, !isFailure(resp, err))
+	}
+	return resp, err
+}
+
+// allow returns whether a request can be sent to the endpoint, and the token
+// to record its outcome with.
+func (rt *circuitBreakerRoundTripper) allow(endpoint string) (circuitToken, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, ok := rt.circuits[endpoint]
+	if !ok {
+		c = &circuit{}
+		rt.circuits[endpoint] = c
+	}
+	switch c.state {
+	case circuitOpen:
+		if rt.now().Sub(c.openedAt) < rt.openDuration {
+			return circuitToken{}, false
+		}
+		c.state = circuitHalfOpen
+		c.generation++
+		c.probes = 0
+		c.successes = 0
+		fallthrough
+	case circuitHalfOpen:
+		if c.probes+c.successes >= rt.halfOpenProbes {
+			return circuitToken{}, false
+		}
+		c.probes++
+	}
+	return circuitToken{state: c.state, generation: c.generation}, true
+}
+
+// current returns the circuit of the endpoint if it is still in the state of
+// the token, nil otherwise.
+func (rt *circuitBreakerRoundTripper) current(endpoint string, token circuitToken) *circuit {
+	c := rt.circuits[endpoint]
+	if c.generation != token.generation || c.state != token.state {
+		return nil
+	}
+	return c
+}
+
+// release frees the probe slot of a request that ended without an outcome to
+// record, e.g. canceled by the caller.
+func (rt *circuitBreakerRoundTripper) release(endpoint string, token circuitToken) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if c := rt.current(endpoint, token); c != nil && c.state == circuitHalfOpen {
+		c.probes--
+	}
+}
+
+// done records the outcome of a request sent to the endpoint.
+func (rt *circuitBreakerRoundTripper) done(endpoint string, token circuitToken, success bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c := rt.current(endpoint, token)
+	if c == nil {
+		return
+	}
+	switch c.state {
+	case circuitClosed:
+		if success {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= rt.failureThreshold {
+			rt.open(c)
+		}
+	case circuitHalfOpen:
+		c.probes--
+		if !success {
+			rt.open(c)
+			return
+		}
+		c.successes++
+		if c.successes >= rt.halfOpenProbes {
+			c.state = circuitClosed
+			c.generation++
+			c.failures = 0
+		}
+	}
+}
+
+func (rt *circuitBreakerRoundTripper) open(c *circuit) {
+	c.state = circuitOpen
+	c.generation++
+	c.openedAt = rt.now()
+	c.failures = 0
+}
+
+// isFailure returns true if the request failed with a transport error or with
+// a status indicating that the server is unavailable or overloaded.
+func isFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
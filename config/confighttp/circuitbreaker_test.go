@@ -0,0 +1,177 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerRoundTripper(t *testing.T) {
+	status := map[string]int{"a": http.StatusServiceUnavailable, "b": http.StatusOK}
+	sent := map[string]int{}
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent[req.URL.Host]++
+		return &http.Response{StatusCode: status[req.URL.Host], Body: http.NoBody}, nil
+	})
+	now := time.Now()
+	rt := newCircuitBreakerRoundTripper(base, &CircuitBreakerSettings{
+		FailureThreshold: 3,
+		OpenDuration:     time.Minute,
+		HalfOpenProbes:   2,
+	})
+	rt.now = func() time.Time { return now }
+
+	send := func(host string) error {
+		req, err := http.NewRequest("GET", "http://"+host+"/", nil)
+		require.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		return err
+	}
+
+	// The circuit of "a" opens after 3 consecutive failures.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, send("a"))
+	}
+	assert.Equal(t, ErrCircuitOpen, send("a"))
+	assert.Equal(t, 3, sent["a"])
+
+	// Other endpoints are not affected.
+	require.NoError(t, send("b"))
+	assert.Equal(t, 1, sent["b"])
+
+	// A failed probe opens the circuit again.
+	now = now.Add(time.Minute)
+	require.NoError(t, send("a"))
+	assert.Equal(t, 4, sent["a"])
+	assert.Equal(t, ErrCircuitOpen, send("a"))
+
+	// The circuit closes once the probes succeed.
+	now = now.Add(time.Minute)
+	status["a"] = http.StatusOK
+	require.NoError(t, send("a"))
+	require.NoError(t, send("a"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, send("a"))
+	}
+	assert.Equal(t, 9, sent["a"])
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fail := true
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		started <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	now := time.Now()
+	rt := newCircuitBreakerRoundTripper(base, &CircuitBreakerSettings{FailureThreshold: 1})
+	rt.now = func() time.Time { return now }
+	req, err := http.NewRequest("GET", "http://a/", nil)
+	require.NoError(t, err)
+
+	_, err = rt.RoundTrip(req)
+	assert.EqualError(t, err, "connection refused")
+
+	now = now.Add(defaultOpenDuration)
+	fail = false
+	done := make(chan error)
+	go func() {
+		_, errProbe := rt.RoundTrip(req)
+		done <- errProbe
+	}()
+	<-started
+	// Only one probe is in flight at a time by default.
+	_, err = rt.RoundTrip(req)
+	assert.Equal(t, ErrCircuitOpen, err)
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestCircuitBreakerStaleOutcome(t *testing.T) {
+	now := time.Now()
+	rt := newCircuitBreakerRoundTripper(nil, &CircuitBreakerSettings{FailureThreshold: 1})
+	rt.now = func() time.Time { return now }
+
+	stale, ok := rt.allow("a")
+	require.True(t, ok)
+	failed, ok := rt.allow("a")
+	require.True(t, ok)
+	rt.done("a", failed, false)
+
+	now = now.Add(defaultOpenDuration)
+	probe, ok := rt.allow("a")
+	require.True(t, ok)
+	// The request let through by the closed circuit neither frees the probe
+	// slot nor closes the circuit.
+	rt.done("a", stale, true)
+	_, ok = rt.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, circuitHalfOpen, rt.circuits["a"].state)
+	assert.Equal(t, 1, rt.circuits["a"].probes)
+
+	rt.done("a", probe, true)
+	assert.Equal(t, circuitClosed, rt.circuits["a"].state)
+}
+
+func TestCircuitBreakerCanceled(t *testing.T) {
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+	rt := newCircuitBreakerRoundTripper(base, &CircuitBreakerSettings{FailureThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://a/", nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = rt.RoundTrip(req)
+		assert.True(t, errors.Is(err, context.Canceled))
+	}
+	assert.Equal(t, circuitClosed, rt.circuits["a"].state)
+	assert.Equal(t, 0, rt.circuits["a"].failures)
+}
+
+func TestCircuitBreakerWithRetry(t *testing.T) {
+	var bodies []string
+	server := newFlakyServer(t, 10, &bodies)
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint: server.URL,
+		Retry: &RetrySettings{
+			MaxAttempts:     10,
+			InitialInterval: time.Millisecond,
+		},
+		CircuitBreaker: &CircuitBreakerSettings{FailureThreshold: 2},
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	_, err = client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Len(t, bodies, 2)
+}
@@ -0,0 +1,106 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Compression types supported by HTTPClientSettings.Compression.
+const (
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+)
+
+// compressors create the writers compressing the request bodies per compression type.
+var compressors = map[string]func(w io.Writer) io.WriteCloser{
+	CompressionGzip: func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+	CompressionDeflate: func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	},
+}
+
+// compressRoundTripper compresses the request bodies and sets their
+// Content-Encoding header.
+type compressRoundTripper struct {
+	transport   http.RoundTripper
+	encoding    string
+	newWriter   func(w io.Writer) io.WriteCloser
+	minBodySize int64
+}
+
+func newCompressRoundTripper(transport http.RoundTripper, compression string, minBodySize int) (*compressRoundTripper, error) {
+	encoding := strings.ToLower(compression)
+	newWriter, ok := compressors[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression type %q", compression)
+	}
+	return &compressRoundTripper{
+		transport:   transport,
+		encoding:    encoding,
+		newWriter:   newWriter,
+		minBodySize: int64(minBodySize),
+	}, nil
+}
+
+func (rt *compressRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rt.shouldCompress(req) {
+		return rt.transport.RoundTrip(req)
+	}
+
+	// The compressed body is buffered so that it can be rewound, for redirects
+	// and for the retries.
+	var buf bytes.Buffer
+	w := rt.newWriter(&buf)
+	_, err := io.Copy(w, req.Body)
+	req.Body.Close()
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress the request body: %w", err)
+	}
+
+	// A RoundTripper must not modify the request, see http.RoundTripper.
+	cReq := req.Clone(req.Context())
+	body := buf.Bytes()
+	cReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	cReq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	cReq.ContentLength = int64(len(body))
+	cReq.Header.Set("Content-Encoding", rt.encoding)
+	return rt.transport.RoundTrip(cReq)
+}
+
+// shouldCompress returns false for the requests without body, with a body already
+// encoded, or with a body of known length smaller than the minimum size. Bodies
+// of unknown length are compressed.
+func (rt *compressRoundTripper) shouldCompress(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	// For client requests a zero ContentLength with a body means unknown.
+	return req.ContentLength <= 0 || req.ContentLength >= rt.minBodySize
+}
@@ -0,0 +1,172 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	payload := strings.Repeat("payload", 10)
+	tests := []struct {
+		name        string
+		compression string
+		minSize     int
+		body        func() io.Reader
+		wantEncoded string
+	}{
+		{
+			name:        "gzip",
+			compression: "gzip",
+			body:        func() io.Reader { return strings.NewReader(payload) },
+			wantEncoded: "gzip",
+		},
+		{
+			name:        "deflate",
+			compression: "Deflate",
+			body:        func() io.Reader { return strings.NewReader(payload) },
+			wantEncoded: "deflate",
+		},
+		{
+			name:        "above_min_size",
+			compression: "gzip",
+			minSize:     len(payload),
+			body:        func() io.Reader { return strings.NewReader(payload) },
+			wantEncoded: "gzip",
+		},
+		{
+			name:        "below_min_size",
+			compression: "gzip",
+			minSize:     len(payload) + 1,
+			body:        func() io.Reader { return strings.NewReader(payload) },
+		},
+		{
+			name:        "unknown_length",
+			compression: "gzip",
+			minSize:     len(payload) + 1,
+			// Hides the length of the body to http.NewRequest.
+			body:        func() io.Reader { return io.MultiReader(strings.NewReader(payload)) },
+			wantEncoded: "gzip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				gotEncoding string
+				gotBody     []byte
+			)
+			base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				gotEncoding = req.Header.Get("Content-Encoding")
+				var body io.Reader = req.Body
+				var err error
+				switch gotEncoding {
+				case "gzip":
+					body, err = gzip.NewReader(req.Body)
+				case "deflate":
+					body, err = zlib.NewReader(req.Body)
+				}
+				require.NoError(t, err)
+				gotBody, err = ioutil.ReadAll(body)
+				require.NoError(t, err)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})
+			hcs := &HTTPClientSettings{
+				Compression:        tt.compression,
+				CompressionMinSize: tt.minSize,
+			}
+			client, err := hcs.ToClientWithBase(base)
+			require.NoError(t, err)
+			req, err := http.NewRequest("POST", "http://localhost:1234", tt.body())
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.wantEncoded, gotEncoding)
+			assert.Equal(t, payload, string(gotBody))
+			// The request of the caller is not modified.
+			assert.Empty(t, req.Header.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestCompressionRetry(t *testing.T) {
+	var bodies [][]byte
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		b, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, b)
+		if len(bodies) == 1 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	hcs := &HTTPClientSettings{
+		Compression: "gzip",
+		Retry:       &RetrySettings{MaxAttempts: 2, InitialInterval: time.Millisecond},
+	}
+	client, err := hcs.ToClientWithBase(base)
+	require.NoError(t, err)
+	resp, err := client.Post("http://localhost:1234", "text/plain", bytes.NewReader([]byte("payload")))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Len(t, bodies, 2)
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.NotEqual(t, "payload", string(bodies[0]))
+}
+
+func TestCompressionUnsupported(t *testing.T) {
+	hcs := &HTTPClientSettings{Compression: "lz4"}
+	_, err := hcs.ToClient()
+	assert.EqualError(t, err, `unsupported compression type "lz4"`)
+}
+
+func TestDecompressResponses(t *testing.T) {
+	var gotAcceptEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAcceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "deflate")
+		zw := zlib.NewWriter(w)
+		zw.Write([]byte("response"))
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint:            srv.URL,
+		DecompressResponses: true,
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Contains(t, gotAcceptEncoding, "deflate")
+	assert.Equal(t, "response", string(body))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+}
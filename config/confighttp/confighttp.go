@@ -15,12 +15,25 @@
 package confighttp
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/rs/cors"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/internal/middleware"
@@ -28,11 +41,24 @@ import (
 
 type HTTPClientSettings struct {
 	// The target URL to send data to (e.g.: http://some.url:9411/v1/trace).
+	// Using the "dns+srv" (or "dns+srv+https") scheme, the host is resolved as a DNS
+	// SRV name and the requests are balanced across the resolved targets
+	// (e.g.: dns+srv://_otlp._tcp.some.domain/v1/trace).
+	// Using the "unix" scheme, the requests are sent over the Unix domain socket
+	// of the path (e.g.: unix:///run/otel/agent.sock), to a local agent, and the
+	// URLs of the requests are the path of the socket followed by the path of
+	// the request (e.g.: unix:///run/otel/agent.sock/v1/trace).
 	Endpoint string `mapstructure:"endpoint"`
 
 	// TLSSetting struct exposes TLS client configuration.
 	TLSSetting configtls.TLSClientSetting `mapstructure:",squash"`
 
+	// RequireTLS makes Validate and ToClient fail when the endpoint is not an
+	// https (or "dns+srv+https") URL, or when TLSSetting loads no TLS config,
+	// i.e. Insecure without CAFile, so that a misconfiguration never sends the
+	// data in cleartext. (optional, default false)
+	RequireTLS bool `mapstructure:"require_tls"`
+
 	// ReadBufferSize for HTTP client. See http.Transport.ReadBufferSize.
 	ReadBufferSize int `mapstructure:"read_buffer_size"`
 
@@ -43,18 +69,492 @@ type HTTPClientSettings struct {
 	Timeout time.Duration `mapstructure:"timeout,omitempty"`
 
 	// Additional headers attached to each HTTP request sent by the client.
-	// Existing header values are overwritten if collision happens.
+	// Existing header values are overwritten if collision happens. The values
+	// may reference environment variables, with "${env:NAME}", or the content of
+	// files, e.g. mounted secrets, with "${file:/path}", resolved on each request,
+	// the other values are sent as is. In the configuration files, the references
+	// are escaped from the expansion of the environment variables by the loader
+	// with "$", e.g. "$${env:NAME}".
 	Headers map[string]string `mapstructure:"headers,omitempty"`
+
+	// TracePropagation enables creating a client span for each outgoing request
+	// and injecting the W3C trace context (traceparent/tracestate headers) taken
+	// from the request context. (optional, default false)
+	TracePropagation bool `mapstructure:"trace_propagation"`
+
+	// SRVRefreshInterval is how often the SRV records are resolved again when
+	// the Endpoint uses the "dns+srv" scheme. (optional, default 30s)
+	SRVRefreshInterval time.Duration `mapstructure:"srv_refresh_interval,omitempty"`
+
+	// Retry configures retrying failed requests. Retries are disabled if nil.
+	Retry *RetrySettings `mapstructure:"retry"`
+
+	// CircuitBreaker configures failing the requests fast while an endpoint keeps
+	// failing. The requests failed by the circuit breaker are not retried.
+	// Disabled if nil.
+	CircuitBreaker *CircuitBreakerSettings `mapstructure:"circuit_breaker"`
+
+	// ForceHTTP1 disables HTTP/2, the client only negotiates HTTP/1.1 with the server.
+	// (optional, default false)
+	ForceHTTP1 bool `mapstructure:"force_http1"`
+
+	// HTTP3 sends the requests over HTTP/3 (QUIC) with the implementation
+	// registered with RegisterHTTP3RoundTripper, quic-go in the builds with the
+	// http3 tag, using the TLS settings: the
+	// endpoint must be an https URL. The other transport settings (buffer
+	// sizes, dialer...) are ignored. (optional, default false)
+	HTTP3 bool `mapstructure:"http3"`
+
+	// NextProtos are the protocols advertised with TLS ALPN, in order of
+	// preference, see tls.Config.NextProtos. http.Transport adds "h2" and
+	// "http/1.1" to the list when it attempts HTTP/2, "h2" is removed when
+	// ForceHTTP1 is set. Only used with TLS. (optional)
+	NextProtos []string `mapstructure:"next_protos"`
+
+	// MaxConcurrentRequestsPerHost is the maximum number of requests in flight
+	// to each host, until their response body is read or closed: the requests
+	// over the limit wait for a slot, until their context is done, to apply a
+	// backpressure instead of opening more connections. Each retry attempt takes
+	// a slot. Disabled if zero. (optional, default 0)
+	MaxConcurrentRequestsPerHost int `mapstructure:"max_concurrent_requests_per_host,omitempty"`
+
+	// DisableKeepAlives disables the reuse of connections, a new connection is
+	// opened for each request. See http.Transport.DisableKeepAlives.
+	// (optional, default false)
+	DisableKeepAlives bool `mapstructure:"disable_keep_alives"`
+
+	// DialerTimeout is the maximum amount of time a dial will wait for a connect
+	// to complete. See net.Dialer.Timeout. (optional, default 30s)
+	DialerTimeout time.Duration `mapstructure:"dialer_timeout,omitempty"`
+
+	// KeepAlive specifies the interval between keep-alive probes for an active
+	// network connection. See net.Dialer.KeepAlive. (optional, default 30s)
+	KeepAlive time.Duration `mapstructure:"keep_alive,omitempty"`
+
+	// DNSCacheTTL enables caching the addresses of the endpoint host for the
+	// given duration, instead of resolving them for each new connection, to
+	// trade the freshness of the records for fewer DNS queries. Disabled if
+	// zero. (optional, default 0)
+	DNSCacheTTL time.Duration `mapstructure:"dns_cache_ttl,omitempty"`
+
+	// LocalAddr is the local IP address the connections are bound to, with an
+	// optional port (e.g.: "10.0.0.1" or "[2001:db8::1]:0"), to send the
+	// requests from a given interface of a multi-homed host. (optional)
+	LocalAddr string `mapstructure:"local_addr,omitempty"`
+
+	// BasicAuth configures the HTTP Basic authentication of the requests. An
+	// Authorization header set in Headers takes precedence. Disabled if nil.
+	BasicAuth *BasicAuthSettings `mapstructure:"basic_auth"`
+
+	// SigV4 signs the requests with the AWS Signature Version 4, computed over
+	// the body as sent, i.e. compressed, which is buffered in memory to be
+	// hashed. Each retry attempt is signed again. It cannot be used with
+	// BasicAuth, and overwrites an Authorization header set in Headers.
+	// Disabled if nil.
+	SigV4 *SigV4Settings `mapstructure:"sigv4"`
+
+	// Compression compresses the request bodies with the given type, "gzip" or
+	// "deflate", and sets their Content-Encoding header. Disabled if empty.
+	Compression string `mapstructure:"compression"`
+
+	// CompressionMinSize is the minimum size in bytes of the request bodies that
+	// are compressed, smaller bodies are sent uncompressed. Bodies of unknown
+	// length are always compressed. (optional, default 0: compress all the bodies)
+	CompressionMinSize int `mapstructure:"compression_min_size,omitempty"`
+
+	// DecompressResponses advertises all the encodings supported by the server
+	// decompression, see HTTPServerSettings, in the Accept-Encoding header of the
+	// requests and decompresses the responses. By default only gzip is requested
+	// and decoded by http.Transport.
+	DecompressResponses bool `mapstructure:"decompress_responses"`
+
+	// MaxResponseBodySize is the maximum size in bytes of the response bodies
+	// read, decompressed if DecompressResponses is set: the reads beyond it fail
+	// with an error wrapping ErrResponseBodyTooLarge, to protect the exporters
+	// from the servers sending huge responses. Disabled if zero.
+	// (optional, default 0)
+	MaxResponseBodySize int64 `mapstructure:"max_response_body_size,omitempty"`
+
+	// ExpectContinueTimeout is the time to wait for the server's first response
+	// headers after sending the request headers, when the request has an
+	// "Expect: 100-continue" header. The body is only sent once the server
+	// accepted the request or after the timeout. See
+	// http.Transport.ExpectContinueTimeout. (optional, default 1s)
+	ExpectContinueTimeout time.Duration `mapstructure:"expect_continue_timeout,omitempty"`
+
+	// TLSHandshakeTimeout is the maximum duration of the TLS handshakes, so that
+	// the endpoints accepting the connections but stalling the handshake fail
+	// fast instead of holding the requests until Timeout. See
+	// http.Transport.TLSHandshakeTimeout. (optional, default 10s)
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout,omitempty"`
+
+	// Renegotiation allows the servers to renegotiate the TLS connections, for
+	// the legacy backends requiring it, e.g. to request a client certificate
+	// for some paths; options are never, once, to accept a single
+	// renegotiation per connection, and freely. Renegotiation is only defined
+	// up to TLS 1.2 and is forbidden by HTTP/2 and HTTP/3. It should stay
+	// disabled unless required: renegotiation has been the source of several
+	// TLS vulnerabilities, and allowing it freely lets a server make the client
+	// renegotiate repeatedly. The renegotiations are only accepted with the
+	// secure renegotiation extension of RFC 5746 and when the server
+	// certificate does not change. See tls.Config.Renegotiation.
+	// (optional, default never)
+	Renegotiation string `mapstructure:"renegotiation,omitempty"`
+
+	// ContentType overrides the Content-Type header of the requests, parameters
+	// included (e.g.: "application/json; charset=utf-8"). The media type must be
+	// one of the OTLP types: "application/x-protobuf" or "application/json".
+	// It takes precedence over a Content-Type set in Headers. (optional)
+	ContentType string `mapstructure:"content_type,omitempty"`
+
+	// Encoding is the encoding of the OTLP requests; options are proto and json,
+	// for the backends only accepting OTLP/JSON. It sets the Content-Type header
+	// of the requests when ContentType is not set, and the encoding of the bodies
+	// returned by MarshalOTLP. (optional, default proto)
+	Encoding string `mapstructure:"encoding,omitempty"`
+
+	// lookupSRV resolves the SRV names of the "dns+srv" endpoints,
+	// net.DefaultResolver.LookupSRV if nil.
+	lookupSRV lookupSRVFunc
+}
+
+// otlpContentTypes are the media types accepted by HTTPClientSettings.ContentType.
+var otlpContentTypes = []string{"application/x-protobuf", "application/json"}
+
+// Validate checks the settings, so that invalid settings are reported when the
+// configuration is loaded rather than on the first request.
+func (hcs *HTTPClientSettings) Validate() error {
+	if hcs.Endpoint == "" {
+		return errors.New("endpoint must be set")
+	}
+	u, err := url.Parse(hcs.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", hcs.Endpoint, err)
+	}
+	if u.Scheme == unixScheme {
+		if err = validateUnixEndpoint(hcs.Endpoint, u); err != nil {
+			return err
+		}
+		if hcs.LocalAddr != "" {
+			return errors.New("local_addr cannot be used with a unix endpoint")
+		}
+	} else if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: must be an URL with a scheme and a host", hcs.Endpoint)
+	}
+	if err = hcs.checkRequireTLSEndpoint(); err != nil {
+		return err
+	}
+	if hcs.HTTP3 {
+		if u.Scheme != "https" {
+			return fmt.Errorf("invalid endpoint %q: http3 requires an https endpoint", hcs.Endpoint)
+		}
+		if hcs.ForceHTTP1 {
+			return errors.New("http3 cannot be used with force_http1")
+		}
+	}
+	if hcs.Timeout < 0 {
+		return fmt.Errorf("timeout must be non-negative, got %v", hcs.Timeout)
+	}
+	if hcs.ReadBufferSize < 0 {
+		return fmt.Errorf("read_buffer_size must be non-negative, got %d", hcs.ReadBufferSize)
+	}
+	if hcs.WriteBufferSize < 0 {
+		return fmt.Errorf("write_buffer_size must be non-negative, got %d", hcs.WriteBufferSize)
+	}
+	if hcs.MaxConcurrentRequestsPerHost < 0 {
+		return fmt.Errorf("max_concurrent_requests_per_host must be non-negative, got %d", hcs.MaxConcurrentRequestsPerHost)
+	}
+	if hcs.MaxResponseBodySize < 0 {
+		return fmt.Errorf("max_response_body_size must be non-negative, got %d", hcs.MaxResponseBodySize)
+	}
+	if hcs.Compression != "" {
+		if _, ok := compressors[strings.ToLower(hcs.Compression)]; !ok {
+			return fmt.Errorf("unsupported compression type %q", hcs.Compression)
+		}
+	}
+	if hcs.SigV4 != nil {
+		if hcs.BasicAuth != nil {
+			return errors.New("sigv4 cannot be used with basic_auth")
+		}
+		if err := hcs.SigV4.validate(); err != nil {
+			return err
+		}
+	}
+	if err := hcs.validateEncoding(); err != nil {
+		return err
+	}
+	if _, err := hcs.renegotiation(); err != nil {
+		return err
+	}
+	for k, v := range hcs.Headers {
+		if err := validateHeaderValue(k, v); err != nil {
+			return err
+		}
+	}
+	if _, err := hcs.localAddr(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isTLSScheme returns whether the requests to the endpoints with the given
+// scheme are sent over TLS.
+func isTLSScheme(scheme string) bool {
+	return scheme == "https" || scheme == srvSecureScheme
+}
+
+// checkRequireTLSEndpoint returns an error when RequireTLS is set and Endpoint
+// is not requested over TLS.
+func (hcs *HTTPClientSettings) checkRequireTLSEndpoint() error {
+	if !hcs.RequireTLS {
+		return nil
+	}
+	if u, err := url.Parse(hcs.Endpoint); err != nil || !isTLSScheme(u.Scheme) {
+		return fmt.Errorf("invalid endpoint %q: require_tls requires an https endpoint", hcs.Endpoint)
+	}
+	return nil
+}
+
+// checkRequireTLS returns an error when RequireTLS is set and the requests would
+// not be sent over TLS, with tlsCfg the config loaded from TLSSetting.
+func (hcs *HTTPClientSettings) checkRequireTLS(tlsCfg *tls.Config) error {
+	if err := hcs.checkRequireTLSEndpoint(); err != nil {
+		return err
+	}
+	if hcs.RequireTLS && tlsCfg == nil {
+		return errors.New("require_tls cannot be used with insecure without ca_file")
+	}
+	return nil
 }
 
 func (hcs *HTTPClientSettings) ToClient() (*http.Client, error) {
+	return hcs.ToClientWithBase(http.DefaultTransport)
+}
+
+// ToClientWithBase is like ToClient but the requests are sent by base instead of
+// http.DefaultTransport. When base is an *http.Transport the settings of the
+// transport (TLS, buffer sizes, dialer...) are applied to a clone of base,
+// otherwise they are ignored and only the other layers (headers, retries...)
+// wrap base, e.g. for a fake transport in tests.
+func (hcs *HTTPClientSettings) ToClientWithBase(base http.RoundTripper) (*http.Client, error) {
+	clientTransport, err := hcs.toRoundTripper(base)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: clientTransport,
+		Timeout:   hcs.Timeout,
+	}, nil
+}
+
+// ToRoundTripper returns the transport used by the client returned by ToClient,
+// with all the settings applied except Timeout, so that it can be wrapped by
+// other http.RoundTripper.
+func (hcs *HTTPClientSettings) ToRoundTripper() (http.RoundTripper, error) {
+	return hcs.toRoundTripper(http.DefaultTransport)
+}
+
+// ToTransport returns a clone of http.DefaultTransport with the transport
+// settings applied (TLS, buffer sizes, dialer...), that can be shared by the
+// clients of several settings with ToClientWithSharedTransport. It fails when
+// HTTP3 is set since the HTTP/3 transport is not an *http.Transport.
+func (hcs *HTTPClientSettings) ToTransport() (*http.Transport, error) {
+	if hcs.HTTP3 {
+		return nil, errors.New("http3 cannot be used with a shared *http.Transport")
+	}
+	tlsCfg, err := hcs.TLSSetting.LoadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err = hcs.checkRequireTLS(tlsCfg); err != nil {
+		return nil, err
+	}
+	if tlsCfg, err = hcs.applyRenegotiation(tlsCfg); err != nil {
+		return nil, err
+	}
+	if _, err = hcs.localAddr(); err != nil {
+		return nil, err
+	}
+	return hcs.configureTransport(http.DefaultTransport.(*http.Transport).Clone(), tlsCfg), nil
+}
+
+// ToClientWithSharedTransport is like ToClient but the requests are sent by
+// transport as is, without clone, so that the clients of several settings share
+// its connection pool, e.g. many exporters to the same host. The transport
+// settings (TLS, buffer sizes, dialer...) are the ones of transport, e.g.
+// returned by ToTransport, only the other layers (headers, retries...) of the
+// settings wrap it. With RequireTLS, only the scheme of Endpoint is checked.
+func (hcs *HTTPClientSettings) ToClientWithSharedTransport(transport *http.Transport) (*http.Client, error) {
+	if err := hcs.checkRequireTLSEndpoint(); err != nil {
+		return nil, err
+	}
+	clientTransport, err := hcs.wrapRoundTripper(transport)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: clientTransport,
+		Timeout:   hcs.Timeout,
+	}, nil
+}
+
+func (hcs *HTTPClientSettings) toRoundTripper(base http.RoundTripper) (http.RoundTripper, error) {
 	tlsCfg, err := hcs.TLSSetting.LoadTLSConfig()
 	if err != nil {
 		return nil, err
 	}
-	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if err = hcs.checkRequireTLS(tlsCfg); err != nil {
+		return nil, err
+	}
+	if tlsCfg, err = hcs.applyRenegotiation(tlsCfg); err != nil {
+		return nil, err
+	}
+	if _, err = hcs.localAddr(); err != nil {
+		return nil, err
+	}
+	clientTransport := base
+	if hcs.HTTP3 {
+		if clientTransport, err = hcs.http3RoundTripper(tlsCfg); err != nil {
+			return nil, err
+		}
+	} else if baseTransport, ok := base.(*http.Transport); ok {
+		clientTransport = hcs.configureTransport(baseTransport.Clone(), tlsCfg)
+	}
+	return hcs.wrapRoundTripper(clientTransport)
+}
+
+// wrapRoundTripper wraps the transport with the layers of the settings.
+func (hcs *HTTPClientSettings) wrapRoundTripper(clientTransport http.RoundTripper) (http.RoundTripper, error) {
+	var err error
+
+	// Replaces the transparent gzip decompression of http.Transport.
+	if hcs.DecompressResponses {
+		clientTransport = middleware.ResponseDecompressor(clientTransport)
+	}
+
+	if hcs.MaxResponseBodySize > 0 {
+		clientTransport = &maxResponseBodyRoundTripper{transport: clientTransport, maxSize: hcs.MaxResponseBodySize}
+	}
+
+	// The limit is under the SRV discovery so that it applies per resolved
+	// target, and under the retries so that each attempt takes a slot.
+	if hcs.MaxConcurrentRequestsPerHost > 0 {
+		clientTransport = newHostLimitRoundTripper(clientTransport, hcs.MaxConcurrentRequestsPerHost)
+	}
+
+	// The circuit breaker is under the SRV discovery so that the failures are
+	// tracked per resolved target, and under the retries so that each attempt
+	// is accounted for.
+	if hcs.CircuitBreaker != nil {
+		clientTransport = newCircuitBreakerRoundTripper(clientTransport, hcs.CircuitBreaker)
+	}
+
+	// The requests are signed for the target resolved by the SRV discovery,
+	// whose host is sent, and again for each retry attempt.
+	if hcs.SigV4 != nil {
+		if err = hcs.SigV4.validate(); err != nil {
+			return nil, err
+		}
+		clientTransport = newSigV4RoundTripper(clientTransport, hcs.SigV4)
+	}
+
+	if isSRVEndpoint(hcs.Endpoint) {
+		lookup := hcs.lookupSRV
+		if lookup == nil {
+			lookup = net.DefaultResolver.LookupSRV
+		}
+		clientTransport = newSRVRoundTripper(clientTransport, lookup, hcs.SRVRefreshInterval)
+	}
+
+	if hcs.TracePropagation {
+		clientTransport = &ochttp.Transport{
+			Base:        clientTransport,
+			Propagation: &tracecontext.HTTPFormat{},
+		}
+	}
+
+	if hcs.Retry != nil {
+		clientTransport, err = newRetryRoundTripper(clientTransport, hcs.Retry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The body is compressed once for all the retries.
+	if hcs.Compression != "" {
+		clientTransport, err = newCompressRoundTripper(clientTransport, hcs.Compression, hcs.CompressionMinSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The Authorization header of Headers is set by clientInterceptorRoundTripper
+	// before the requests reach basicAuthRoundTripper, so it takes precedence.
+	if hcs.BasicAuth != nil {
+		clientTransport = &basicAuthRoundTripper{
+			transport: clientTransport,
+			username:  hcs.BasicAuth.Username,
+			password:  hcs.BasicAuth.Password,
+		}
+	}
+
+	if err = hcs.validateEncoding(); err != nil {
+		return nil, err
+	}
+	headers := hcs.Headers
+	if contentType := hcs.contentType(); contentType != "" {
+		if err = validateContentType(contentType); err != nil {
+			return nil, err
+		}
+		headers = make(map[string]string, len(hcs.Headers)+1)
+		for k, v := range hcs.Headers {
+			if http.CanonicalHeaderKey(k) != "Content-Type" {
+				headers[k] = v
+			}
+		}
+		headers["Content-Type"] = contentType
+	}
+
+	// The requests for the URLs of a "unix" endpoint are rewritten first, so
+	// that the other layers handle HTTP requests.
+	if socketPath := unixSocketPath(hcs.Endpoint); socketPath != "" {
+		clientTransport = &unixSocketRoundTripper{transport: clientTransport, socketPath: socketPath}
+	}
+
+	if len(headers) > 0 {
+		interceptor := &clientInterceptorRoundTripper{
+			transport: clientTransport,
+			headers:   make(map[string]string, len(headers)),
+		}
+		for k, v := range headers {
+			if !isDynamicHeaderValue(v) {
+				interceptor.headers[k] = v
+				continue
+			}
+			if err = validateHeaderValue(k, v); err != nil {
+				return nil, err
+			}
+			if interceptor.dynamicHeaders == nil {
+				interceptor.dynamicHeaders = map[string]string{}
+			}
+			interceptor.dynamicHeaders[k] = v
+		}
+		clientTransport = interceptor
+	}
+
+	return clientTransport, nil
+}
+
+// configureTransport applies the transport settings to transport.
+func (hcs *HTTPClientSettings) configureTransport(transport *http.Transport, tlsCfg *tls.Config) *http.Transport {
 	if tlsCfg != nil {
+		if len(hcs.NextProtos) > 0 {
+			tlsCfg.NextProtos = nextProtos(hcs.NextProtos, hcs.ForceHTTP1)
+		}
 		transport.TLSClientConfig = tlsCfg
+		// http.Transport only attempts HTTP/2 with a custom TLS config when
+		// ForceAttemptHTTP2 is set, which is not the case of every base transport.
+		transport.ForceAttemptHTTP2 = true
 	}
 	if hcs.ReadBufferSize > 0 {
 		transport.ReadBufferSize = hcs.ReadBufferSize
@@ -62,34 +562,115 @@ func (hcs *HTTPClientSettings) ToClient() (*http.Client, error) {
 	if hcs.WriteBufferSize > 0 {
 		transport.WriteBufferSize = hcs.WriteBufferSize
 	}
-	var clientTransport http.RoundTripper
+	if hcs.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = hcs.ExpectContinueTimeout
+	}
+	if hcs.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = hcs.TLSHandshakeTimeout
+	}
+	if hcs.DisableKeepAlives {
+		transport.DisableKeepAlives = true
+	}
+	if hcs.DialerTimeout > 0 || hcs.KeepAlive > 0 || hcs.DNSCacheTTL > 0 || hcs.LocalAddr != "" {
+		transport.DialContext = hcs.dialer().DialContext
+	}
+	if socketPath := unixSocketPath(hcs.Endpoint); socketPath != "" {
+		transport.DialContext = unixDialContext(hcs.dialer().DialContext, socketPath)
+	} else if hcs.DNSCacheTTL > 0 {
+		transport.DialContext = newDNSCache(net.DefaultResolver.LookupHost, hcs.DNSCacheTTL).dialContext(transport.DialContext)
+	}
+	if hcs.ForceHTTP1 {
+		// A non-nil empty TLSNextProto disables the HTTP/2 support, see net/http.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
 
-	if hcs.Headers != nil && len(hcs.Headers) > 0 {
-		clientTransport = &clientInterceptorRoundTripper{
-			transport: transport,
-			headers:   hcs.Headers,
-		}
-	} else {
-		clientTransport = transport
+// dialer returns the net.Dialer used by the client transport. The defaults are
+// the same as the ones of http.DefaultTransport.
+func (hcs *HTTPClientSettings) dialer() *net.Dialer {
+	d := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if hcs.DialerTimeout > 0 {
+		d.Timeout = hcs.DialerTimeout
 	}
+	if hcs.KeepAlive > 0 {
+		d.KeepAlive = hcs.KeepAlive
+	}
+	// The address is validated by toRoundTripper.
+	if addr, _ := hcs.localAddr(); addr != nil {
+		d.LocalAddr = addr
+	}
+	return d
+}
 
-	return &http.Client{
-		Transport: clientTransport,
-		Timeout:   hcs.Timeout,
-	}, nil
+// localAddr returns the address of LocalAddr, or nil if not set.
+func (hcs *HTTPClientSettings) localAddr() (*net.TCPAddr, error) {
+	if hcs.LocalAddr == "" {
+		return nil, nil
+	}
+	host, port := hcs.LocalAddr, "0"
+	if h, p, err := net.SplitHostPort(hcs.LocalAddr); err == nil {
+		host, port = h, p
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid local_addr %q: must be an IP address with an optional port", hcs.LocalAddr)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local_addr %q: invalid port %q", hcs.LocalAddr, port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(portNum)}, nil
+}
+
+func validateContentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content_type %q: %w", contentType, err)
+	}
+	for _, t := range otlpContentTypes {
+		if mediaType == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported content_type %q, must be one of %v", contentType, otlpContentTypes)
 }
 
 // Custom RoundTripper that add headers
 type clientInterceptorRoundTripper struct {
 	transport http.RoundTripper
 	headers   map[string]string
+	// dynamicHeaders are the headers with references, resolved on each request.
+	dynamicHeaders map[string]string
 }
 
-// Custom RoundTrip that add headers
+// Custom RoundTrip that add headers. The headers are set on a shallow copy of
+// the request with its own header map, the request of the caller may be reused
+// or retried and must not be modified, see http.RoundTripper.
 func (interceptor *clientInterceptorRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := *req
+	clone.Header = make(http.Header, len(req.Header)+len(interceptor.headers))
+	for k, v := range req.Header {
+		clone.Header[k] = v
+	}
 	for k, v := range interceptor.headers {
-		req.Header.Set(k, v)
+		clone.Header.Set(k, v)
+	}
+	for k, v := range interceptor.dynamicHeaders {
+		resolved, err := resolveHeaderValue(k, v)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+		clone.Header.Set(k, resolved)
 	}
+	req = &clone
 	// Send the request to Cortex
 	response, err := interceptor.transport.RoundTrip(req)
 
@@ -103,60 +684,861 @@ type HTTPServerSettings struct {
 	// TLSSetting struct exposes TLS client configuration.
 	TLSSetting *configtls.TLSServerSetting `mapstructure:"tls_settings, omitempty"`
 
+	// AdditionalEndpoints configures other addresses the server listens on,
+	// each with its own TLS configuration, see ToListeners. (optional)
+	AdditionalEndpoints []EndpointSetting `mapstructure:"additional_endpoints"`
+
+	// ReusePort sets SO_REUSEPORT on the listeners, so that several collector
+	// processes of the host can listen on the same port, the kernel balancing
+	// the connections between them. Only supported on Linux, the BSDs and
+	// macOS, Validate fails on the other platforms. (optional, default false)
+	ReusePort bool `mapstructure:"reuse_port"`
+
+	// EnableProxyProtocol parses the PROXY protocol header sent by a load
+	// balancer at the beginning of the connections, before the TLS handshake,
+	// so that the address of the client is reported as the remote address of
+	// the connections. The connections without a valid header are closed.
+	// (optional, default false)
+	EnableProxyProtocol bool `mapstructure:"enable_proxy_protocol"`
+
+	// ProxyProtocolVersion restricts the PROXY protocol header to the "v1" (text)
+	// or the "v2" (binary) version. Both are accepted if empty. (optional)
+	ProxyProtocolVersion string `mapstructure:"proxy_protocol_version"`
+
 	// CorsOrigins are the allowed CORS origins for HTTP/JSON requests to grpc-gateway adapter
 	// for the OTLP receiver. See github.com/rs/cors
 	// An empty list means that CORS is not enabled at all. A wildcard (*) can be
 	// used to match any origin or one or more characters of an origin.
 	CorsOrigins []string `mapstructure:"cors_allowed_origins"`
+
+	// CorsExposedHeaders are the response headers, in addition to the CORS-safelisted
+	// ones, that the browsers are allowed to expose to the scripts making
+	// cross-origin requests (Access-Control-Expose-Headers). Only used when
+	// CorsOrigins is not empty.
+	CorsExposedHeaders []string `mapstructure:"cors_exposed_headers"`
+
+	// CorsAllowCredentials allows the cross-origin requests to include credentials
+	// like cookies (Access-Control-Allow-Credentials). It cannot be combined with
+	// the "*" origin, that browsers reject for requests with credentials.
+	// (optional, default false)
+	CorsAllowCredentials bool `mapstructure:"cors_allow_credentials"`
+
+	// CorsAllowOriginFunc is called with the origin of the CORS requests and
+	// returns whether it is accepted, for the origins that cannot be matched by
+	// CorsOrigins. It takes precedence over CorsOrigins and enables the CORS
+	// handling when set. See cors.Options.AllowOriginFunc. It can only be set by
+	// the components, not in the configuration files. (optional)
+	CorsAllowOriginFunc func(origin string) bool `mapstructure:"-"`
+
+	// CorsOptionsPassthrough passes the preflight OPTIONS requests to the handler
+	// after setting the CORS headers, instead of answering them, e.g. to customize
+	// the preflight responses. See cors.Options.OptionsPassthrough.
+	// (optional, default false)
+	CorsOptionsPassthrough bool `mapstructure:"cors_options_passthrough"`
+
+	// HeaderRenames renames the request headers before they are handled, from the
+	// source header names (the keys) to the target header names (the values),
+	// e.g. to normalize legacy tenant headers. A target header already present in
+	// the request is kept. See middleware.HeaderRenamer. (optional)
+	HeaderRenames map[string]string `mapstructure:"header_renames"`
+
+	// ResponseHeaders are the headers set on all the responses of the server,
+	// including the error responses, e.g. to identify the collector instance.
+	// The headers set by the handler take precedence. See
+	// middleware.ResponseHeaders. (optional)
+	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+
+	// TrustedProxies are the IP addresses or CIDR ranges (e.g.: "10.0.0.0/8") of
+	// the reverse proxies in front of the server: the RemoteAddr of their
+	// requests is set to the client address of the Forwarded or X-Forwarded-For
+	// header, so that the real client is logged. The headers of the other peers
+	// are ignored. Disabled if empty. See middleware.RealIP. (optional)
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+	// AllowedContentTypes are the media types accepted in the Content-Type header
+	// of the requests, other requests are rejected with a 415 status. Defaults to
+	// the content types of the component, see WithDefaultContentTypes, or to any
+	// content type. See middleware.ContentTypeFilter. (optional)
+	AllowedContentTypes []string `mapstructure:"allowed_content_types"`
+
+	// MiddlewareExemptions maps the names of middlewares, e.g. "decompression"
+	// or "cors", see the Middleware* constants, to the URL path prefixes of the
+	// requests bypassing them, e.g. the health or metrics endpoints handled by
+	// the component. A prefix matches the path itself and the paths under it.
+	// A middleware replaced with WithMiddlewares keeps the exemptions of its
+	// name.
+	// See middleware.SkipPaths. (optional)
+	MiddlewareExemptions map[string][]string `mapstructure:"middleware_exemptions"`
+
+	// DrainTimeout is the maximum time to wait for in-flight requests to complete
+	// when the server is shut down via HTTPServerSettings.Shutdown. Connections
+	// still active after the timeout are forcibly closed. If zero, the requests
+	// are waited for until the context of Shutdown is done.
+	DrainTimeout time.Duration `mapstructure:"drain_timeout,omitempty"`
+
+	// ForceHTTP1 disables HTTP/2, the server only serves HTTP/1.1.
+	// (optional, default false)
+	ForceHTTP1 bool `mapstructure:"force_http1"`
+
+	// NextProtos are the protocols accepted with TLS ALPN, in order of
+	// preference, see tls.Config.NextProtos: "h2" must be listed for the clients
+	// to negotiate HTTP/2 over TLS. The connections negotiating a protocol other
+	// than "h2" and "http/1.1" are closed by http.Server. "h2" is removed, with a
+	// warning logged by ToServer, when ForceHTTP1 is set. Only used with TLS.
+	// (optional)
+	NextProtos []string `mapstructure:"next_protos"`
+
+	// AdaptiveConcurrencyLimit enables limiting the number of requests handled
+	// concurrently with a limit adjusted based on the observed latency. Requests
+	// over the limit are rejected with a 503 status. Disabled if nil.
+	AdaptiveConcurrencyLimit *AdaptiveConcurrencyLimitSettings `mapstructure:"adaptive_concurrency_limit"`
+
+	// MaxConcurrentRequests is the maximum number of requests handled
+	// concurrently, the requests over the limit are rejected with a 503 status,
+	// with the Retry-After header when RetryAfter is set. Disabled if zero.
+	// See middleware.InflightLimiter. (optional, default 0)
+	MaxConcurrentRequests int `mapstructure:"max_concurrent_requests,omitempty"`
+
+	// MaxResponseSize is the maximum size in bytes of the response bodies, the
+	// bodies written by the handler beyond it are truncated and an error is
+	// logged with the logger given by WithLogger. Disabled if zero.
+	// See middleware.ResponseSizeLimiter. (optional, default 0)
+	MaxResponseSize int64 `mapstructure:"max_response_size,omitempty"`
+
+	// MaxRequestHeaders is the maximum number of header values of the
+	// requests, the requests with more headers are rejected with a 431 status.
+	// Disabled if zero. See middleware.HeaderLimiter. (optional, default 0)
+	MaxRequestHeaders int `mapstructure:"max_request_headers,omitempty"`
+
+	// MaxRequestHeaderNameLength is the maximum length in bytes of the header
+	// names of the requests, the requests with a longer name are rejected with
+	// a 431 status. Disabled if zero. (optional, default 0)
+	MaxRequestHeaderNameLength int `mapstructure:"max_request_header_name_length,omitempty"`
+
+	// MaxRequestHeaderValueLength is the maximum length in bytes of each header
+	// value of the requests, the requests with a longer value are rejected with
+	// a 431 status. Disabled if zero. (optional, default 0)
+	MaxRequestHeaderValueLength int `mapstructure:"max_request_header_value_length,omitempty"`
+
+	// DecompressionReadAheadSize is the size in bytes of the buffer used to read
+	// compressed request bodies. Larger values batch the reads and improve the
+	// decompression throughput of large payloads. (optional, default 32KiB)
+	DecompressionReadAheadSize int `mapstructure:"decompression_read_ahead_size,omitempty"`
+
+	// MaxConcurrentDecompressions is the maximum number of request bodies
+	// decompressed concurrently, the compressed requests over the limit are
+	// rejected with a 429 status, so that the memory of the decompressions is
+	// bounded by about MaxConcurrentDecompressions times the
+	// DecompressionReadAheadSize and the window of a decoder, 32KiB for gzip
+	// and up to 64MiB for zstd. Disabled if zero. See middleware.WithMaxConcurrentDecompressions.
+	// (optional, default 0)
+	MaxConcurrentDecompressions int `mapstructure:"max_concurrent_decompressions,omitempty"`
+
+	// CompressResponses compresses the response bodies with the gzip or deflate
+	// encoding accepted by the clients, with pooled writers. The responses
+	// already encoded by the handler are sent as is. See
+	// middleware.ResponseCompressor. (optional, default false)
+	CompressResponses bool `mapstructure:"compress_responses"`
+
+	// SniffCompression decompresses the gzip and zstd request bodies sent without the
+	// Content-Encoding header, detected by their first bytes. Opt-in since an
+	// uncompressed body may start with the same bytes. (optional, default false)
+	SniffCompression bool `mapstructure:"sniff_compression"`
+
+	// AllowedEncodings are the Content-Encoding values accepted by the server,
+	// the requests with another encoding are rejected with a 501 status and the
+	// accepted encodings in the Accept-Encoding header of the response. The
+	// requests without encoding are always accepted. Defaults to all the
+	// supported encodings. See middleware.WithEncodings. (optional)
+	AllowedEncodings []string `mapstructure:"allowed_encodings"`
+
+	// DeniedEncodings are the Content-Encoding values rejected by the server as
+	// the encodings missing from AllowedEncodings, e.g. to refuse an encoding
+	// while it is rolled out or buggy in some clients. (optional)
+	DeniedEncodings []string `mapstructure:"denied_encodings"`
+
+	// MaxUncompressedLengthHint is the maximum length in bytes accepted in the
+	// X-Uncompressed-Content-Length header sent by some clients with the
+	// compressed requests: the ContentLength of the decompressed requests is set
+	// to the lengths up to it, so that the handlers can allocate their buffers
+	// upfront, while the larger lengths that could be spoofed are ignored.
+	// Disabled if zero. See middleware.WithUncompressedLengthHint.
+	// (optional, default 0)
+	MaxUncompressedLengthHint int64 `mapstructure:"max_uncompressed_length_hint,omitempty"`
+
+	// RequireCompressionAbove is the maximum size in bytes of the uncompressed
+	// request bodies, the requests without Content-Encoding and with a larger
+	// Content-Length are rejected with a 412 status, to get the clients to enable
+	// the compression. The requests of unknown length are accepted. Disabled if
+	// zero. See middleware.RequireCompression. (optional, default 0)
+	RequireCompressionAbove int `mapstructure:"require_compression_above,omitempty"`
+
+	// LenientGzip accepts the gzip request bodies followed by extra bytes, sent
+	// by some broken clients: up to 64KiB of bytes after the first gzip member
+	// are discarded and a warning is logged with the logger given by WithLogger.
+	// Opt-in since the bodies made of several gzip members are truncated to the
+	// first one. See middleware.WithLenientGzip. (optional, default false)
+	LenientGzip bool `mapstructure:"lenient_gzip"`
+
+	// SlidingWriteTimeout is the maximum duration of the writes of the responses
+	// without progress: the write deadline of the connection is extended by
+	// SlidingWriteTimeout on each write, so that the clients reading the
+	// responses too slowly, or not at all, are disconnected while the slow but
+	// progressing responses continue. Not applied to the HTTP/2 requests.
+	// Disabled if zero. See middleware.SlidingWriteDeadline. (optional, default 0)
+	SlidingWriteTimeout time.Duration `mapstructure:"sliding_write_timeout,omitempty"`
+
+	// HandlerTimeout is the maximum duration of the handling of a request, the
+	// requests taking longer are answered with a 504 status given to the error
+	// handler. Zero means no timeout. (optional, default 0)
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout,omitempty"`
+
+	// RetryAfter is the delay set in the "Retry-After" header of the 429 and 503
+	// responses, so that the clients back off before retrying a rejected request.
+	// Rounded up to whole seconds. Disabled if zero. (optional, default 0)
+	RetryAfter time.Duration `mapstructure:"retry_after,omitempty"`
+
+	// MaxConcurrentTLSHandshakes is the maximum number of TLS handshakes in
+	// progress on the accepted connections, the other connections wait for a
+	// handshake slot before being served, so that the CPU usage is smoothed when
+	// many clients reconnect at once. The handshakes taking more than 10s fail.
+	// Disabled if zero. Only used with TLS. (optional, default 0)
+	MaxConcurrentTLSHandshakes int `mapstructure:"max_concurrent_tls_handshakes,omitempty"`
+
+	// TLSHandshakeQueueTimeout is the maximum time a connection waits for a
+	// handshake slot when MaxConcurrentTLSHandshakes is set, the connections
+	// waiting longer are closed so that their clients back off and reconnect
+	// later. If zero, the connections wait until a slot is available.
+	// (optional, default 0)
+	TLSHandshakeQueueTimeout time.Duration `mapstructure:"tls_handshake_queue_timeout,omitempty"`
+
+	// SessionTicketKeyRotation is the interval at which the TLS session ticket
+	// keys are replaced by a new random key, the tickets issued with the previous
+	// key are still accepted during the next interval. If zero, the keys are
+	// managed by crypto/tls. Only used with TLS. (optional, default 0)
+	SessionTicketKeyRotation time.Duration `mapstructure:"session_ticket_key_rotation,omitempty"`
+
+	// ContextLogger enables putting in the context of each request a logger
+	// derived from the logger given by WithLogger, with the id, the tenant and
+	// the trace id of the request, for the handlers and the consumers, see
+	// LoggerFromContext. Disabled if nil.
+	ContextLogger *ContextLoggerSettings `mapstructure:"context_logger"`
+
+	// RequestLogging enables logging each request handled by the server with the
+	// logger given by WithLogger. Disabled if nil.
+	RequestLogging *RequestLoggingSettings `mapstructure:"request_logging"`
+
+	// DigestValidation enables checking the request bodies against their
+	// Content-MD5 or Digest header, the mismatching requests are rejected with a
+	// 400 status given to the error handler. Disabled if nil.
+	// See middleware.DigestValidator.
+	DigestValidation *DigestValidationSettings `mapstructure:"digest_validation"`
+
+	// Idempotency enables replaying the cached responses to the requests retried
+	// with the same idempotency key, instead of handling them again. Disabled if
+	// nil. See middleware.Idempotency.
+	Idempotency *IdempotencySettings `mapstructure:"idempotency"`
+
+	// Debug enables serving the pprof profiles and the expvar variables under a
+	// path prefix of the server, for the in-situ debugging without a second
+	// listener. The debug requests bypass all the middlewares and the handler of
+	// the server. Disabled if nil. See middleware.DebugHandler.
+	Debug *DebugSettings `mapstructure:"debug"`
+
+	// BodyCapture writes the decompressed bodies of the requests rejected with a
+	// 400 status, the payloads failing to be decoded or validated, to files of a
+	// directory, to reproduce the rejections. Since the payloads may hold
+	// personal data, it is disabled if nil. See middleware.BodyCapture.
+	BodyCapture *BodyCaptureSettings `mapstructure:"body_capture"`
+}
+
+// RequestLoggingSettings configures the request logs, see middleware.RequestLogger.
+type RequestLoggingSettings struct {
+	// Level is the level of the request logs; options are debug, info, warn, error.
+	// (optional, default debug)
+	Level string `mapstructure:"level,omitempty"`
+
+	// SamplingInitial is the number of requests logged during each second before
+	// sampling. Zero disables the sampling. (optional, default 0)
+	SamplingInitial int `mapstructure:"sampling_initial,omitempty"`
+
+	// SamplingThereafter is the sampling rate of the requests logged after the
+	// first SamplingInitial ones of each second: one every SamplingThereafter
+	// requests is logged.
+	SamplingThereafter int `mapstructure:"sampling_thereafter,omitempty"`
+
+	// Format is the format of the request logs; options are text, logged with
+	// the logger of the server, and json, written as JSON lines with stable field
+	// names to Output. See middleware.WithJSONFormat.
+	// (optional, default text)
+	Format string `mapstructure:"format,omitempty"`
+
+	// Output is where the JSON request logs are written: stdout, stderr or the
+	// path of a file, see zap.Open. Only used by the json format. The file is
+	// opened by ToServer and closed by Shutdown. (optional, default stdout)
+	Output string `mapstructure:"output,omitempty"`
+}
+
+const (
+	requestLogFormatText = "text"
+	requestLogFormatJSON = "json"
+)
+
+// ContextLoggerSettings configures the loggers of the requests, see
+// middleware.ContextLogger.
+type ContextLoggerSettings struct {
+	// RequestIDHeader is the header with the id of the requests, the id is
+	// generated for the requests without it. (default X-Request-Id)
+	RequestIDHeader string `mapstructure:"request_id_header,omitempty"`
+	// TenantHeader is the header with the tenant of the requests. (optional)
+	TenantHeader string `mapstructure:"tenant_header,omitempty"`
+}
+
+// LoggerFromContext returns the logger of the request put in ctx by the server
+// when ContextLogger is set, or false if there is none, e.g. to log with the id
+// of the request in the consumers of a receiver.
+func LoggerFromContext(ctx context.Context) (*zap.Logger, bool) {
+	return middleware.LoggerFromContext(ctx)
+}
+
+// AdaptiveConcurrencyLimitSettings configures the bounds of the adaptive
+// concurrency limit, see middleware.AdaptiveConcurrencyLimiter.
+type AdaptiveConcurrencyLimitSettings struct {
+	// InitialLimit is the concurrency limit used until latency is observed. (default 20)
+	InitialLimit int `mapstructure:"initial_limit,omitempty"`
+	// MinLimit is the lower bound of the concurrency limit. (default 1)
+	MinLimit int `mapstructure:"min_limit,omitempty"`
+	// MaxLimit is the upper bound of the concurrency limit. (default 1000)
+	MaxLimit int `mapstructure:"max_limit,omitempty"`
+}
+
+// DigestValidationSettings configures the check of the request digests, see
+// middleware.DigestValidator.
+type DigestValidationSettings struct {
+	// Decompressed checks the digests against the decompressed bodies instead of
+	// the bodies as received, for the clients computing the digest before the
+	// compression. (default false)
+	Decompressed bool `mapstructure:"decompressed"`
+}
+
+// IdempotencySettings configures the cache of the responses to the requests
+// with an idempotency key, see middleware.Idempotency.
+type IdempotencySettings struct {
+	// Header is the request header with the idempotency key, the requests
+	// without it are always handled. (default Idempotency-Key)
+	Header string `mapstructure:"header,omitempty"`
+	// TTL is the duration the successful responses are cached. (default 5m)
+	TTL time.Duration `mapstructure:"ttl,omitempty"`
+	// MaxEntries is the maximum number of responses cached, the least recently
+	// used ones are evicted first. (default 1000)
+	MaxEntries int `mapstructure:"max_entries,omitempty"`
+	// MaxResponseSize is the maximum size in bytes of the response bodies
+	// cached, the larger responses are not cached. (default 64KiB)
+	MaxResponseSize int `mapstructure:"max_response_size,omitempty"`
+}
+
+// DebugSettings configures the debug endpoints of the server. Since they must
+// not be publicly exposed, the requests are only answered when they come from
+// AllowedIPs or have Token, the others are rejected with a 404 status.
+type DebugSettings struct {
+	// PathPrefix is the prefix of the paths of the debug endpoints, the profiles
+	// are served under PathPrefix+"/pprof/" and the variables at
+	// PathPrefix+"/vars". (default /debug)
+	PathPrefix string `mapstructure:"path_prefix,omitempty"`
+	// AllowedIPs are the IP addresses or CIDR ranges of the peers allowed to
+	// request the debug endpoints. The forwarded headers are not trusted.
+	AllowedIPs []string `mapstructure:"allowed_ips"`
+	// Token is the bearer token authorizing the requests of any peer, sent in
+	// the "Authorization: Bearer <token>" header. Disabled if empty.
+	Token string `mapstructure:"token,omitempty"`
+}
+
+const defaultDebugPathPrefix = "/debug"
+
+const (
+	defaultIdempotencyHeader     = "Idempotency-Key"
+	defaultIdempotencyTTL        = 5 * time.Minute
+	defaultIdempotencyMaxEntries = 1000
+)
+
+// BodyCaptureSettings configures the captures of the rejected request bodies.
+// The disk usage is bounded by MaxFiles captures of at most MaxBodySize bytes
+// of body each.
+type BodyCaptureSettings struct {
+	// Directory is the directory the captures are written to, created if missing.
+	Directory string `mapstructure:"directory"`
+	// MaxBodySize is the maximum number of bytes of body written to each
+	// capture, the rest is dropped. (default 64KiB)
+	MaxBodySize int `mapstructure:"max_body_size,omitempty"`
+	// MaxFiles is the maximum number of captures kept in Directory, the oldest
+	// ones are removed first. (default 100)
+	MaxFiles int `mapstructure:"max_files,omitempty"`
+	// MaxPerMinute is the maximum number of captures written each minute, the
+	// other rejected requests are not captured. (default 10)
+	MaxPerMinute int `mapstructure:"max_per_minute,omitempty"`
+	// RedactedHeaders are the request headers whose values are replaced by
+	// "[REDACTED]" in the captures, in addition to the Authorization,
+	// Proxy-Authorization and Cookie headers. (optional)
+	RedactedHeaders []string `mapstructure:"redacted_headers"`
+}
+
+// EndpointSetting configures an additional listening address of the server.
+type EndpointSetting struct {
+	// Endpoint configures the listening address.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// TLSSetting struct exposes TLS client configuration for this endpoint.
+	TLSSetting *configtls.TLSServerSetting `mapstructure:"tls_settings, omitempty"`
+}
+
+// Validate checks that the settings are consistent.
+func (hss *HTTPServerSettings) Validate() error {
+	switch hss.ProxyProtocolVersion {
+	case "", proxyProtocolV1, proxyProtocolV2:
+	default:
+		return fmt.Errorf("unsupported proxy_protocol_version %q", hss.ProxyProtocolVersion)
+	}
+	if hss.ReusePort && !reusePortSupported {
+		return fmt.Errorf("reuse_port is not supported on %s", runtime.GOOS)
+	}
+	if hss.MaxConcurrentTLSHandshakes < 0 {
+		return fmt.Errorf("max_concurrent_tls_handshakes must be non-negative, got %d", hss.MaxConcurrentTLSHandshakes)
+	}
+	if hss.MaxRequestHeaders < 0 {
+		return fmt.Errorf("max_request_headers must be non-negative, got %d", hss.MaxRequestHeaders)
+	}
+	if hss.MaxRequestHeaderNameLength < 0 {
+		return fmt.Errorf("max_request_header_name_length must be non-negative, got %d", hss.MaxRequestHeaderNameLength)
+	}
+	if hss.MaxRequestHeaderValueLength < 0 {
+		return fmt.Errorf("max_request_header_value_length must be non-negative, got %d", hss.MaxRequestHeaderValueLength)
+	}
+	if _, err := parseNetworks("trusted_proxies", hss.TrustedProxies); err != nil {
+		return err
+	}
+	if hss.MaxConcurrentDecompressions < 0 {
+		return fmt.Errorf("max_concurrent_decompressions must be non-negative, got %d", hss.MaxConcurrentDecompressions)
+	}
+	if err := hss.validateMiddlewareExemptions(); err != nil {
+		return err
+	}
+	if hss.RequestLogging != nil {
+		if err := hss.RequestLogging.validate(); err != nil {
+			return err
+		}
+	}
+	if hss.Debug != nil {
+		if err := hss.Debug.validate(); err != nil {
+			return err
+		}
+	}
+	if hss.BodyCapture != nil {
+		if err := hss.BodyCapture.validate(); err != nil {
+			return err
+		}
+	}
+	if hss.CorsAllowCredentials {
+		for _, origin := range hss.CorsOrigins {
+			if origin == "*" {
+				return errors.New(`cors_allow_credentials cannot be used with the "*" origin in cors_allowed_origins`)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks the level and the format of the request logs.
+func (rl *RequestLoggingSettings) validate() error {
+	var level zapcore.Level
+	if rl.Level != "" && level.UnmarshalText([]byte(rl.Level)) != nil {
+		return fmt.Errorf("unsupported request_logging level %q", rl.Level)
+	}
+	switch rl.Format {
+	case "", requestLogFormatText:
+		if rl.Output != "" {
+			return errors.New("request_logging output requires the json format")
+		}
+	case requestLogFormatJSON:
+		_, closeOut, err := zap.Open(rl.output())
+		if err != nil {
+			return fmt.Errorf("invalid request_logging output %q: %w", rl.output(), err)
+		}
+		closeOut()
+	default:
+		return fmt.Errorf("unsupported request_logging format %q", rl.Format)
+	}
+	return nil
+}
+
+func (rl *RequestLoggingSettings) output() string {
+	if rl.Output == "" {
+		return "stdout"
+	}
+	return rl.Output
 }
 
+// validate checks that the debug endpoints are served under a path and are not
+// open to all the peers.
+func (ds *DebugSettings) validate() error {
+	if ds.PathPrefix != "" && (!strings.HasPrefix(ds.PathPrefix, "/") || strings.Trim(ds.PathPrefix, "/") == "") {
+		return fmt.Errorf("invalid debug path_prefix %q: must be an absolute path other than /", ds.PathPrefix)
+	}
+	if len(ds.AllowedIPs) == 0 && ds.Token == "" {
+		return errors.New("debug requires allowed_ips or token")
+	}
+	_, err := parseNetworks("debug allowed_ips", ds.AllowedIPs)
+	return err
+}
+
+// validate checks that the captures have a directory and non-negative limits.
+func (bcs *BodyCaptureSettings) validate() error {
+	if bcs.Directory == "" {
+		return errors.New("body_capture requires a directory")
+	}
+	if bcs.MaxBodySize < 0 || bcs.MaxFiles < 0 || bcs.MaxPerMinute < 0 {
+		return errors.New("body_capture max_body_size, max_files and max_per_minute must be non-negative")
+	}
+	return nil
+}
+
+// parseNetworks returns the networks of the IP addresses or CIDR ranges of the
+// given setting, the single addresses are networks of one address.
+func parseNetworks(setting string, values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: must be an IP address or a CIDR range", setting, value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ToListener returns the listener for Endpoint, after validating the settings.
+// The Addr method of the listener returns the address actually bound, with the
+// port picked by the system when the port of Endpoint is 0, also when the
+// listener is wrapped for TLS.
 func (hss *HTTPServerSettings) ToListener() (net.Listener, error) {
-	listener, err := net.Listen("tcp", hss.Endpoint)
+	if err := hss.Validate(); err != nil {
+		return nil, err
+	}
+	return hss.toListener(hss.Endpoint, hss.TLSSetting)
+}
+
+// ToListeners returns the listener for Endpoint followed by one listener per
+// entry of AdditionalEndpoints, all of them can be served by the same server.
+// As with ToListener, the Addr method of the listeners returns the bound address.
+func (hss *HTTPServerSettings) ToListeners() ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, 1+len(hss.AdditionalEndpoints))
+	closeAll := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+	listener, err := hss.ToListener()
 	if err != nil {
 		return nil, err
 	}
+	listeners = append(listeners, listener)
+	for _, e := range hss.AdditionalEndpoints {
+		listener, err = hss.toListener(e.Endpoint, e.TLSSetting)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
 
-	if hss.TLSSetting != nil {
+// toListener returns the listener of one of the endpoints, with the settings
+// shared by all the endpoints applied.
+func (hss *HTTPServerSettings) toListener(endpoint string, tlsSetting *configtls.TLSServerSetting) (net.Listener, error) {
+	var lc net.ListenConfig
+	if hss.ReusePort {
+		lc.Control = reusePortControl
+	}
+	listener, err := lc.Listen(context.Background(), "tcp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// The PROXY protocol header is sent before the TLS handshake.
+	if hss.EnableProxyProtocol {
+		listener = &proxyProtocolListener{Listener: listener, version: hss.ProxyProtocolVersion}
+	}
+
+	if tlsSetting != nil {
 		var tlsCfg *tls.Config
-		tlsCfg, err = hss.TLSSetting.LoadTLSConfig()
+		tlsCfg, err = tlsSetting.LoadTLSConfig()
 		if err != nil {
+			listener.Close()
 			return nil, err
 		}
-		listener = tls.NewListener(listener, tlsCfg)
+		if len(hss.NextProtos) > 0 {
+			tlsCfg.NextProtos = nextProtos(hss.NextProtos, hss.ForceHTTP1)
+		}
+		if hss.SessionTicketKeyRotation <= 0 {
+			listener = tls.NewListener(listener, tlsCfg)
+		} else {
+			var stl *sessionTicketListener
+			stl, err = newSessionTicketListener(listener, tlsCfg, hss.SessionTicketKeyRotation)
+			if err != nil {
+				listener.Close()
+				return nil, err
+			}
+			listener = stl
+		}
+		if hss.MaxConcurrentTLSHandshakes > 0 {
+			listener = newHandshakeLimitListener(listener, hss.MaxConcurrentTLSHandshakes, hss.TLSHandshakeQueueTimeout)
+		}
 	}
 	return listener, nil
 }
 
+// http2NextProto is the ALPN protocol of HTTP/2 over TLS.
+const http2NextProto = "h2"
+
+// nextProtos returns the ALPN protocols, without HTTP/2 when it is disabled,
+// since the connections negotiating it would be served with HTTP/1.1.
+func nextProtos(protos []string, forceHTTP1 bool) []string {
+	if !forceHTTP1 {
+		return protos
+	}
+	filtered := make([]string, 0, len(protos))
+	for _, proto := range protos {
+		if proto != http2NextProto {
+			filtered = append(filtered, proto)
+		}
+	}
+	return filtered
+}
+
+func containsNextProto(protos []string, proto string) bool {
+	for _, p := range protos {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultHealthCheckPath is the path of the health checks enabled by WithHealthCheck.
+const defaultHealthCheckPath = "/healthz"
+
 // toServerOptions has options that change the behavior of the HTTP server
 // returned by HTTPServerSettings.ToServer().
 type toServerOptions struct {
 	errorHandler middleware.ErrorHandler
+	logger       *zap.Logger
+	paths        []string
+	contentTypes []string
+	connState    func(net.Conn, http.ConnState)
+	healthPath   string
+	meter        view.Meter
+	// cleanups release the resources of the middlewares, e.g. the request logs
+	// output, once the server is shut down.
+	cleanups []func()
+
+	customizeMiddlewares func([]Middleware) []Middleware
 }
 
 type ToServerOption func(opts *toServerOptions)
 
 // WithErrorHandler overrides the HTTP error handler that gets invoked
-// when there is a failure inside middleware.HTTPContentDecompressor.
+// when there is a failure inside middleware.HTTPContentDecompressor or
+// when a request is rejected by one of the other middlewares.
 func WithErrorHandler(e middleware.ErrorHandler) ToServerOption {
 	return func(opts *toServerOptions) {
 		opts.errorHandler = e
 	}
 }
 
+// WithLogger sets the logger used to log the requests when
+// HTTPServerSettings.RequestLogging is set, the truncated responses and the
+// gzip bodies decoded with HTTPServerSettings.LenientGzip.
+func WithLogger(logger *zap.Logger) ToServerOption {
+	return func(opts *toServerOptions) {
+		opts.logger = logger
+	}
+}
+
+// WithConnState sets the http.Server.ConnState hook of the server, called when
+// a connection changes state, e.g. to count the active and idle connections.
+func WithConnState(connState func(net.Conn, http.ConnState)) ToServerOption {
+	return func(opts *toServerOptions) {
+		opts.connState = connState
+	}
+}
+
+// WithHealthCheck answers the GET and HEAD requests for path, "/healthz" if
+// empty, with a 200 status while the server is up. The health checks bypass all
+// the middlewares and the handler of the server, see middleware.HealthCheck.
+func WithHealthCheck(path string) ToServerOption {
+	return func(opts *toServerOptions) {
+		if path == "" {
+			path = defaultHealthCheckPath
+		}
+		opts.healthPath = path
+	}
+}
+
+// WithDecompressionMetrics records the metrics of the decompression of the
+// request bodies with meter, on which the views of
+// middleware.DecompressionMetricViews must be registered.
+func WithDecompressionMetrics(meter view.Meter) ToServerOption {
+	return func(opts *toServerOptions) {
+		opts.meter = meter
+	}
+}
+
+// WithDefaultContentTypes sets the content types accepted by the server when
+// HTTPServerSettings.AllowedContentTypes is not set.
+func WithDefaultContentTypes(contentTypes ...string) ToServerOption {
+	return func(opts *toServerOptions) {
+		opts.contentTypes = contentTypes
+	}
+}
+
+// WithPaths restricts the server to the given URL paths, the requests for other
+// paths are rejected with a 404 status by the error handler, see WithErrorHandler.
+func WithPaths(paths ...string) ToServerOption {
+	return func(opts *toServerOptions) {
+		opts.paths = paths
+	}
+}
+
 func (hss *HTTPServerSettings) ToServer(handler http.Handler, opts ...ToServerOption) *http.Server {
-	serverOpts := &toServerOptions{}
+	serverOpts := &toServerOptions{logger: zap.NewNop()}
 	for _, o := range opts {
 		o(serverOpts)
 	}
-	if len(hss.CorsOrigins) > 0 {
-		co := cors.Options{AllowedOrigins: hss.CorsOrigins}
-		handler = cors.New(co).Handler(handler)
+	if hss.ForceHTTP1 && containsNextProto(hss.NextProtos, http2NextProto) {
+		serverOpts.logger.Warn("The h2 protocol of next_protos is ignored since HTTP/2 is disabled by force_http1")
+	}
+	middlewares := hss.defaultMiddlewares(serverOpts)
+	if serverOpts.customizeMiddlewares != nil {
+		middlewares = serverOpts.customizeMiddlewares(middlewares)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = hss.wrapMiddleware(middlewares[i], handler)
+	}
+	// As the health checks, the debug requests bypass the middlewares, so that
+	// the profiles are not limited nor rejected.
+	if hss.Debug != nil {
+		// The settings are checked by Validate.
+		allowed, _ := parseNetworks("debug allowed_ips", hss.Debug.AllowedIPs)
+		prefix := hss.Debug.PathPrefix
+		if prefix == "" {
+			prefix = defaultDebugPathPrefix
+		}
+		handler = middleware.DebugHandler(handler, prefix, allowed, hss.Debug.Token)
+	}
+	// The health checks are answered before any middleware, so that the
+	// frequent probes are cheap and never rejected.
+	if serverOpts.healthPath != "" {
+		handler = middleware.HealthCheck(handler, serverOpts.healthPath)
+	}
+	srv := &http.Server{
+		Handler:   handler,
+		ConnState: serverOpts.connState,
+	}
+	if hss.SlidingWriteTimeout > 0 {
+		// The middleware takes the connection from the request context, and the
+		// deadline is cleared once the response is complete.
+		srv.ConnContext = middleware.ContextWithConn
+		srv.ConnState = func(c net.Conn, state http.ConnState) {
+			middleware.ClearWriteDeadline(c, state)
+			if serverOpts.connState != nil {
+				serverOpts.connState(c, state)
+			}
+		}
+	}
+	if hss.ForceHTTP1 {
+		// A non-nil empty TLSNextProto disables the HTTP/2 support, see net/http.
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	if len(serverOpts.cleanups) > 0 {
+		serverCleanups.Lock()
+		serverCleanups.m[srv] = serverOpts.cleanups
+		serverCleanups.Unlock()
+	}
+	return srv
+}
+
+// serverCleanups holds the cleanups of the servers returned by ToServer, run by
+// Shutdown.
+var serverCleanups = struct {
+	sync.Mutex
+	m map[*http.Server][]func()
+}{m: map[*http.Server][]func(){}}
+
+func runServerCleanups(srv *http.Server) {
+	serverCleanups.Lock()
+	cleanups := serverCleanups.m[srv]
+	delete(serverCleanups.m, srv)
+	serverCleanups.Unlock()
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+}
+
+// level returns the configured level of the request logs, checked by validate.
+func (rl *RequestLoggingSettings) level() zapcore.Level {
+	level := zapcore.DebugLevel
+	if rl.Level != "" {
+		_ = level.UnmarshalText([]byte(rl.Level))
+	}
+	return level
+}
+
+// options returns the options of the request logger. The JSON output is opened
+// with its cleanup added to serverOpts, a failure to open it is logged and the
+// text format is used instead.
+func (rl *RequestLoggingSettings) options(serverOpts *toServerOptions) []middleware.RequestLoggerOption {
+	opts := []middleware.RequestLoggerOption{
+		middleware.WithLogLevel(rl.level()),
+		middleware.WithLogSampling(rl.SamplingInitial, rl.SamplingThereafter),
+	}
+	if rl.Format == requestLogFormatJSON {
+		out, closeOut, err := zap.Open(rl.output())
+		if err != nil {
+			serverOpts.logger.Error("Failed to open the request logging output, using text", zap.String("output", rl.output()), zap.Error(err))
+			return opts
+		}
+		serverOpts.cleanups = append(serverOpts.cleanups, closeOut)
+		opts = append(opts, middleware.WithJSONFormat(out))
+	}
+	return opts
+}
+
+// Shutdown stops the server returned by ToServer from accepting new connections
+// and waits up to DrainTimeout, or until ctx is done, for the in-flight requests
+// to complete before closing the remaining connections. The error of the drain,
+// e.g. context.DeadlineExceeded, is returned wrapped when requests were still in
+// flight, with the error of the close in its message if any. The resources of the
+// middlewares, e.g. the request logs output, are released once it returns.
+func (hss *HTTPServerSettings) Shutdown(ctx context.Context, srv *http.Server) error {
+	if hss.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hss.DrainTimeout)
+		defer cancel()
+	}
+	defer runServerCleanups(srv)
+	err := srv.Shutdown(ctx)
+	if err == nil {
+		return nil
 	}
-	handler = middleware.HTTPContentDecompressor(
-		handler,
-		middleware.WithErrorHandler(serverOpts.errorHandler),
-	)
-	return &http.Server{
-		Handler: handler,
+	if closeErr := srv.Close(); closeErr != nil {
+		return fmt.Errorf("failed to drain the server: %w (closing it failed: %v)", err, closeErr)
 	}
+	return fmt.Errorf("failed to drain the server: %w", err)
 }
@@ -15,17 +15,34 @@
 package confighttp
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"go.opentelemetry.io/collector/config/configtls"
 )
@@ -86,6 +103,77 @@ func TestHTTPClientSettingsError(t *testing.T) {
 	}
 }
 
+func TestHTTPClientSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings HTTPClientSettings
+		err      string
+	}{
+		{
+			name:     "valid",
+			settings: HTTPClientSettings{Endpoint: "https://localhost:1234/v1/traces", Compression: "gzip"},
+		},
+		{
+			name:     "srv_endpoint",
+			settings: HTTPClientSettings{Endpoint: "dns+srv+https://_otlp._tcp.example.com"},
+		},
+		{
+			name: "empty_endpoint",
+			err:  "endpoint must be set",
+		},
+		{
+			name:     "endpoint_without_scheme",
+			settings: HTTPClientSettings{Endpoint: "localhost:1234"},
+			err:      `invalid endpoint "localhost:1234": must be an URL with a scheme and a host`,
+		},
+		{
+			name:     "invalid_endpoint",
+			settings: HTTPClientSettings{Endpoint: "http://local host"},
+			err:      `invalid endpoint "http://local host": parse "http://local host": invalid character " " in host name`,
+		},
+		{
+			name:     "negative_timeout",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:1234", Timeout: -time.Second},
+			err:      "timeout must be non-negative, got -1s",
+		},
+		{
+			name:     "negative_read_buffer_size",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:1234", ReadBufferSize: -1},
+			err:      "read_buffer_size must be non-negative, got -1",
+		},
+		{
+			name:     "negative_write_buffer_size",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:1234", WriteBufferSize: -1},
+			err:      "write_buffer_size must be non-negative, got -1",
+		},
+		{
+			name:     "negative_max_response_body_size",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:1234", MaxResponseBodySize: -1},
+			err:      "max_response_body_size must be non-negative, got -1",
+		},
+		{
+			name:     "invalid_local_addr",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:1234", LocalAddr: "localhost"},
+			err:      `invalid local_addr "localhost": must be an IP address with an optional port`,
+		},
+		{
+			name:     "unsupported_compression",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:1234", Compression: "lz4"},
+			err:      `unsupported compression type "lz4"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
 func TestHTTPServerSettingsError(t *testing.T) {
 	tests := []struct {
 		settings HTTPServerSettings
@@ -122,6 +210,22 @@ func TestHTTPServerSettingsError(t *testing.T) {
 				},
 			},
 		},
+		{
+			err: `^cors_allow_credentials cannot be used with the "\*" origin in cors_allowed_origins$`,
+			settings: HTTPServerSettings{
+				Endpoint:             "localhost:0",
+				CorsOrigins:          []string{"allowed-origin.com", "*"},
+				CorsAllowCredentials: true,
+			},
+		},
+		{
+			err: `^unsupported proxy_protocol_version "v3"$`,
+			settings: HTTPServerSettings{
+				Endpoint:             "localhost:0",
+				EnableProxyProtocol:  true,
+				ProxyProtocolVersion: "v3",
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.err, func(t *testing.T) {
@@ -309,6 +413,184 @@ func TestHttpCors(t *testing.T) {
 	require.NoError(t, s.Close())
 }
 
+func TestHttpCorsExposedHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Trace-Id", "1234")
+	})
+	tests := []struct {
+		name           string
+		exposedHeaders []string
+		want           string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:           "exposed",
+			exposedHeaders: []string{"X-Trace-Id"},
+			want:           "X-Trace-Id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				CorsOrigins:        []string{"allowed-origin.com"},
+				CorsExposedHeaders: tt.exposedHeaders,
+			}
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Origin", "allowed-origin.com")
+			rec := httptest.NewRecorder()
+			hss.ToServer(handler).Handler.ServeHTTP(rec, req)
+			assert.Equal(t, "allowed-origin.com", rec.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.want, rec.Header().Get("Access-Control-Expose-Headers"))
+		})
+	}
+}
+
+func TestHttpCorsAllowOriginFunc(t *testing.T) {
+	hss := &HTTPServerSettings{
+		// Ignored in favor of the function.
+		CorsOrigins: []string{"https://static.example.com"},
+		CorsAllowOriginFunc: func(origin string) bool {
+			return strings.HasSuffix(origin, ".corp.example.com")
+		},
+	}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{origin: "https://a.corp.example.com", want: "https://a.corp.example.com"},
+		{origin: "https://corp.example.com.evil.com"},
+		{origin: "https://static.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			s.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestHttpCorsOptionsPassthrough(t *testing.T) {
+	for _, passthrough := range []bool{false, true} {
+		t.Run(fmt.Sprint(passthrough), func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				CorsOrigins:            []string{"allowed-origin.com"},
+				CorsOptionsPassthrough: passthrough,
+			}
+			var called bool
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+			}), WithDefaultContentTypes("application/x-protobuf"))
+
+			req := httptest.NewRequest("OPTIONS", "/", nil)
+			req.Header.Set("Origin", "allowed-origin.com")
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			rec := httptest.NewRecorder()
+			s.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, "allowed-origin.com", rec.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, passthrough, called)
+			if passthrough {
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+				assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+			} else {
+				assert.Equal(t, http.StatusOK, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHttpCorsAllowCredentials(t *testing.T) {
+	for _, allowCredentials := range []bool{false, true} {
+		t.Run(fmt.Sprint(allowCredentials), func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				CorsOrigins:          []string{"allowed-*.com"},
+				CorsAllowCredentials: allowCredentials,
+			}
+			require.NoError(t, hss.Validate())
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Origin", "allowed-origin.com")
+			rec := httptest.NewRecorder()
+			hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).Handler.ServeHTTP(rec, req)
+			want := ""
+			if allowCredentials {
+				want = "true"
+			}
+			assert.Equal(t, want, rec.Header().Get("Access-Control-Allow-Credentials"))
+		})
+	}
+}
+
+func TestHttpTrustedProxies(t *testing.T) {
+	hss := &HTTPServerSettings{TrustedProxies: []string{"10.0.0.0/8", "not-an-ip"}}
+	assert.EqualError(t, hss.Validate(), `invalid trusted_proxies "not-an-ip": must be an IP address or a CIDR range`)
+
+	hss = &HTTPServerSettings{TrustedProxies: []string{"192.0.2.1", "2001:db8::/32"}}
+	require.NoError(t, hss.Validate())
+	var got string
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+	for _, tt := range []struct{ remoteAddr, want string }{
+		{remoteAddr: "192.0.2.1:1234", want: "198.51.100.1:0"},
+		{remoteAddr: "[2001:db8::1]:1234", want: "198.51.100.1:0"},
+		{remoteAddr: "192.0.2.2:1234", want: "192.0.2.2:1234"},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestHttpServerDebug(t *testing.T) {
+	for _, tt := range []struct {
+		debug   *DebugSettings
+		wantErr string
+	}{
+		{debug: &DebugSettings{}, wantErr: "debug requires allowed_ips or token"},
+		{debug: &DebugSettings{PathPrefix: "/", Token: "secret"}, wantErr: `invalid debug path_prefix "/": must be an absolute path other than /`},
+		{debug: &DebugSettings{AllowedIPs: []string{"not-an-ip"}}, wantErr: `invalid debug allowed_ips "not-an-ip": must be an IP address or a CIDR range`},
+	} {
+		hss := &HTTPServerSettings{Debug: tt.debug}
+		assert.EqualError(t, hss.Validate(), tt.wantErr)
+	}
+
+	hss := &HTTPServerSettings{
+		Debug: &DebugSettings{AllowedIPs: []string{"192.0.2.1"}, Token: "secret"},
+	}
+	require.NoError(t, hss.Validate())
+	// The debug requests bypass the path filter.
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}), WithPaths("/v1/traces"))
+	for _, tt := range []struct {
+		path, remoteAddr, auth string
+		wantCode               int
+	}{
+		{path: "/debug/vars", remoteAddr: "192.0.2.1:1234", wantCode: http.StatusOK},
+		{path: "/debug/vars", remoteAddr: "192.0.2.2:1234", auth: "Bearer secret", wantCode: http.StatusOK},
+		{path: "/debug/pprof/", remoteAddr: "192.0.2.2:1234", wantCode: http.StatusNotFound},
+		{path: "/v1/traces", remoteAddr: "192.0.2.2:1234", wantCode: http.StatusAccepted},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.wantCode, rec.Code, tt.path)
+	}
+}
+
 func verifyCorsResp(t *testing.T, url string, origin string, wantStatus int, wantAllowed bool) {
 	req, err := http.NewRequest("OPTIONS", url, nil)
 	require.NoError(t, err, "Error creating trace OPTIONS request: %v", err)
@@ -391,3 +673,1478 @@ func TestHttpHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestHttpHeadersRequestReuse(t *testing.T) {
+	var got []http.Header
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		got = append(got, req.Header)
+		// A transport further in the chain adding a header to its request.
+		req.Header.Add("X-Attempt", "1")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	hcs := &HTTPClientSettings{
+		Headers: map[string]string{"X-Settings": "settings"},
+	}
+	rt, err := hcs.ToClientWithBase(base)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "http://localhost:1234", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Caller", "caller")
+	for i := 0; i < 2; i++ {
+		resp, err := rt.Transport.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	assert.Equal(t, http.Header{"X-Caller": {"caller"}}, req.Header)
+	require.Len(t, got, 2)
+	for _, h := range got {
+		assert.Equal(t, "settings", h.Get("X-Settings"))
+		assert.Equal(t, "caller", h.Get("X-Caller"))
+		assert.Equal(t, []string{"1"}, h.Values("X-Attempt"))
+	}
+}
+
+func TestHttpClientTracePropagation(t *testing.T) {
+	tests := []struct {
+		name             string
+		tracePropagation bool
+	}{
+		{
+			name:             "disabled",
+			tracePropagation: false,
+		},
+		{
+			name:             "enabled",
+			tracePropagation: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotTraceParent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotTraceParent = r.Header.Get("traceparent")
+				w.WriteHeader(200)
+			}))
+			defer server.Close()
+			setting := HTTPClientSettings{
+				Endpoint:         server.URL,
+				TracePropagation: tt.tracePropagation,
+				Headers: map[string]string{
+					"header1": "value1",
+				},
+			}
+			client, err := setting.ToClient()
+			require.NoError(t, err)
+
+			ctx, span := trace.StartSpan(context.Background(), "parent")
+			defer span.End()
+			req, err := http.NewRequestWithContext(ctx, "GET", setting.Endpoint, nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			if tt.tracePropagation {
+				assert.Contains(t, gotTraceParent, span.SpanContext().TraceID.String())
+			} else {
+				assert.Empty(t, gotTraceParent)
+			}
+		})
+	}
+}
+
+func TestHttpServerShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		drainTimeout time.Duration
+		ctxTimeout   time.Duration
+		handlerDelay time.Duration
+		wantErr      bool
+	}{
+		{
+			name:         "drained",
+			drainTimeout: 5 * time.Second,
+			handlerDelay: 50 * time.Millisecond,
+		},
+		{
+			name:         "drained_without_timeout",
+			handlerDelay: 50 * time.Millisecond,
+		},
+		{
+			name:         "drain_timeout",
+			drainTimeout: 50 * time.Millisecond,
+			handlerDelay: 5 * time.Second,
+			wantErr:      true,
+		},
+		{
+			name:         "context_done",
+			ctxTimeout:   50 * time.Millisecond,
+			handlerDelay: 5 * time.Second,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				Endpoint:     "localhost:0",
+				DrainTimeout: tt.drainTimeout,
+			}
+			ln, err := hss.ToListener()
+			require.NoError(t, err)
+			started := make(chan struct{})
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-time.After(tt.handlerDelay):
+				case <-r.Context().Done():
+				}
+				w.WriteHeader(200)
+			}))
+			go func() {
+				_ = s.Serve(ln)
+			}()
+
+			errResp := make(chan error, 1)
+			go func() {
+				resp, err := http.Get(fmt.Sprintf("http://%s", ln.Addr().String()))
+				if err == nil {
+					resp.Body.Close()
+				}
+				errResp <- err
+			}()
+			<-started
+
+			ctx := context.Background()
+			if tt.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxTimeout)
+				defer cancel()
+			}
+			start := time.Now()
+			err = hss.Shutdown(ctx, s)
+			assert.Less(t, int64(time.Since(start)), int64(time.Second))
+			if tt.wantErr {
+				// The requests still in flight are reported.
+				assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+				assert.Error(t, <-errResp)
+			} else {
+				require.NoError(t, err)
+				assert.NoError(t, <-errResp)
+			}
+		})
+	}
+}
+
+func TestHttpForceHTTP1(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	tests := []struct {
+		name         string
+		serverHTTP1  bool
+		clientHTTP1  bool
+		base         *http.Transport
+		wantProtocol string
+	}{
+		{
+			name:         "http2",
+			wantProtocol: "HTTP/2.0",
+		},
+		{
+			// A transport without ForceAttemptHTTP2 only attempts HTTP/2 without
+			// custom TLS config.
+			name:         "http2_custom_base",
+			base:         &http.Transport{},
+			wantProtocol: "HTTP/2.0",
+		},
+		{
+			name:         "client_http1_custom_base",
+			clientHTTP1:  true,
+			base:         &http.Transport{ForceAttemptHTTP2: true},
+			wantProtocol: "HTTP/1.1",
+		},
+		{
+			name:         "server_http1",
+			serverHTTP1:  true,
+			wantProtocol: "HTTP/1.1",
+		},
+		{
+			name:         "client_http1",
+			clientHTTP1:  true,
+			wantProtocol: "HTTP/1.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				Endpoint:   "localhost:0",
+				ForceHTTP1: tt.serverHTTP1,
+			}
+			ln, err := hss.ToListener()
+			require.NoError(t, err)
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, errWrite := fmt.Fprint(w, r.Proto)
+				assert.NoError(t, errWrite)
+			}))
+			go func() {
+				_ = s.ServeTLS(ln, certs.serverCertFile, certs.serverKeyFile)
+			}()
+			defer s.Close()
+
+			hcs := &HTTPClientSettings{
+				Endpoint: "https://" + ln.Addr().String(),
+				TLSSetting: configtls.TLSClientSetting{
+					TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+				},
+				ForceHTTP1: tt.clientHTTP1,
+			}
+			var base http.RoundTripper = http.DefaultTransport
+			if tt.base != nil {
+				base = tt.base
+			}
+			client, err := hcs.ToClientWithBase(base)
+			require.NoError(t, err)
+			resp, err := client.Get(hcs.Endpoint)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.wantProtocol, string(body))
+			assert.Equal(t, tt.wantProtocol, resp.Proto)
+		})
+	}
+}
+
+func TestHttpClientDialer(t *testing.T) {
+	hcs := &HTTPClientSettings{}
+	d := hcs.dialer()
+	assert.Equal(t, 30*time.Second, d.Timeout)
+	assert.Equal(t, 30*time.Second, d.KeepAlive)
+
+	hcs = &HTTPClientSettings{
+		DialerTimeout: 5 * time.Second,
+		KeepAlive:     time.Minute,
+	}
+	d = hcs.dialer()
+	assert.Equal(t, 5*time.Second, d.Timeout)
+	assert.Equal(t, time.Minute, d.KeepAlive)
+}
+
+func TestHttpClientLocalAddr(t *testing.T) {
+	var remoteAddr string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint:  server.URL,
+		LocalAddr: "127.0.0.1",
+	}
+	d := hcs.dialer()
+	assert.Equal(t, &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}, d.LocalAddr)
+
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Get(hcs.Endpoint)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	host, _, err := net.SplitHostPort(remoteAddr)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+
+	for _, addr := range []string{"not_an_ip", "127.0.0.1:port", "127.0.0.1:70000"} {
+		hcs = &HTTPClientSettings{Endpoint: server.URL, LocalAddr: addr}
+		_, err = hcs.ToClient()
+		assert.Error(t, err, addr)
+	}
+	hcs = &HTTPClientSettings{Endpoint: server.URL, LocalAddr: "[::1]:0"}
+	addr, err := hcs.localAddr()
+	require.NoError(t, err)
+	assert.Equal(t, &net.TCPAddr{IP: net.ParseIP("::1")}, addr)
+}
+
+func TestHttpClientDialerTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint:      server.URL,
+		DialerTimeout: time.Nanosecond,
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	_, err = client.Get(hcs.Endpoint)
+	require.Error(t, err)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestHttpClientRequireTLS(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		settings HTTPClientSettings
+		wantErr  string
+	}{
+		{
+			name:     "http",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:4318", RequireTLS: true},
+			wantErr:  `invalid endpoint "http://localhost:4318": require_tls requires an https endpoint`,
+		},
+		{
+			name:     "srv",
+			settings: HTTPClientSettings{Endpoint: "dns+srv://_otlp._tcp.example.com", RequireTLS: true},
+			wantErr:  `invalid endpoint "dns+srv://_otlp._tcp.example.com": require_tls requires an https endpoint`,
+		},
+		{
+			name: "insecure",
+			settings: HTTPClientSettings{
+				Endpoint:   "https://localhost:4318",
+				RequireTLS: true,
+				TLSSetting: configtls.TLSClientSetting{Insecure: true},
+			},
+			wantErr: "require_tls cannot be used with insecure without ca_file",
+		},
+		{
+			name:     "https",
+			settings: HTTPClientSettings{Endpoint: "https://localhost:4318", RequireTLS: true},
+		},
+		{
+			name:     "srv_https",
+			settings: HTTPClientSettings{Endpoint: "dns+srv+https://_otlp._tcp.example.com", RequireTLS: true},
+		},
+		{
+			name:     "not_required",
+			settings: HTTPClientSettings{Endpoint: "http://localhost:4318"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.settings.ToClient()
+			_, transportErr := tt.settings.ToTransport()
+			_, sharedErr := tt.settings.ToClientWithSharedTransport(http.DefaultTransport.(*http.Transport))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.NoError(t, transportErr)
+				assert.NoError(t, sharedErr)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			assert.EqualError(t, transportErr, tt.wantErr)
+			if tt.name != "insecure" {
+				assert.EqualError(t, tt.settings.Validate(), tt.wantErr)
+				assert.EqualError(t, sharedErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHttpClientTLSHandshakeTimeout(t *testing.T) {
+	// The listener accepts the connections but never answers the handshake.
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	hcs := &HTTPClientSettings{
+		Endpoint:            "https://" + ln.Addr().String(),
+		TLSHandshakeTimeout: 50 * time.Millisecond,
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	assert.Equal(t, 50*time.Millisecond, client.Transport.(*http.Transport).TLSHandshakeTimeout)
+
+	start := time.Now()
+	_, err = client.Get(hcs.Endpoint)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS handshake timeout")
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
+
+func TestHttpClientExpectContinueTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint:              server.URL,
+		ExpectContinueTimeout: time.Minute,
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, client.Transport.(*http.Transport).ExpectContinueTimeout)
+
+	body := &countingReader{r: strings.NewReader(strings.Repeat("a", 1024*1024))}
+	req, err := http.NewRequest("POST", hcs.Endpoint, body)
+	require.NoError(t, err)
+	req.Header.Set("Expect", "100-continue")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	// The server rejected the request before the body was sent.
+	assert.Equal(t, 0, body.n)
+}
+
+func TestHttpAdaptiveConcurrencyLimit(t *testing.T) {
+	hss := &HTTPServerSettings{
+		Endpoint: "localhost:0",
+		AdaptiveConcurrencyLimit: &AdaptiveConcurrencyLimitSettings{
+			InitialLimit: 1,
+			MaxLimit:     1,
+		},
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), WithErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		http.Error(w, "custom: "+errorMsg, statusCode)
+	}))
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	url := fmt.Sprintf("http://%s", ln.Addr().String())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, errResp := http.Get(url)
+		if assert.NoError(t, errResp) {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "custom: too many concurrent requests\n", string(body))
+
+	close(release)
+	<-done
+}
+
+func TestHttpClientContentType(t *testing.T) {
+	var gotContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint:    server.URL,
+		ContentType: "application/json; charset=utf-8",
+		Headers: map[string]string{
+			"content-type": "text/plain",
+		},
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Post(hcs.Endpoint, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "application/json; charset=utf-8", gotContentType)
+}
+
+func TestHttpClientContentTypeError(t *testing.T) {
+	tests := []struct {
+		contentType string
+		err         string
+	}{
+		{
+			contentType: "text/plain; charset=utf-8",
+			err:         `unsupported content_type "text/plain; charset=utf-8", must be one of [application/x-protobuf application/json]`,
+		},
+		{
+			contentType: "application/json; charset",
+			err:         `invalid content_type "application/json; charset": mime: invalid media parameter`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			hcs := &HTTPClientSettings{ContentType: tt.contentType}
+			_, err := hcs.ToClient()
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestHttpRequestLogging(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings *RequestLoggingSettings
+		want     zapcore.Level
+		wantLogs int
+	}{
+		{
+			name:     "default_level",
+			settings: &RequestLoggingSettings{},
+			want:     zapcore.DebugLevel,
+			wantLogs: 1,
+		},
+		{
+			name:     "info_level",
+			settings: &RequestLoggingSettings{Level: "info"},
+			want:     zapcore.InfoLevel,
+			wantLogs: 1,
+		},
+		{
+			name: "disabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			hss := &HTTPServerSettings{RequestLogging: tt.settings}
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}), WithLogger(zap.New(core)))
+			s.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/traces", nil))
+
+			require.Equal(t, tt.wantLogs, logs.Len())
+			if tt.wantLogs == 0 {
+				return
+			}
+			entry := logs.All()[tt.wantLogs-1]
+			assert.Equal(t, tt.want, entry.Level)
+			assert.Equal(t, "/v1/traces", entry.ContextMap()["path"])
+			assert.Equal(t, int64(http.StatusTeapot), entry.ContextMap()["status"])
+		})
+	}
+}
+
+func TestHttpRequestLoggingValidate(t *testing.T) {
+	for _, tt := range []struct {
+		settings *RequestLoggingSettings
+		wantErr  string
+	}{
+		{settings: &RequestLoggingSettings{Level: "loud"}, wantErr: `unsupported request_logging level "loud"`},
+		{settings: &RequestLoggingSettings{Format: "xml"}, wantErr: `unsupported request_logging format "xml"`},
+		{settings: &RequestLoggingSettings{Output: "stderr"}, wantErr: "request_logging output requires the json format"},
+		{settings: &RequestLoggingSettings{Level: "warn", Format: "json", Output: "stderr"}},
+	} {
+		hss := &HTTPServerSettings{RequestLogging: tt.settings}
+		if tt.wantErr == "" {
+			assert.NoError(t, hss.Validate())
+		} else {
+			assert.EqualError(t, hss.Validate(), tt.wantErr)
+		}
+	}
+
+	hss := &HTTPServerSettings{RequestLogging: &RequestLoggingSettings{Format: "json", Output: "/nonexistent/requests.log"}}
+	err := hss.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid request_logging output "/nonexistent/requests.log"`)
+}
+
+func TestHttpRequestLoggingJSONFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "requestlogging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "requests.log")
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	hss := &HTTPServerSettings{RequestLogging: &RequestLoggingSettings{Format: "json", Level: "info", Output: output}}
+	require.NoError(t, hss.Validate())
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), WithLogger(zap.New(core)))
+	s.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/traces", nil))
+
+	assert.Equal(t, 0, logs.Len())
+	data, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "/v1/traces", line["path"])
+	assert.EqualValues(t, http.StatusTeapot, line["status"])
+
+	// The output is closed on shutdown.
+	serverCleanups.Lock()
+	assert.Len(t, serverCleanups.m[s], 1)
+	serverCleanups.Unlock()
+	require.NoError(t, hss.Shutdown(context.Background(), s))
+	serverCleanups.Lock()
+	assert.NotContains(t, serverCleanups.m, s)
+	serverCleanups.Unlock()
+
+	// An output failing to be opened after the validation falls back to the
+	// text logs.
+	require.NoError(t, os.RemoveAll(dir))
+	s = hss.ToServer(http.NotFoundHandler(), WithLogger(zap.New(core)))
+	s.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/traces", nil))
+	require.Equal(t, 2, logs.Len())
+	assert.Equal(t, "Failed to open the request logging output, using text", logs.All()[0].Message)
+	assert.Equal(t, "/v1/traces", logs.All()[1].ContextMap()["path"])
+}
+
+func TestHttpAdditionalEndpoints(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	hss := &HTTPServerSettings{
+		Endpoint: "localhost:0",
+		AdditionalEndpoints: []EndpointSetting{
+			{
+				Endpoint: "localhost:0",
+				TLSSetting: &configtls.TLSServerSetting{
+					TLSSetting: configtls.TLSSetting{
+						CertFile: certs.serverCertFile,
+						KeyFile:  certs.serverKeyFile,
+					},
+				},
+			},
+		},
+	}
+	lns, err := hss.ToListeners()
+	require.NoError(t, err)
+	require.Len(t, lns, 2)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, errWrite := fmt.Fprint(w, r.TLS != nil)
+		assert.NoError(t, errWrite)
+	}))
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			_ = s.Serve(ln)
+		}(ln)
+	}
+	defer s.Close()
+
+	for i, hcs := range []*HTTPClientSettings{
+		{Endpoint: "http://" + lns[0].Addr().String()},
+		{
+			Endpoint: "https://" + lns[1].Addr().String(),
+			TLSSetting: configtls.TLSClientSetting{
+				TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+			},
+		},
+	} {
+		client, err := hcs.ToClient()
+		require.NoError(t, err)
+		resp, err := client.Get(hcs.Endpoint)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, fmt.Sprint(i == 1), string(body))
+	}
+}
+
+func TestHttpAdditionalEndpointsError(t *testing.T) {
+	hss := &HTTPServerSettings{
+		Endpoint: "localhost:0",
+		AdditionalEndpoints: []EndpointSetting{
+			{
+				Endpoint: "localhost:0",
+				TLSSetting: &configtls.TLSServerSetting{
+					TLSSetting: configtls.TLSSetting{CAFile: "/doesnt/exist"},
+				},
+			},
+		},
+	}
+	_, err := hss.ToListeners()
+	assert.Error(t, err)
+}
+
+func TestHttpListenerAddr(t *testing.T) {
+	certs := newTestCertificates(t, "127.0.0.1")
+	for name, tlsSetting := range map[string]*configtls.TLSServerSetting{
+		"plaintext": nil,
+		"tls": {
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				Endpoint:   "127.0.0.1:0",
+				TLSSetting: tlsSetting,
+			}
+			ln, err := hss.ToListener()
+			require.NoError(t, err)
+			defer ln.Close()
+			addr, ok := ln.Addr().(*net.TCPAddr)
+			require.True(t, ok, "Unexpected address %v", ln.Addr())
+			assert.Equal(t, "127.0.0.1", addr.IP.String())
+			assert.NotZero(t, addr.Port)
+		})
+	}
+}
+
+func TestHttpPaths(t *testing.T) {
+	hss := &HTTPServerSettings{CorsOrigins: []string{"allowed-*.com"}}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithPaths("/v1/trace"),
+		WithErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+			http.Error(w, "custom: "+errorMsg, statusCode)
+		}))
+	for path, wantStatus := range map[string]int{
+		"/v1/trace": http.StatusOK,
+		"/v1/logs":  http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Origin", "allowed-origin.com")
+		s.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, wantStatus, rec.Code)
+		assert.Equal(t, "allowed-origin.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		if wantStatus == http.StatusNotFound {
+			assert.Equal(t, "custom: Not Found\n", rec.Body.String())
+		}
+	}
+}
+
+func TestHttpAllowedContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		contentType string
+		wantStatus  int
+	}{
+		{name: "default", contentType: "application/json", wantStatus: http.StatusOK},
+		{name: "default_rejected", contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "allowed", allowed: []string{"text/plain"}, contentType: "text/plain", wantStatus: http.StatusOK},
+		{name: "allowed_rejected", allowed: []string{"text/plain"}, contentType: "application/json", wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hss := &HTTPServerSettings{AllowedContentTypes: tt.allowed}
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				WithDefaultContentTypes("application/json"))
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			s.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestHttpSniffCompression(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	hss := &HTTPServerSettings{SniffCompression: true}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, errRead := ioutil.ReadAll(r.Body)
+		assert.NoError(t, errRead)
+		w.Write(body)
+	}))
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", &buf))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "payload", rec.Body.String())
+}
+
+func TestHttpConnState(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		states []http.ConnState
+	)
+	hss := &HTTPServerSettings{Endpoint: "localhost:0"}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithConnState(func(_ net.Conn, state http.ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+		}))
+	go func() {
+		_ = s.Serve(ln)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + ln.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.NoError(t, s.Close())
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(states) > 0 && states[len(states)-1] == http.StateClosed
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []http.ConnState{http.StateNew, http.StateActive, http.StateClosed}, states)
+}
+
+func TestHttpHandlerTimeout(t *testing.T) {
+	hss := &HTTPServerSettings{HandlerTimeout: time.Millisecond}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), WithErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		http.Error(w, "custom: "+errorMsg, statusCode)
+	}))
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "custom: request timed out\n", rec.Body.String())
+}
+
+func TestHttpClientToRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "settings", r.Header.Get("X-Settings"))
+		assert.Equal(t, "custom", r.Header.Get("X-Custom"))
+	}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint: server.URL,
+		Headers:  map[string]string{"X-Settings": "settings"},
+	}
+	rt, err := hcs.ToRoundTripper()
+	require.NoError(t, err)
+	client := &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Custom", "custom")
+			return rt.RoundTrip(req)
+		}),
+	}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHttpClientToClientWithBase(t *testing.T) {
+	var got *http.Request
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		got = req
+		return &http.Response{StatusCode: http.StatusAccepted, Body: http.NoBody}, nil
+	})
+	hcs := &HTTPClientSettings{
+		Endpoint: "http://localhost:1234",
+		Headers:  map[string]string{"X-Test": "value"},
+		Timeout:  time.Minute,
+	}
+	client, err := hcs.ToClientWithBase(base)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, client.Timeout)
+	resp, err := client.Get(hcs.Endpoint)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NotNil(t, got)
+	assert.Equal(t, "value", got.Header.Get("X-Test"))
+}
+
+func TestHttpClientToClientWithBaseTransport(t *testing.T) {
+	base := &http.Transport{MaxIdleConns: 7}
+	hcs := &HTTPClientSettings{
+		ReadBufferSize: 1024,
+	}
+	client, err := hcs.ToClientWithBase(base)
+	require.NoError(t, err)
+	transport := client.Transport.(*http.Transport)
+	assert.NotSame(t, base, transport)
+	assert.Equal(t, 7, transport.MaxIdleConns)
+	assert.Equal(t, 1024, transport.ReadBufferSize)
+	assert.Equal(t, 0, base.ReadBufferSize)
+}
+
+func TestHttpRetryAfter(t *testing.T) {
+	hss := &HTTPServerSettings{
+		RetryAfter: 5 * time.Second,
+		AdaptiveConcurrencyLimit: &AdaptiveConcurrencyLimitSettings{
+			InitialLimit: 1,
+			MaxLimit:     1,
+		},
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	}()
+	<-started
+
+	// The request over the concurrency limit is rejected with a Retry-After header.
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+
+	close(release)
+	<-done
+}
+
+func TestHttpMaxConcurrentRequests(t *testing.T) {
+	hss := &HTTPServerSettings{
+		RetryAfter:            5 * time.Second,
+		MaxConcurrentRequests: 1,
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), WithErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		http.Error(w, "custom: "+errorMsg, statusCode)
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "custom: too many in-flight requests\n", rec.Body.String())
+
+	close(release)
+	<-done
+}
+
+func TestHttpHealthCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		wantPath string
+	}{
+		{name: "default_path", wantPath: "/healthz"},
+		{name: "custom_path", path: "/ready", wantPath: "/ready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				CorsOrigins:           []string{"https://example.com"},
+				MaxConcurrentRequests: 1,
+			}
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			}), WithHealthCheck(tt.path), WithPaths("/v1/trace"))
+
+			// The health checks are not rejected by the middlewares, e.g. the
+			// decompression and the path filter.
+			req := httptest.NewRequest("GET", tt.wantPath, nil)
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			s.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "OK\n", rec.Body.String())
+
+			rec = httptest.NewRecorder()
+			s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/trace", nil))
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+		})
+	}
+}
+
+func TestHttpMaxResponseSize(t *testing.T) {
+	hss := &HTTPServerSettings{
+		MaxResponseSize: 4,
+		RequestLogging:  &RequestLoggingSettings{Level: "info"},
+	}
+	core, logs := observer.New(zapcore.InfoLevel)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte("truncated"))
+		assert.NoError(t, err)
+	}), WithLogger(zap.New(core)))
+
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "trun", rec.Body.String())
+
+	errorLogs := logs.FilterMessage("HTTP response body truncated").All()
+	require.Len(t, errorLogs, 1)
+	assert.Equal(t, int64(9), errorLogs[0].ContextMap()["size"])
+	requestLogs := logs.FilterMessage("HTTP request").All()
+	require.Len(t, requestLogs, 1)
+	assert.Equal(t, int64(4), requestLogs[0].ContextMap()["sent_bytes"])
+}
+
+func TestHttpServerHeaderLimits(t *testing.T) {
+	hss := &HTTPServerSettings{MaxRequestHeaderValueLength: -1}
+	assert.EqualError(t, hss.Validate(), "max_request_header_value_length must be non-negative, got -1")
+
+	hss = &HTTPServerSettings{MaxRequestHeaders: 2, MaxRequestHeaderValueLength: 8}
+	require.NoError(t, hss.Validate())
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Tenant", "a")
+	s.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Tenant", "too-long-value")
+	s.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "too-long-value")
+}
+
+func TestHttpSlidingWriteTimeout(t *testing.T) {
+	var active int32
+	hss := &HTTPServerSettings{SlidingWriteTimeout: time.Minute}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte("ok"))
+		assert.NoError(t, err)
+	}), WithConnState(func(c net.Conn, state http.ConnState) {
+		if state == http.StateActive {
+			atomic.StoreInt32(&active, 1)
+		}
+	}))
+	require.NotNil(t, s.ConnContext)
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "ok", string(body))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&active))
+}
+
+func TestHttpClientSharedTransport(t *testing.T) {
+	var mu sync.Mutex
+	remoteAddrs := map[string]bool{}
+	tenants := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		remoteAddrs[r.RemoteAddr] = true
+		tenants[r.Header.Get("X-Tenant")] = true
+	}))
+	defer server.Close()
+
+	shared, err := (&HTTPClientSettings{Endpoint: server.URL, ReadBufferSize: 1024}).ToTransport()
+	require.NoError(t, err)
+	assert.Equal(t, 1024, shared.ReadBufferSize)
+	assert.NotSame(t, http.DefaultTransport, shared)
+	defer shared.CloseIdleConnections()
+
+	for _, tenant := range []string{"a", "b", "c"} {
+		hcs := &HTTPClientSettings{
+			Endpoint: server.URL,
+			Headers:  map[string]string{"X-Tenant": tenant},
+		}
+		client, err := hcs.ToClientWithSharedTransport(shared)
+		require.NoError(t, err)
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	// The connection of the shared transport is reused by all the clients.
+	assert.Len(t, remoteAddrs, 1)
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "c": true}, tenants)
+}
+
+func TestHttpClientDisableKeepAlives(t *testing.T) {
+	for _, disableKeepAlives := range []bool{false, true} {
+		t.Run(fmt.Sprint(disableKeepAlives), func(t *testing.T) {
+			remoteAddrs := map[string]bool{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				remoteAddrs[r.RemoteAddr] = true
+			}))
+			defer server.Close()
+
+			hcs := &HTTPClientSettings{
+				Endpoint:          server.URL,
+				DisableKeepAlives: disableKeepAlives,
+			}
+			client, err := hcs.ToClient()
+			require.NoError(t, err)
+			for i := 0; i < 3; i++ {
+				resp, err := client.Get(server.URL)
+				require.NoError(t, err)
+				_, err = io.Copy(ioutil.Discard, resp.Body)
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+			}
+			wantConns := 1
+			if disableKeepAlives {
+				wantConns = 3
+			}
+			assert.Len(t, remoteAddrs, wantConns)
+		})
+	}
+}
+
+func TestHttpClientAuthType(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	tests := []struct {
+		clientAuthType string
+		clientCert     bool
+		wantErr        bool
+	}{
+		{clientAuthType: "verify_client_cert_if_given"},
+		{clientAuthType: "verify_client_cert_if_given", clientCert: true},
+		{clientAuthType: "require_and_verify_client_cert", wantErr: true},
+		{clientAuthType: "require_and_verify_client_cert", clientCert: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%v", tt.clientAuthType, tt.clientCert), func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				Endpoint: "localhost:0",
+				TLSSetting: &configtls.TLSServerSetting{
+					TLSSetting: configtls.TLSSetting{
+						CertFile: certs.serverCertFile,
+						KeyFile:  certs.serverKeyFile,
+					},
+					ClientCAFile:   certs.caFile,
+					ClientAuthType: tt.clientAuthType,
+				},
+			}
+			ln, err := hss.ToListener()
+			require.NoError(t, err)
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, errWrite := fmt.Fprint(w, len(r.TLS.PeerCertificates))
+				assert.NoError(t, errWrite)
+			}))
+			go func() {
+				_ = s.Serve(ln)
+			}()
+			defer s.Close()
+
+			hcs := &HTTPClientSettings{
+				Endpoint: "https://" + ln.Addr().String(),
+				TLSSetting: configtls.TLSClientSetting{
+					TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+				},
+			}
+			if tt.clientCert {
+				hcs.TLSSetting.CertFile = certs.clientCertFile
+				hcs.TLSSetting.KeyFile = certs.clientKeyFile
+			}
+			client, err := hcs.ToClient()
+			require.NoError(t, err)
+			resp, err := client.Get(hcs.Endpoint)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			wantCerts := "0"
+			if tt.clientCert {
+				wantCerts = "1"
+			}
+			assert.Equal(t, wantCerts, string(body))
+		})
+	}
+}
+
+func TestHttpNextProtos(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	tests := []struct {
+		name             string
+		serverProtos     []string
+		serverHTTP1      bool
+		clientProtos     []string
+		clientHTTP1      bool
+		wantProto        string
+		wantNegotiated   string
+		wantWarningCount int
+	}{
+		{
+			name:      "no_alpn",
+			wantProto: "HTTP/1.1",
+		},
+		{
+			name:           "h2",
+			serverProtos:   []string{"h2", "http/1.1"},
+			wantProto:      "HTTP/2.0",
+			wantNegotiated: "h2",
+		},
+		{
+			// The server only accepts the custom protocol handled by the
+			// clients preferring it.
+			name:           "custom",
+			serverProtos:   []string{"custom", "http/1.1"},
+			clientProtos:   []string{"http/1.1"},
+			clientHTTP1:    true,
+			wantProto:      "HTTP/1.1",
+			wantNegotiated: "http/1.1",
+		},
+		{
+			name:             "server_http1",
+			serverProtos:     []string{"h2", "http/1.1"},
+			serverHTTP1:      true,
+			wantProto:        "HTTP/1.1",
+			wantNegotiated:   "http/1.1",
+			wantWarningCount: 1,
+		},
+		{
+			name:           "client_http1",
+			serverProtos:   []string{"h2", "http/1.1"},
+			clientProtos:   []string{"h2", "http/1.1"},
+			clientHTTP1:    true,
+			wantProto:      "HTTP/1.1",
+			wantNegotiated: "http/1.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				Endpoint: "localhost:0",
+				TLSSetting: &configtls.TLSServerSetting{
+					TLSSetting: configtls.TLSSetting{
+						CertFile: certs.serverCertFile,
+						KeyFile:  certs.serverKeyFile,
+					},
+				},
+				NextProtos: tt.serverProtos,
+				ForceHTTP1: tt.serverHTTP1,
+			}
+			ln, err := hss.ToListener()
+			require.NoError(t, err)
+			core, logs := observer.New(zapcore.WarnLevel)
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, errWrite := fmt.Fprintf(w, "%s %s", r.Proto, r.TLS.NegotiatedProtocol)
+				assert.NoError(t, errWrite)
+			}), WithLogger(zap.New(core)))
+			go func() {
+				_ = s.Serve(ln)
+			}()
+			defer s.Close()
+			assert.Equal(t, tt.wantWarningCount, logs.Len())
+
+			hcs := &HTTPClientSettings{
+				Endpoint: "https://" + ln.Addr().String(),
+				TLSSetting: configtls.TLSClientSetting{
+					TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+				},
+				NextProtos: tt.clientProtos,
+				ForceHTTP1: tt.clientHTTP1,
+			}
+			client, err := hcs.ToClient()
+			require.NoError(t, err)
+			resp, err := client.Get(hcs.Endpoint)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.wantProto+" "+tt.wantNegotiated, string(body))
+		})
+	}
+}
+
+func TestHttpClientNextProtos(t *testing.T) {
+	hcs := &HTTPClientSettings{
+		TLSSetting: configtls.TLSClientSetting{ServerName: "example.com"},
+		NextProtos: []string{"custom", "h2", "http/1.1"},
+		ForceHTTP1: true,
+	}
+	transport := hcs.configureTransport(http.DefaultTransport.(*http.Transport).Clone(), &tls.Config{})
+	assert.Equal(t, []string{"custom", "http/1.1"}, transport.TLSClientConfig.NextProtos)
+}
+
+func TestHttpClientTLSServerNameOverride(t *testing.T) {
+	// The certificate of the server is only valid for a DNS name while the
+	// server is addressed by IP.
+	certs := newTestCertificates(t, "collector.example.com")
+	hss := &HTTPServerSettings{
+		Endpoint: "127.0.0.1:0",
+		TLSSetting: &configtls.TLSServerSetting{
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+		},
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, errWrite := fmt.Fprint(w, r.TLS.ServerName)
+		assert.NoError(t, errWrite)
+	}))
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	for _, serverName := range []string{"", "collector.example.com"} {
+		t.Run(serverName, func(t *testing.T) {
+			hcs := &HTTPClientSettings{
+				Endpoint: "https://" + ln.Addr().String(),
+				TLSSetting: configtls.TLSClientSetting{
+					TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+					ServerName: serverName,
+				},
+			}
+			client, err := hcs.ToClient()
+			require.NoError(t, err)
+			resp, err := client.Get(hcs.Endpoint)
+			if serverName == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, serverName, string(body))
+		})
+	}
+}
+
+func TestHttpClientTLSServerNameOverrideMTLS(t *testing.T) {
+	// The backend requires a client certificate and its certificate is only
+	// valid for a DNS name while the client dials another address, e.g. of a
+	// proxy.
+	certs := newTestCertificates(t, "backend.internal")
+	hss := &HTTPServerSettings{
+		Endpoint: "127.0.0.1:0",
+		TLSSetting: &configtls.TLSServerSetting{
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+			ClientCAFile: certs.caFile,
+		},
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, errWrite := fmt.Fprintf(w, "%s %s", r.TLS.ServerName, r.TLS.PeerCertificates[0].Subject.CommonName)
+		assert.NoError(t, errWrite)
+	}))
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	tests := []struct {
+		name       string
+		serverName string
+		clientCert bool
+		want       string
+	}{
+		{
+			name:       "server_name_and_client_cert",
+			serverName: "backend.internal",
+			clientCert: true,
+			want:       "backend.internal test-client",
+		},
+		{
+			name:       "missing_client_cert",
+			serverName: "backend.internal",
+		},
+		{
+			name:       "missing_server_name",
+			clientCert: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsSetting := configtls.TLSClientSetting{
+				TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+				ServerName: tt.serverName,
+			}
+			if tt.clientCert {
+				tlsSetting.CertFile = certs.clientCertFile
+				tlsSetting.KeyFile = certs.clientKeyFile
+			}
+			hcs := &HTTPClientSettings{
+				Endpoint:   "https://" + ln.Addr().String(),
+				TLSSetting: tlsSetting,
+			}
+			client, err := hcs.ToClient()
+			require.NoError(t, err)
+			resp, err := client.Get(hcs.Endpoint)
+			if tt.want == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestHttpResponseHeaders(t *testing.T) {
+	hss := &HTTPServerSettings{
+		ResponseHeaders: map[string]string{"X-Collector-Instance": "collector-1"},
+	}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}), WithPaths("/v1/trace"))
+
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/trace", nil))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "collector-1", rec.Header().Get("X-Collector-Instance"))
+
+	// The rejections of the middlewares have the headers too.
+	rec = httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "collector-1", rec.Header().Get("X-Collector-Instance"))
+}
+
+func TestHttpHeaderRenames(t *testing.T) {
+	hss := &HTTPServerSettings{
+		HeaderRenames: map[string]string{"x-tenant": "X-Scope-OrgID"},
+	}
+	var got http.Header
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Tenant", "tenant")
+	s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "tenant", got.Get("X-Scope-OrgID"))
+	assert.Empty(t, got.Get("X-Tenant"))
+}
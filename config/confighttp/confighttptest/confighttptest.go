@@ -0,0 +1,69 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package confighttptest provides helpers to test the HTTP servers configured
+// with confighttp.HTTPServerSettings.
+package confighttptest
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/collector/config/confighttp"
+)
+
+// Server is an HTTP server started by StartServer.
+type Server struct {
+	*http.Server
+
+	// Addr is the address the server listens on, as "host:port", with the
+	// port picked by the system when the endpoint ends with ":0".
+	Addr string
+
+	// URL is the base URL of the server, "http://" or "https://" followed by Addr.
+	URL string
+}
+
+// StartServer serves handler with the given settings, see HTTPServerSettings.ToListener
+// and HTTPServerSettings.ToServer, listening on "localhost:0" if the endpoint is
+// empty. The returned function stops the server and waits for it to return, it
+// should be deferred.
+func StartServer(hss confighttp.HTTPServerSettings, handler http.Handler, opts ...confighttp.ToServerOption) (*Server, func(), error) {
+	if hss.Endpoint == "" {
+		hss.Endpoint = "localhost:0"
+	}
+	listener, err := hss.ToListener()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srv := &Server{
+		Server: hss.ToServer(handler, opts...),
+		Addr:   listener.Addr().String(),
+	}
+	if hss.TLSSetting != nil {
+		srv.URL = "https://" + srv.Addr
+	} else {
+		srv.URL = "http://" + srv.Addr
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Serve(listener)
+	}()
+	return srv, func() {
+		srv.Close()
+		<-done
+	}, nil
+}
@@ -0,0 +1,99 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttptest
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestStartServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   confighttp.HTTPServerSettings
+		wantScheme string
+	}{
+		{
+			name:       "default_endpoint",
+			wantScheme: "http://",
+		},
+		{
+			name: "plaintext",
+			settings: confighttp.HTTPServerSettings{
+				Endpoint: "127.0.0.1:0",
+			},
+			wantScheme: "http://",
+		},
+		{
+			name: "tls",
+			settings: confighttp.HTTPServerSettings{
+				Endpoint: "127.0.0.1:0",
+				TLSSetting: &configtls.TLSServerSetting{
+					TLSSetting: configtls.TLSSetting{
+						CertFile: filepath.Join("..", "..", "configtls", "testdata", "test-cert.pem"),
+						KeyFile:  filepath.Join("..", "..", "configtls", "testdata", "test-key.pem"),
+					},
+				},
+			},
+			wantScheme: "https://",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			})
+			srv, cleanup, err := StartServer(tt.settings, handler)
+			require.NoError(t, err)
+			defer cleanup()
+
+			assert.True(t, strings.HasPrefix(srv.URL, tt.wantScheme), "Unexpected URL %q", srv.URL)
+			assert.NotContains(t, srv.Addr, ":0")
+			client := &http.Client{Transport: &http.Transport{
+				// The test certificate is not issued for the address of the server.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}}
+			resp, err := client.Get(srv.URL)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, "ok", string(body))
+		})
+	}
+}
+
+func TestStartServerCleanup(t *testing.T) {
+	srv, cleanup, err := StartServer(confighttp.HTTPServerSettings{}, http.NotFoundHandler())
+	require.NoError(t, err)
+	cleanup()
+	_, err = http.Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestStartServerError(t *testing.T) {
+	_, _, err := StartServer(confighttp.HTTPServerSettings{Endpoint: "localhost:-1"}, http.NotFoundHandler())
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// lookupHostFunc has the signature of net.Resolver.LookupHost.
+type lookupHostFunc func(ctx context.Context, host string) ([]string, error)
+
+// dialContextFunc has the signature of net.Dialer.DialContext.
+type dialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// dnsCache caches the addresses of the host names dialed by the client
+// transport for ttl, instead of resolving them for each new connection.
+// Failed lookups are not cached.
+type dnsCache struct {
+	lookupHost lookupHostFunc
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs    []string
+	resolved time.Time
+}
+
+func newDNSCache(lookup lookupHostFunc, ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		lookupHost: lookup,
+		ttl:        ttl,
+		entries:    map[string]dnsCacheEntry{},
+	}
+}
+
+// dialContext wraps dial so that the host of the address is resolved with the
+// cache. The resolved addresses are tried in order until one connects, like
+// net.Dialer does.
+func (c *dnsCache) dialContext(dial dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		for _, addr := range addrs {
+			if conn, err = dial(ctx, network, net.JoinHostPort(addr, port)); err == nil {
+				return conn, nil
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, err
+	}
+}
+
+// lookup returns the cached addresses of host, resolving them again if they
+// are older than the ttl.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Since(entry.resolved) < c.ttl {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses found for %q", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsCacheEntry{addrs: addrs, resolved: time.Now()}
+	c.mu.Unlock()
+	return addrs, nil
+}
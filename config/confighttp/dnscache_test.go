@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubHostResolver struct {
+	addrs []string
+	err   error
+	calls int
+}
+
+func (s *stubHostResolver) LookupHost(_ context.Context, _ string) ([]string, error) {
+	s.calls++
+	return s.addrs, s.err
+}
+
+func TestDNSCache(t *testing.T) {
+	resolver := &stubHostResolver{addrs: []string{"192.0.2.1", "192.0.2.2"}}
+	var dialed []string
+	dial := func(_ context.Context, _, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		if address == "192.0.2.1:4318" {
+			return nil, errors.New("connection refused")
+		}
+		return nil, nil
+	}
+	cache := newDNSCache(resolver.LookupHost, time.Hour)
+	dialContext := cache.dialContext(dial)
+
+	for i := 0; i < 2; i++ {
+		_, err := dialContext(context.Background(), "tcp", "collector.example.com:4318")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, resolver.calls)
+	// Each address is tried in order until one connects.
+	assert.Equal(t, []string{"192.0.2.1:4318", "192.0.2.2:4318", "192.0.2.1:4318", "192.0.2.2:4318"}, dialed)
+
+	// The IP addresses are not resolved.
+	dialed = nil
+	_, err := dialContext(context.Background(), "tcp", "192.0.2.3:4318")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.3:4318"}, dialed)
+	assert.Equal(t, 1, resolver.calls)
+}
+
+func TestDNSCacheExpiry(t *testing.T) {
+	resolver := &stubHostResolver{addrs: []string{"192.0.2.1"}}
+	cache := newDNSCache(resolver.LookupHost, time.Nanosecond)
+
+	addrs, err := cache.lookup(context.Background(), "collector.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1"}, addrs)
+
+	resolver.addrs = []string{"192.0.2.2"}
+	time.Sleep(time.Millisecond)
+	addrs, err = cache.lookup(context.Background(), "collector.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.2"}, addrs)
+
+	// Failed lookups are not cached.
+	resolver.addrs = nil
+	resolver.err = errors.New("lookup failed")
+	time.Sleep(time.Millisecond)
+	_, err = cache.lookup(context.Background(), "collector.example.com")
+	assert.EqualError(t, err, "lookup failed")
+	resolver.err = nil
+	_, err = cache.lookup(context.Background(), "collector.example.com")
+	assert.EqualError(t, err, `no addresses found for "collector.example.com"`)
+	assert.Equal(t, 4, resolver.calls)
+}
+
+func TestHttpClientDNSCacheTTL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	hcs := &HTTPClientSettings{
+		Endpoint:    "http://localhost:" + serverURL.Port(),
+		DNSCacheTTL: time.Minute,
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Get(hcs.Endpoint)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
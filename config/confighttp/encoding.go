@@ -0,0 +1,84 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+)
+
+// The encodings of the OTLP requests, see HTTPClientSettings.Encoding.
+const (
+	EncodingProto = "proto"
+	EncodingJSON  = "json"
+)
+
+// encodingContentTypes are the Content-Type headers of the requests by encoding.
+var encodingContentTypes = map[string]string{
+	EncodingProto: "application/x-protobuf",
+	EncodingJSON:  "application/json",
+}
+
+// jsonMarshaler marshals the OTLP messages as the OTLP receiver expects them:
+// the gogoproto-compatible marshaler encodes the trace and span ids as the OTLP
+// specification defines, see JSONPb in the OTLP receiver.
+var jsonMarshaler = &jsonpb.Marshaler{OrigName: true}
+
+// validateEncoding checks that the encoding is supported and consistent with
+// the media type of ContentType.
+func (hcs *HTTPClientSettings) validateEncoding() error {
+	if hcs.Encoding == "" {
+		return nil
+	}
+	contentType, ok := encodingContentTypes[hcs.Encoding]
+	if !ok {
+		return fmt.Errorf("unsupported encoding %q, must be %q or %q", hcs.Encoding, EncodingProto, EncodingJSON)
+	}
+	if hcs.ContentType == "" {
+		return nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(hcs.ContentType); err == nil && mediaType != contentType {
+		return fmt.Errorf("content_type %q does not match the %s encoding", hcs.ContentType, hcs.Encoding)
+	}
+	return nil
+}
+
+// contentType returns the Content-Type header set on the requests, from
+// ContentType or else from Encoding, or empty if none is set.
+func (hcs *HTTPClientSettings) contentType() string {
+	if hcs.ContentType != "" {
+		return hcs.ContentType
+	}
+	return encodingContentTypes[hcs.Encoding]
+}
+
+// MarshalOTLP returns the body of the requests sending msg, an OTLP export
+// request, with the Encoding of the settings: JSON for EncodingJSON, else
+// binary protobuf. The body is compressed by the client when Compression is
+// set, like the other bodies.
+func (hcs *HTTPClientSettings) MarshalOTLP(msg proto.Message) ([]byte, error) {
+	if hcs.Encoding != EncodingJSON {
+		return proto.Marshal(msg)
+	}
+	var buf bytes.Buffer
+	if err := jsonMarshaler.Marshal(&buf, msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	collectortrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/collector/trace/v1"
+	otlptrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/trace/v1"
+)
+
+func TestHttpClientEncodingValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings HTTPClientSettings
+		wantErr  string
+	}{
+		{name: "json", settings: HTTPClientSettings{Encoding: EncodingJSON}},
+		{name: "proto", settings: HTTPClientSettings{Encoding: EncodingProto}},
+		{
+			name:     "json_content_type",
+			settings: HTTPClientSettings{Encoding: EncodingJSON, ContentType: "application/json; charset=utf-8"},
+		},
+		{
+			name:     "unsupported",
+			settings: HTTPClientSettings{Encoding: "xml"},
+			wantErr:  `unsupported encoding "xml", must be "proto" or "json"`,
+		},
+		{
+			name:     "mismatch",
+			settings: HTTPClientSettings{Encoding: EncodingJSON, ContentType: "application/x-protobuf"},
+			wantErr:  `content_type "application/x-protobuf" does not match the json encoding`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.settings.Endpoint = "http://localhost:4318"
+			err := tt.settings.Validate()
+			_, clientErr := tt.settings.ToClient()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.NoError(t, clientErr)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			assert.EqualError(t, clientErr, tt.wantErr)
+		})
+	}
+}
+
+func TestHttpClientJSONEncoding(t *testing.T) {
+	var gotContentType, gotEncoding string
+	got := &collectortrace.ExportTraceServiceRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		gotEncoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, jsonpb.Unmarshal(zr, got))
+	}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{Endpoint: server.URL, Encoding: EncodingJSON, Compression: "gzip"}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	req := &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{{
+			InstrumentationLibrarySpans: []*otlptrace.InstrumentationLibrarySpans{{
+				Spans: []*otlptrace.Span{{Name: "span", TraceId: []byte{1, 2, 3, 4}}},
+			}},
+		}},
+	}
+	body, err := hcs.MarshalOTLP(req)
+	require.NoError(t, err)
+	resp, err := client.Post(server.URL, "", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, "application/json", gotContentType)
+	assert.Equal(t, "gzip", gotEncoding)
+	assert.True(t, proto.Equal(req, got))
+}
+
+func TestHttpClientMarshalOTLPProto(t *testing.T) {
+	hcs := &HTTPClientSettings{Endpoint: "http://localhost:4318"}
+	req := &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{{}},
+	}
+	body, err := hcs.MarshalOTLP(req)
+	require.NoError(t, err)
+	got := &collectortrace.ExportTraceServiceRequest{}
+	require.NoError(t, proto.Unmarshal(body, got))
+	assert.True(t, proto.Equal(req, got))
+}
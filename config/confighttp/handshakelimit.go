@@ -0,0 +1,140 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// tlsHandshakeTimeout is the maximum duration of the handshakes of the
+// connections accepted by handshakeLimitListener, so that the slow clients do
+// not hold the handshake slots.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// errListenerClosed is returned by Accept once the listener is closed, with the
+// message of the error of the closed net.Listener.
+var errListenerClosed = errors.New("use of closed network connection")
+
+// handshakeLimitListener limits the number of TLS handshakes in progress on the
+// connections accepted by a TLS listener: the handshakes are completed in the
+// background, at most limit at a time, and Accept returns the connections
+// handshaked. The connections waiting for a slot longer than queueTimeout, if
+// positive, are closed, so that the clients back off and reconnect later.
+type handshakeLimitListener struct {
+	net.Listener
+	slots        chan struct{}
+	queueTimeout time.Duration
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newHandshakeLimitListener(listener net.Listener, limit int, queueTimeout time.Duration) *handshakeLimitListener {
+	l := &handshakeLimitListener{
+		Listener:     listener,
+		slots:        make(chan struct{}, limit),
+		queueTimeout: queueTimeout,
+		conns:        make(chan net.Conn),
+		errs:         make(chan error),
+		done:         make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *handshakeLimitListener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			// http.Server retries after the temporary errors.
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go l.handshake(c)
+	}
+}
+
+// handshake completes the handshake of c once a slot is available and passes
+// the connection to Accept, or closes it.
+func (l *handshakeLimitListener) handshake(c net.Conn) {
+	tc, ok := c.(*tls.Conn)
+	if !ok {
+		l.deliver(c)
+		return
+	}
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-timeout:
+		c.Close()
+		return
+	case <-l.done:
+		c.Close()
+		return
+	}
+	_ = tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	err := tc.Handshake()
+	<-l.slots
+	if err != nil {
+		c.Close()
+		return
+	}
+	_ = tc.SetDeadline(time.Time{})
+	l.deliver(c)
+}
+
+func (l *handshakeLimitListener) deliver(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+func (l *handshakeLimitListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *handshakeLimitListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
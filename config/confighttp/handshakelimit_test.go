@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestMaxConcurrentTLSHandshakes(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	hss := &HTTPServerSettings{
+		Endpoint: "localhost:0",
+		TLSSetting: &configtls.TLSServerSetting{
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+		},
+		MaxConcurrentTLSHandshakes: 1,
+		TLSHandshakeQueueTimeout:   100 * time.Millisecond,
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	_, ok := ln.(*handshakeLimitListener)
+	require.True(t, ok, "Unexpected listener %T", ln)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connections are still TLS connections for http.Server.
+		assert.NotNil(t, r.TLS)
+	}))
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	caPEM, err := ioutil.ReadFile(certs.caFile)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	require.True(t, rootCAs.AppendCertsFromPEM(caPEM))
+	client := &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{RootCAs: rootCAs},
+		},
+		Timeout: 5 * time.Second,
+	}
+	get := func() error {
+		resp, errGet := client.Get("https://" + ln.Addr().String())
+		if errGet != nil {
+			return errGet
+		}
+		return resp.Body.Close()
+	}
+	require.NoError(t, get())
+
+	// The stalled handshake holds the only slot, the connections queued longer
+	// than the queue timeout are closed.
+	stalled, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Error(t, get())
+
+	// The slot is released once the stalled handshake fails.
+	require.NoError(t, stalled.Close())
+	assert.Eventually(t, func() bool {
+		return get() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHandshakeLimitListenerClose(t *testing.T) {
+	tcpLn, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	ln := newHandshakeLimitListener(tcpLn, 1, 0)
+	accepted := make(chan error, 1)
+	go func() {
+		_, errAccept := ln.Accept()
+		accepted <- errAccept
+	}()
+	require.NoError(t, ln.Close())
+	select {
+	case err = <-accepted:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Accept not stopped by Close")
+	}
+}
+
+func TestMaxConcurrentTLSHandshakesValidate(t *testing.T) {
+	hss := &HTTPServerSettings{MaxConcurrentTLSHandshakes: -1}
+	assert.EqualError(t, hss.Validate(), "max_concurrent_tls_handshakes must be non-negative, got -1")
+}
@@ -0,0 +1,88 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// headerReference matches the references of the header values, e.g.
+// "${env:OTLP_TOKEN}", with the scheme and the name of the referenced value.
+// Only the schemes of headerResolvers are matched, the values like
+// "${vault:token}" are sent unchanged.
+var headerReference = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+// headerResolvers resolve the references of the header values by scheme.
+var headerResolvers = map[string]func(name string) (string, error){
+	// "env" references an environment variable.
+	"env": func(name string) (string, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return value, nil
+	},
+	// "file" references the content of a file, e.g. a mounted secret, without
+	// the trailing newline.
+	"file": func(name string) (string, error) {
+		content, err := ioutil.ReadFile(filepath.Clean(name))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	},
+}
+
+// isDynamicHeaderValue returns whether the header value has references.
+func isDynamicHeaderValue(value string) bool {
+	return headerReference.MatchString(value)
+}
+
+// validateHeaderValue checks the references of the header value.
+func validateHeaderValue(header, value string) error {
+	for _, match := range headerReference.FindAllStringSubmatch(value, -1) {
+		if match[2] == "" {
+			return fmt.Errorf("invalid header %q: empty %s reference", header, match[1])
+		}
+	}
+	return nil
+}
+
+// resolveHeaderValue returns the header value with its references replaced by
+// the referenced values. The errors name the references but never include the
+// resolved values, that may be secrets.
+func resolveHeaderValue(header, value string) (string, error) {
+	var err error
+	resolved := headerReference.ReplaceAllStringFunc(value, func(ref string) string {
+		match := headerReference.FindStringSubmatch(ref)
+		v, rerr := headerResolvers[match[1]](match[2])
+		if rerr != nil && err == nil {
+			err = fmt.Errorf("failed to resolve header %q: %w", header, rerr)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(resolved, "\r\n") {
+		return "", fmt.Errorf("failed to resolve header %q: the value has a newline", header)
+	}
+	return resolved, nil
+}
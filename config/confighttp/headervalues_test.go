@@ -0,0 +1,120 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveHeaderValue(t *testing.T) {
+	require.NoError(t, os.Setenv("CONFIGHTTP_TEST_TOKEN", "secret"))
+	defer os.Unsetenv("CONFIGHTTP_TEST_TOKEN")
+	dir, err := ioutil.TempDir("", "confighttp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(file, []byte("from-file\n"), 0600))
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "literal", want: "literal"},
+		{value: "Bearer ${env:CONFIGHTTP_TEST_TOKEN}", want: "Bearer secret"},
+		{value: "${file:" + file + "}", want: "from-file"},
+		{value: "${env:CONFIGHTTP_TEST_MISSING}", wantErr: `failed to resolve header "X-Token": environment variable "CONFIGHTTP_TEST_MISSING" is not set`},
+	}
+	for _, tt := range tests {
+		got, err := resolveHeaderValue("X-Token", tt.value)
+		if tt.wantErr != "" {
+			assert.EqualError(t, err, tt.wantErr)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestValidateHeaderValue(t *testing.T) {
+	assert.NoError(t, validateHeaderValue("X-Token", "${env:TOKEN}"))
+	assert.NoError(t, validateHeaderValue("X-Token", "$literal"))
+	assert.NoError(t, validateHeaderValue("X-Token", "${vault:token}"))
+	assert.EqualError(t, validateHeaderValue("X-Token", "${env:}"), `invalid header "X-Token": empty env reference`)
+
+	hcs := &HTTPClientSettings{Endpoint: "http://localhost:4318", Headers: map[string]string{"X-Token": "${env:}"}}
+	assert.Error(t, hcs.Validate())
+	_, err := hcs.ToClient()
+	assert.Error(t, err)
+}
+
+func TestHttpClientUnknownReferenceScheme(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	// The values with other schemes are literal values.
+	hcs := &HTTPClientSettings{Endpoint: server.URL, Headers: map[string]string{"X-Token": "${vault:token}"}}
+	require.NoError(t, hcs.Validate())
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "${vault:token}", got.Get("X-Token"))
+}
+
+func TestHttpClientDynamicHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint: server.URL,
+		Headers: map[string]string{
+			"Authorization": "Bearer ${env:CONFIGHTTP_TEST_ROTATED}",
+			"X-Literal":     "value",
+		},
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+
+	// The token is read on each request, the rotated token is used.
+	for _, token := range []string{"first", "second"} {
+		require.NoError(t, os.Setenv("CONFIGHTTP_TEST_ROTATED", token))
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "Bearer "+token, got.Get("Authorization"))
+		assert.Equal(t, "value", got.Get("X-Literal"))
+	}
+
+	require.NoError(t, os.Unsetenv("CONFIGHTTP_TEST_ROTATED"))
+	_, err = client.Get(server.URL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `environment variable "CONFIGHTTP_TEST_ROTATED" is not set`)
+}
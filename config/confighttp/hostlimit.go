@@ -0,0 +1,94 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// hostLimitRoundTripper limits the number of requests in flight to each host,
+// the requests over the limit wait for a slot until their context is done. A
+// request is in flight until its response body is read or closed.
+type hostLimitRoundTripper struct {
+	transport http.RoundTripper
+	limit     int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newHostLimitRoundTripper(transport http.RoundTripper, limit int) *hostLimitRoundTripper {
+	return &hostLimitRoundTripper{
+		transport: transport,
+		limit:     limit,
+		slots:     map[string]chan struct{}{},
+	}
+}
+
+// hostSlots returns the semaphore of the host, created on its first request.
+func (rt *hostLimitRoundTripper) hostSlots(host string) chan struct{} {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	slots, ok := rt.slots[host]
+	if !ok {
+		slots = make(chan struct{}, rt.limit)
+		rt.slots[host] = slots
+	}
+	return slots
+}
+
+func (rt *hostLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := rt.hostSlots(req.URL.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, req.Context().Err()
+	}
+	release := func() { <-slots }
+	resp, err := rt.transport.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		release()
+		return resp, err
+	}
+	resp.Body = &releaseOnEOFBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnEOFBody calls release once, when the body is read until its end,
+// fails or is closed.
+type releaseOnEOFBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseOnEOFBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releaseOnEOFBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostLimitRoundTripper(t *testing.T) {
+	var inflight, maxInflight int32
+	release := make(chan struct{})
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		if req.URL.Host == "a" {
+			<-release
+		}
+		atomic.AddInt32(&inflight, -1)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	})
+	rt := newHostLimitRoundTripper(base, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := rt.RoundTrip(httptest.NewRequest("GET", "http://a/", nil))
+			if assert.NoError(t, err) {
+				_, _ = ioutil.ReadAll(resp.Body)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&inflight))
+
+	// The other hosts have their own slots.
+	resp, err := rt.RoundTrip(httptest.NewRequest("GET", "http://b/", nil))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 3, atomic.LoadInt32(&maxInflight))
+}
+
+func TestHostLimitRoundTripperContext(t *testing.T) {
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	})
+	rt := newHostLimitRoundTripper(base, 1)
+
+	// The slot is held until the body is closed.
+	resp, err := rt.RoundTrip(httptest.NewRequest("GET", "http://a/", nil))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// The body of the request not sent is closed.
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	_, err = rt.RoundTrip(httptest.NewRequest("POST", "http://a/", body).WithContext(ctx))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, body.closed)
+
+	require.NoError(t, resp.Body.Close())
+	resp, err = rt.RoundTrip(httptest.NewRequest("GET", "http://a/", nil))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestHttpClientMaxConcurrentRequestsPerHost(t *testing.T) {
+	hcs := &HTTPClientSettings{Endpoint: "http://localhost:4318", MaxConcurrentRequestsPerHost: -1}
+	assert.EqualError(t, hcs.Validate(), "max_concurrent_requests_per_host must be non-negative, got -1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	hcs = &HTTPClientSettings{Endpoint: server.URL, MaxConcurrentRequestsPerHost: 1}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// HTTP3RoundTripperFactory returns the http.RoundTripper sending the requests
+// over HTTP/3 (QUIC) with the given TLS config, built from the TLS settings of
+// the client.
+type HTTP3RoundTripperFactory func(tlsCfg *tls.Config) (http.RoundTripper, error)
+
+var (
+	http3Mu      sync.Mutex
+	http3Factory HTTP3RoundTripperFactory
+)
+
+// RegisterHTTP3RoundTripper registers the HTTP/3 implementation used by the
+// clients with HTTPClientSettings.HTTP3 set. The builds with the http3 tag
+// register the quic-go one at startup, the other builds can register their own.
+func RegisterHTTP3RoundTripper(factory HTTP3RoundTripperFactory) {
+	http3Mu.Lock()
+	defer http3Mu.Unlock()
+	http3Factory = factory
+}
+
+var errHTTP3NotRegistered = errors.New("http3 requires an HTTP/3 implementation, build with the http3 tag or register one with RegisterHTTP3RoundTripper")
+
+// http3RoundTripper returns the HTTP/3 transport of the settings.
+func (hcs *HTTPClientSettings) http3RoundTripper(tlsCfg *tls.Config) (http.RoundTripper, error) {
+	http3Mu.Lock()
+	factory := http3Factory
+	http3Mu.Unlock()
+	if factory == nil {
+		return nil, errHTTP3NotRegistered
+	}
+	// HTTP/3 is always over TLS, the endpoints without TLS settings are
+	// verified with the system roots.
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	}
+	return factory(tlsCfg)
+}
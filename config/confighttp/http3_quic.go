@@ -0,0 +1,30 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build http3
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go/http3"
+)
+
+func init() {
+	RegisterHTTP3RoundTripper(func(tlsCfg *tls.Config) (http.RoundTripper, error) {
+		return &http3.RoundTripper{TLSClientConfig: tlsCfg}, nil
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build http3
+
+package confighttp
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestHttpClientHTTP3QUIC(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	serverTLSCfg, err := (&configtls.TLSServerSetting{
+		TLSSetting: configtls.TLSSetting{
+			CertFile: certs.serverCertFile,
+			KeyFile:  certs.serverKeyFile,
+		},
+	}).LoadTLSConfig()
+	require.NoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http3.Server{Server: &http.Server{
+		TLSConfig: serverTLSCfg,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Proto))
+		}),
+	}}
+	go func() {
+		_ = server.Serve(conn)
+	}()
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint: "https://" + conn.LocalAddr().String(),
+		HTTP3:    true,
+		TLSSetting: configtls.TLSClientSetting{
+			TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+		},
+	}
+	require.NoError(t, hcs.Validate())
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Get(hcs.Endpoint)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/3", string(body))
+}
@@ -0,0 +1,85 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestHttpClientHTTP3(t *testing.T) {
+	// The builds with the http3 tag register an implementation at startup.
+	http3Mu.Lock()
+	registered := http3Factory
+	http3Mu.Unlock()
+	defer RegisterHTTP3RoundTripper(registered)
+	RegisterHTTP3RoundTripper(nil)
+
+	hcs := &HTTPClientSettings{
+		Endpoint: "https://localhost:4318",
+		HTTP3:    true,
+		Headers:  map[string]string{"X-Tenant": "a"},
+		TLSSetting: configtls.TLSClientSetting{
+			ServerName: "collector.example.com",
+		},
+	}
+	require.NoError(t, hcs.Validate())
+	_, err := hcs.ToClient()
+	assert.Equal(t, errHTTP3NotRegistered, err)
+
+	var gotTLSCfg *tls.Config
+	var gotReq *http.Request
+	RegisterHTTP3RoundTripper(func(tlsCfg *tls.Config) (http.RoundTripper, error) {
+		gotTLSCfg = tlsCfg
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			gotReq = req
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}, nil
+		}), nil
+	})
+	// The base transport is replaced.
+	client, err := hcs.ToClientWithBase(http.DefaultTransport)
+	require.NoError(t, err)
+	require.NotNil(t, gotTLSCfg)
+	assert.Equal(t, "collector.example.com", gotTLSCfg.ServerName)
+
+	resp, err := client.Get(hcs.Endpoint)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.NotNil(t, gotReq)
+	assert.Equal(t, "a", gotReq.Header.Get("X-Tenant"))
+
+	_, err = hcs.ToTransport()
+	assert.Error(t, err)
+}
+
+func TestHttpClientHTTP3Validate(t *testing.T) {
+	hcs := &HTTPClientSettings{Endpoint: "http://localhost:4318", HTTP3: true}
+	assert.EqualError(t, hcs.Validate(), `invalid endpoint "http://localhost:4318": http3 requires an https endpoint`)
+
+	hcs = &HTTPClientSettings{Endpoint: "https://localhost:4318", HTTP3: true, ForceHTTP1: true}
+	assert.EqualError(t, hcs.Validate(), "http3 cannot be used with force_http1")
+}
@@ -0,0 +1,341 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/cors"
+
+	"go.opentelemetry.io/collector/internal/middleware"
+)
+
+// Names of the middlewares built by HTTPServerSettings.ToServer, see WithMiddlewares.
+const (
+	MiddlewareWriteDeadline      = "write_deadline"
+	MiddlewareResponseHeaders    = "response_headers"
+	MiddlewareRealIP             = "real_ip"
+	MiddlewareContextLogger      = "context_logger"
+	MiddlewareRequestLogging     = "request_logging"
+	MiddlewareCompressResponses  = "compress_responses"
+	MiddlewareResponseSize       = "response_size"
+	MiddlewareHeaderLimits       = "header_limits"
+	MiddlewareIdempotency        = "idempotency"
+	MiddlewareRetryAfter         = "retry_after"
+	MiddlewareInflightLimit      = "inflight_limit"
+	MiddlewareConcurrencyLimit   = "adaptive_concurrency_limit"
+	MiddlewareHandlerTimeout     = "handler_timeout"
+	MiddlewareHeaderRenames      = "header_renames"
+	MiddlewareRequireCompression = "require_compression"
+	MiddlewareDigestValidation   = "digest_validation"
+	MiddlewareDecompression      = "decompression"
+	MiddlewareBodyCapture        = "body_capture"
+	MiddlewareCORS               = "cors"
+	MiddlewarePathFilter         = "path_filter"
+	MiddlewareContentTypeFilter  = "content_type_filter"
+)
+
+// knownMiddlewares are the names of the middlewares built by
+// HTTPServerSettings.ToServer, in the order they handle the requests.
+var knownMiddlewares = []string{
+	MiddlewareWriteDeadline,
+	MiddlewareResponseHeaders,
+	MiddlewareRealIP,
+	MiddlewareContextLogger,
+	MiddlewareRequestLogging,
+	MiddlewareCompressResponses,
+	MiddlewareResponseSize,
+	MiddlewareHeaderLimits,
+	MiddlewareIdempotency,
+	MiddlewareRetryAfter,
+	MiddlewareInflightLimit,
+	MiddlewareConcurrencyLimit,
+	MiddlewareHandlerTimeout,
+	MiddlewareHeaderRenames,
+	MiddlewareRequireCompression,
+	MiddlewareDigestValidation,
+	MiddlewareDecompression,
+	MiddlewareBodyCapture,
+	MiddlewareCORS,
+	MiddlewarePathFilter,
+	MiddlewareContentTypeFilter,
+}
+
+// Middleware is a named wrapper of the handler of the server.
+type Middleware struct {
+	// Name identifies the middleware, one of the Middleware* constants for the
+	// middlewares built by HTTPServerSettings.ToServer.
+	Name string
+	// Wrap returns the handler calling next.
+	Wrap func(next http.Handler) http.Handler
+}
+
+// WithMiddlewares customizes the middlewares of the server: customize is called
+// with the middlewares enabled by the settings and returns the middlewares
+// used, that may be reordered, replaced, removed or added. The middlewares are
+// ordered as they handle the requests, the first one receives the requests
+// before the others, e.g. to authenticate the requests before the decompression
+// insert the authentication before the MiddlewareDecompression middleware.
+func WithMiddlewares(customize func(defaults []Middleware) []Middleware) ToServerOption {
+	return func(opts *toServerOptions) {
+		opts.customizeMiddlewares = customize
+	}
+}
+
+// defaultMiddlewares returns the middlewares enabled by the settings, in the
+// order they handle the requests.
+func (hss *HTTPServerSettings) defaultMiddlewares(serverOpts *toServerOptions) []Middleware {
+	var middlewares []Middleware
+	add := func(name string, wrap func(next http.Handler) http.Handler) {
+		middlewares = append(middlewares, Middleware{Name: name, Wrap: wrap})
+	}
+
+	// The write deadline covers the responses written by all the middlewares.
+	if hss.SlidingWriteTimeout > 0 {
+		add(MiddlewareWriteDeadline, func(next http.Handler) http.Handler {
+			return middleware.SlidingWriteDeadline(next, hss.SlidingWriteTimeout)
+		})
+	}
+	if len(hss.ResponseHeaders) > 0 {
+		add(MiddlewareResponseHeaders, func(next http.Handler) http.Handler {
+			return middleware.ResponseHeaders(next, hss.ResponseHeaders)
+		})
+	}
+	// The client address is set before it is logged. The invalid proxies are
+	// reported by Validate.
+	if trusted, err := parseNetworks("trusted_proxies", hss.TrustedProxies); err == nil && len(trusted) > 0 {
+		add(MiddlewareRealIP, func(next http.Handler) http.Handler {
+			return middleware.RealIP(next, trusted)
+		})
+	}
+	if cl := hss.ContextLogger; cl != nil {
+		add(MiddlewareContextLogger, func(next http.Handler) http.Handler {
+			return middleware.ContextLogger(
+				next,
+				serverOpts.logger,
+				middleware.WithRequestIDHeader(cl.RequestIDHeader),
+				middleware.WithTenantHeader(cl.TenantHeader),
+			)
+		})
+	}
+	if rl := hss.RequestLogging; rl != nil {
+		add(MiddlewareRequestLogging, func(next http.Handler) http.Handler {
+			return middleware.RequestLogger(next, serverOpts.logger, rl.options(serverOpts)...)
+		})
+	}
+	// The responses are compressed once complete, so that their size is the
+	// size written by the handler.
+	if hss.CompressResponses {
+		add(MiddlewareCompressResponses, middleware.ResponseCompressor)
+	}
+	// The size of the responses is recorded even without limit, and under the
+	// request logging so that the truncated size is logged.
+	add(MiddlewareResponseSize, func(next http.Handler) http.Handler {
+		return middleware.ResponseSizeLimiter(next, hss.MaxResponseSize, serverOpts.logger)
+	})
+	if hss.MaxRequestHeaders > 0 || hss.MaxRequestHeaderNameLength > 0 || hss.MaxRequestHeaderValueLength > 0 {
+		add(MiddlewareHeaderLimits, func(next http.Handler) http.Handler {
+			return middleware.HeaderLimiter(
+				next,
+				hss.MaxRequestHeaders,
+				hss.MaxRequestHeaderNameLength,
+				hss.MaxRequestHeaderValueLength,
+				middleware.WithHeaderLimitsErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	// The cached responses are replayed before the limits, since they do not
+	// call the handler.
+	if idem := hss.Idempotency; idem != nil {
+		add(MiddlewareIdempotency, func(next http.Handler) http.Handler {
+			header, ttl, maxEntries := idem.Header, idem.TTL, idem.MaxEntries
+			if header == "" {
+				header = defaultIdempotencyHeader
+			}
+			if ttl <= 0 {
+				ttl = defaultIdempotencyTTL
+			}
+			if maxEntries <= 0 {
+				maxEntries = defaultIdempotencyMaxEntries
+			}
+			opts := []middleware.IdempotencyOption{middleware.WithIdempotencyErrorHandler(serverOpts.errorHandler)}
+			if idem.MaxResponseSize > 0 {
+				opts = append(opts, middleware.WithIdempotencyMaxResponseSize(idem.MaxResponseSize))
+			}
+			return middleware.Idempotency(next, header, ttl, maxEntries, opts...)
+		})
+	}
+	if hss.RetryAfter > 0 {
+		add(MiddlewareRetryAfter, func(next http.Handler) http.Handler {
+			return middleware.RetryAfter(next, hss.RetryAfter)
+		})
+	}
+	if hss.MaxConcurrentRequests > 0 {
+		add(MiddlewareInflightLimit, func(next http.Handler) http.Handler {
+			return middleware.InflightLimiter(
+				next,
+				hss.MaxConcurrentRequests,
+				middleware.WithInflightLimiterErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	if acl := hss.AdaptiveConcurrencyLimit; acl != nil {
+		add(MiddlewareConcurrencyLimit, func(next http.Handler) http.Handler {
+			return middleware.AdaptiveConcurrencyLimiter(
+				next,
+				middleware.WithLimits(acl.InitialLimit, acl.MinLimit, acl.MaxLimit),
+				middleware.WithLimiterErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	if hss.HandlerTimeout > 0 {
+		add(MiddlewareHandlerTimeout, func(next http.Handler) http.Handler {
+			return middleware.HandlerTimeout(
+				next,
+				hss.HandlerTimeout,
+				middleware.WithTimeoutErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	// The headers are renamed before the decompression and the CORS handling.
+	if len(hss.HeaderRenames) > 0 {
+		add(MiddlewareHeaderRenames, func(next http.Handler) http.Handler {
+			return middleware.HeaderRenamer(next, hss.HeaderRenames)
+		})
+	}
+	if hss.RequireCompressionAbove > 0 {
+		add(MiddlewareRequireCompression, func(next http.Handler) http.Handler {
+			return middleware.RequireCompression(
+				next,
+				int64(hss.RequireCompressionAbove),
+				middleware.WithRequireCompressionErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	digestValidation := func(next http.Handler) http.Handler {
+		return middleware.DigestValidator(
+			next,
+			middleware.WithDigestErrorHandler(serverOpts.errorHandler),
+		)
+	}
+	// The digest is checked on the body as received, or as decompressed.
+	dv := hss.DigestValidation
+	if dv != nil && !dv.Decompressed {
+		add(MiddlewareDigestValidation, digestValidation)
+	}
+	add(MiddlewareDecompression, func(next http.Handler) http.Handler {
+		decompressorOpts := []middleware.DecompressorOption{
+			middleware.WithErrorHandler(serverOpts.errorHandler),
+			middleware.WithReadAheadSize(hss.DecompressionReadAheadSize),
+			middleware.WithMaxConcurrentDecompressions(hss.MaxConcurrentDecompressions),
+			middleware.WithDecompressionLogger(serverOpts.logger),
+			middleware.WithSniffCompression(hss.SniffCompression),
+			middleware.WithEncodings(hss.AllowedEncodings, hss.DeniedEncodings),
+		}
+		if serverOpts.meter != nil {
+			decompressorOpts = append(decompressorOpts, middleware.WithDecompressionMetrics(serverOpts.meter))
+		}
+		if hss.MaxUncompressedLengthHint > 0 {
+			decompressorOpts = append(decompressorOpts, middleware.WithUncompressedLengthHint(hss.MaxUncompressedLengthHint))
+		}
+		if hss.LenientGzip {
+			decompressorOpts = append(decompressorOpts, middleware.WithLenientGzip(serverOpts.logger))
+		}
+		return middleware.HTTPContentDecompressor(next, decompressorOpts...)
+	})
+	if dv != nil && dv.Decompressed {
+		add(MiddlewareDigestValidation, digestValidation)
+	}
+	// The bodies are captured as decompressed.
+	if bc := hss.BodyCapture; bc != nil {
+		add(MiddlewareBodyCapture, func(next http.Handler) http.Handler {
+			return middleware.BodyCapture(
+				next,
+				bc.Directory,
+				middleware.WithCaptureMaxBodySize(int64(bc.MaxBodySize)),
+				middleware.WithCaptureMaxFiles(bc.MaxFiles),
+				middleware.WithCaptureRate(bc.MaxPerMinute, time.Minute),
+				middleware.WithRedactedHeaders(bc.RedactedHeaders),
+				middleware.WithCaptureLogger(serverOpts.logger),
+			)
+		})
+	}
+	if len(hss.CorsOrigins) > 0 || hss.CorsAllowOriginFunc != nil {
+		add(MiddlewareCORS, func(next http.Handler) http.Handler {
+			co := cors.Options{
+				AllowedOrigins:     hss.CorsOrigins,
+				AllowOriginFunc:    hss.CorsAllowOriginFunc,
+				ExposedHeaders:     hss.CorsExposedHeaders,
+				AllowCredentials:   hss.CorsAllowCredentials,
+				OptionsPassthrough: hss.CorsOptionsPassthrough,
+			}
+			return cors.New(co).Handler(next)
+		})
+	}
+	// The paths and the content types are filtered under the CORS handling, so
+	// that the rejections have the CORS headers.
+	if len(serverOpts.paths) > 0 {
+		add(MiddlewarePathFilter, func(next http.Handler) http.Handler {
+			return middleware.PathFilter(
+				next,
+				serverOpts.paths,
+				middleware.WithPathFilterErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	contentTypes := hss.AllowedContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = serverOpts.contentTypes
+	}
+	if len(contentTypes) > 0 {
+		add(MiddlewareContentTypeFilter, func(next http.Handler) http.Handler {
+			return middleware.ContentTypeFilter(
+				next,
+				contentTypes,
+				middleware.WithContentTypeFilterErrorHandler(serverOpts.errorHandler),
+			)
+		})
+	}
+	return middlewares
+}
+
+// wrapMiddleware returns the handler of the middleware calling next, bypassed
+// by the requests of the paths exempted from the middleware.
+func (hss *HTTPServerSettings) wrapMiddleware(m Middleware, next http.Handler) http.Handler {
+	return middleware.SkipPaths(m.Wrap(next), next, hss.MiddlewareExemptions[m.Name])
+}
+
+// validateMiddlewareExemptions checks that the exempted middlewares are known
+// and that their path prefixes are absolute paths.
+func (hss *HTTPServerSettings) validateMiddlewareExemptions() error {
+	for name, prefixes := range hss.MiddlewareExemptions {
+		known := false
+		for _, n := range knownMiddlewares {
+			known = known || n == name
+		}
+		if !known {
+			return fmt.Errorf("invalid middleware_exemptions: unknown middleware %q", name)
+		}
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return fmt.Errorf("invalid middleware_exemptions of %q: path prefix %q must start with /", name, prefix)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"go.opentelemetry.io/collector/internal/middleware"
+)
+
+func middlewareNames(middlewares []Middleware) []string {
+	var names []string
+	for _, m := range middlewares {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestDefaultMiddlewares(t *testing.T) {
+	tests := []struct {
+		name string
+		hss  *HTTPServerSettings
+		opts *toServerOptions
+		want []string
+	}{
+		{
+			name: "default",
+			hss:  &HTTPServerSettings{},
+			opts: &toServerOptions{},
+			want: []string{MiddlewareResponseSize, MiddlewareDecompression},
+		},
+		{
+			name: "all",
+			hss: &HTTPServerSettings{
+				SlidingWriteTimeout:      time.Second,
+				ResponseHeaders:          map[string]string{"X-Collector-Instance": "collector-1"},
+				TrustedProxies:           []string{"10.0.0.0/8"},
+				ContextLogger:            &ContextLoggerSettings{},
+				RequestLogging:           &RequestLoggingSettings{},
+				CompressResponses:        true,
+				MaxRequestHeaders:        100,
+				Idempotency:              &IdempotencySettings{},
+				RetryAfter:               time.Second,
+				MaxConcurrentRequests:    10,
+				AdaptiveConcurrencyLimit: &AdaptiveConcurrencyLimitSettings{},
+				HandlerTimeout:           time.Second,
+				HeaderRenames:            map[string]string{"X-Tenant": "X-Scope-OrgID"},
+				RequireCompressionAbove:  1024,
+				DigestValidation:         &DigestValidationSettings{},
+				CorsOrigins:              []string{"https://example.com"},
+				BodyCapture:              &BodyCaptureSettings{Directory: "captures"},
+			},
+			opts: &toServerOptions{
+				paths:        []string{"/v1/trace"},
+				contentTypes: []string{"application/json"},
+			},
+			want: []string{
+				MiddlewareWriteDeadline,
+				MiddlewareResponseHeaders,
+				MiddlewareRealIP,
+				MiddlewareContextLogger,
+				MiddlewareRequestLogging,
+				MiddlewareCompressResponses,
+				MiddlewareResponseSize,
+				MiddlewareHeaderLimits,
+				MiddlewareIdempotency,
+				MiddlewareRetryAfter,
+				MiddlewareInflightLimit,
+				MiddlewareConcurrencyLimit,
+				MiddlewareHandlerTimeout,
+				MiddlewareHeaderRenames,
+				MiddlewareRequireCompression,
+				MiddlewareDigestValidation,
+				MiddlewareDecompression,
+				MiddlewareBodyCapture,
+				MiddlewareCORS,
+				MiddlewarePathFilter,
+				MiddlewareContentTypeFilter,
+			},
+		},
+		{
+			name: "decompressed_digest",
+			hss: &HTTPServerSettings{
+				DigestValidation: &DigestValidationSettings{Decompressed: true},
+			},
+			opts: &toServerOptions{},
+			want: []string{MiddlewareResponseSize, MiddlewareDecompression, MiddlewareDigestValidation},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.logger = zap.NewNop()
+			assert.Equal(t, tt.want, middlewareNames(tt.hss.defaultMiddlewares(tt.opts)))
+			if tt.name == "all" {
+				assert.Equal(t, knownMiddlewares, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithMiddlewares(t *testing.T) {
+	var gotEncoding, gotBody string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		gotBody = string(body)
+	})
+	// The Content-Encoding header is seen before the decompression removes it.
+	auth := Middleware{
+		Name: "auth",
+		Wrap: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotEncoding = r.Header.Get("Content-Encoding")
+				if r.Header.Get("Authorization") == "" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+	hss := &HTTPServerSettings{CorsOrigins: []string{"https://example.com"}}
+	s := hss.ToServer(handler, WithMiddlewares(func(defaults []Middleware) []Middleware {
+		var middlewares []Middleware
+		for _, m := range defaults {
+			switch m.Name {
+			case MiddlewareDecompression:
+				middlewares = append(middlewares, auth, m)
+			case MiddlewareCORS:
+				// Removed.
+			default:
+				middlewares = append(middlewares, m)
+			}
+		}
+		return middlewares
+	}))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(buf.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Origin", "https://example.com")
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, newRequest())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := newRequest()
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", gotEncoding)
+	assert.Equal(t, "payload", gotBody)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestMiddlewareExemptions(t *testing.T) {
+	hss := &HTTPServerSettings{MiddlewareExemptions: map[string][]string{"decompresion": {"/healthz"}}}
+	assert.EqualError(t, hss.Validate(), `invalid middleware_exemptions: unknown middleware "decompresion"`)
+	hss = &HTTPServerSettings{MiddlewareExemptions: map[string][]string{MiddlewareCORS: {"healthz"}}}
+	assert.EqualError(t, hss.Validate(), `invalid middleware_exemptions of "cors": path prefix "healthz" must start with /`)
+
+	var gotEncoding string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+	})
+	hss = &HTTPServerSettings{
+		CorsOrigins: []string{"https://example.com"},
+		MiddlewareExemptions: map[string][]string{
+			MiddlewareDecompression: {"/status"},
+			MiddlewareCORS:          {"/status"},
+		},
+	}
+	require.NoError(t, hss.Validate())
+	s := hss.ToServer(handler)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	newRequest := func(path string) *http.Request {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(buf.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Origin", "https://example.com")
+		return req
+	}
+
+	// The exempted paths bypass the decompression and the CORS handling.
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, newRequest("/status/ready"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", gotEncoding)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, newRequest("/v1/traces"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, gotEncoding)
+	assert.Equal(t, "https://example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestWithDecompressionMetrics(t *testing.T) {
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	require.NoError(t, meter.Register(middleware.DecompressionMetricViews()...))
+
+	hss := &HTTPServerSettings{}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+	}), WithDecompressionMetrics(meter))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	req := httptest.NewRequest("POST", "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	rows, err := meter.RetrieveData("http.server.decompression.decompressed_bytes")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, float64(len("payload")), rows[0].Data.(*view.SumData).Value)
+}
+
+func TestIdempotencyDefaults(t *testing.T) {
+	calls := 0
+	hss := &HTTPServerSettings{Idempotency: &IdempotencySettings{}}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Idempotency-Key", "key")
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestMaxUncompressedLengthHint(t *testing.T) {
+	var gotLength int64
+	hss := &HTTPServerSettings{MaxUncompressedLengthHint: 1024}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLength = r.ContentLength
+	}))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	req := httptest.NewRequest("POST", "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set(middleware.UncompressedContentLengthHeader, "7")
+	s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.EqualValues(t, 7, gotLength)
+}
+
+func TestBodyCapture(t *testing.T) {
+	hss := &HTTPServerSettings{BodyCapture: &BodyCaptureSettings{}}
+	assert.EqualError(t, hss.Validate(), "body_capture requires a directory")
+	hss.BodyCapture = &BodyCaptureSettings{Directory: "captures", MaxFiles: -1}
+	assert.EqualError(t, hss.Validate(), "body_capture max_body_size, max_files and max_per_minute must be non-negative")
+
+	tmp, err := ioutil.TempDir("", "bodycapture")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	hss.BodyCapture = &BodyCaptureSettings{Directory: tmp, RedactedHeaders: []string{"X-Api-Key"}}
+	require.NoError(t, hss.Validate())
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	req := httptest.NewRequest("POST", "/v1/traces", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-Api-Key", "secret")
+	s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The body is captured as decompressed.
+	files, err := ioutil.ReadDir(tmp)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := ioutil.ReadFile(filepath.Join(tmp, files[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, "POST /v1/traces HTTP/1.1\r\nX-Api-Key: [REDACTED]\r\n\r\npayload", string(data))
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	hss := &HTTPServerSettings{ContextLogger: &ContextLoggerSettings{TenantHeader: "X-Scope-OrgID"}}
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger, ok := LoggerFromContext(r.Context())
+		require.True(t, ok)
+		logger.Info("consumed")
+	}), WithLogger(zap.New(core)))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(middleware.DefaultRequestIDHeader, "abc")
+	req.Header.Set("X-Scope-OrgID", "tenant-1")
+	s.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, map[string]interface{}{"request_id": "abc", "tenant": "tenant-1"}, logs.All()[0].ContextMap())
+}
@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Probe checks that the endpoint can be reached, so that a misconfigured client
+// fails at startup rather than on its first request. It resolves the host of the
+// endpoint, or its SRV records for the SRV discovery schemes, connects to it, or
+// to the socket of the "unix" endpoints, and, for HTTPS endpoints, performs the
+// TLS handshake, bounded by ctx.
+func (hcs *HTTPClientSettings) Probe(ctx context.Context) error {
+	return hcs.probe(ctx, net.DefaultResolver.LookupSRV)
+}
+
+func (hcs *HTTPClientSettings) probe(ctx context.Context, lookupSRV lookupSRVFunc) error {
+	u, err := url.Parse(hcs.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", hcs.Endpoint, err)
+	}
+	if u.Scheme == unixScheme {
+		if err = validateUnixEndpoint(hcs.Endpoint, u); err != nil {
+			return err
+		}
+		conn, errDial := hcs.dialer().DialContext(ctx, "unix", u.Path)
+		if errDial != nil {
+			return fmt.Errorf("failed to connect to %q: %w", hcs.Endpoint, errDial)
+		}
+		return conn.Close()
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: must be an URL with a scheme and a host", hcs.Endpoint)
+	}
+
+	secure := u.Scheme == "https" || u.Scheme == srvSecureScheme
+	addr := u.Host
+	switch {
+	case isSRVEndpoint(hcs.Endpoint):
+		// A single target is enough to check the resolution of the name.
+		_, addrs, errLookup := lookupSRV(ctx, "", "", u.Hostname())
+		if errLookup != nil {
+			return fmt.Errorf("failed to resolve %q: %w", u.Hostname(), errLookup)
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("failed to resolve %q: no SRV records", u.Hostname())
+		}
+		addr = net.JoinHostPort(strings.TrimSuffix(addrs[0].Target, "."), strconv.Itoa(int(addrs[0].Port)))
+	case u.Port() == "":
+		port := "80"
+		if secure {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := hcs.dialer().DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %q: %w", hcs.Endpoint, err)
+	}
+	defer conn.Close()
+	if !secure {
+		return nil
+	}
+
+	tlsCfg, err := hcs.TLSSetting.LoadTLSConfig()
+	if err != nil {
+		return err
+	}
+	if tlsCfg == nil {
+		// Insecure without CA, the certificate of the server is not verified.
+		tlsCfg = &tls.Config{InsecureSkipVerify: true}
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	if err = tls.Client(conn, tlsCfg).Handshake(); err != nil {
+		return fmt.Errorf("failed the TLS handshake with %q: %w", hcs.Endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestProbe(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	hss := &HTTPServerSettings{
+		Endpoint: "127.0.0.1:0",
+		TLSSetting: &configtls.TLSServerSetting{
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+		},
+	}
+	tlsLn, err := hss.ToListener()
+	require.NoError(t, err)
+	tlsSrv := hss.ToServer(http.NotFoundHandler())
+	go func() {
+		_ = tlsSrv.Serve(tlsLn)
+	}()
+	defer tlsSrv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.NotFoundHandler()}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	tests := []struct {
+		name     string
+		settings HTTPClientSettings
+		records  []*net.SRV
+		wantErr  bool
+	}{
+		{
+			name:     "http",
+			settings: HTTPClientSettings{Endpoint: "http://" + ln.Addr().String() + "/v1/trace"},
+		},
+		{
+			name: "https",
+			settings: HTTPClientSettings{
+				Endpoint: "https://" + tlsLn.Addr().String(),
+				TLSSetting: configtls.TLSClientSetting{
+					TLSSetting: configtls.TLSSetting{CAFile: certs.caFile},
+				},
+			},
+		},
+		{
+			name:     "https_unknown_authority",
+			settings: HTTPClientSettings{Endpoint: "https://" + tlsLn.Addr().String()},
+			wantErr:  true,
+		},
+		{
+			name:     "srv",
+			settings: HTTPClientSettings{Endpoint: "dns+srv://_otlp._tcp.example.com"},
+			records:  []*net.SRV{{Target: "127.0.0.1.", Port: uint16(port)}},
+		},
+		{
+			name:     "srv_no_records",
+			settings: HTTPClientSettings{Endpoint: "dns+srv://_otlp._tcp.example.com"},
+			wantErr:  true,
+		},
+		{
+			name:     "connection_refused",
+			settings: HTTPClientSettings{Endpoint: "http://" + closedAddr},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid_endpoint",
+			settings: HTTPClientSettings{Endpoint: "localhost:" + strconv.Itoa(port)},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &stubResolver{records: tt.records}
+			err := tt.settings.probe(context.Background(), resolver.LookupSRV)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestProbeDeadline(t *testing.T) {
+	// The connections are accepted by the system but the TLS handshake is never
+	// answered.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	hcs := &HTTPClientSettings{Endpoint: "https://" + ln.Addr().String()}
+	err = hcs.Probe(ctx)
+	require.Error(t, err)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr), "Unexpected error %v", err)
+	assert.True(t, netErr.Timeout())
+}
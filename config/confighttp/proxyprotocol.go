@@ -0,0 +1,201 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol versions, see
+// https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt.
+const (
+	proxyProtocolV1 = "v1"
+	proxyProtocolV2 = "v2"
+
+	// proxyHeaderTimeout bounds the time to receive the header, so that a
+	// connection without header doesn't stay open.
+	proxyHeaderTimeout = 10 * time.Second
+
+	// proxyV1MaxLength is the maximum length of a v1 header, CRLF included.
+	proxyV1MaxLength = 107
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolListener wraps the accepted connections in proxyProtocolConn.
+type proxyProtocolListener struct {
+	net.Listener
+	version string
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, version: l.version}, nil
+}
+
+// proxyProtocolConn is a connection starting with a PROXY protocol header. The
+// header is read on the first call to Read, Write or RemoteAddr, not when the
+// connection is accepted, so that a slow client doesn't block the other ones.
+type proxyProtocolConn struct {
+	net.Conn
+	version string
+
+	once       sync.Once
+	br         *bufio.Reader
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(p)
+}
+
+// Write fails if the header is invalid, so that nothing is answered to a client
+// which is not a load balancer.
+func (c *proxyProtocolConn) Write(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Write(p)
+}
+
+// RemoteAddr returns the source address of the header, or the address of the
+// peer if the header has no address or is invalid.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.br = bufio.NewReader(c.Conn)
+	if c.err = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)); c.err != nil {
+		return
+	}
+	c.remoteAddr, c.err = readProxyHeader(c.br, c.version)
+	if c.err != nil {
+		c.err = fmt.Errorf("invalid PROXY protocol header: %w", c.err)
+		return
+	}
+	c.err = c.Conn.SetReadDeadline(time.Time{})
+}
+
+// readProxyHeader reads the header of the given version, or of any version if
+// empty, and returns its source address, nil for the headers without address.
+func readProxyHeader(br *bufio.Reader, version string) (net.Addr, error) {
+	// The v1 headers are longer than the v2 signature.
+	sig, err := br.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(sig, proxyV2Signature) && version != proxyProtocolV1:
+		return readProxyHeaderV2(br)
+	case bytes.HasPrefix(sig, []byte("PROXY ")) && version != proxyProtocolV2:
+		return readProxyHeaderV1(br)
+	default:
+		return nil, errors.New("missing header")
+	}
+}
+
+// readProxyHeaderV1 reads a header like "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyHeaderV1(br *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyV1MaxLength {
+			return nil, errors.New("v1 header too long")
+		}
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed v1 header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed v1 header %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads a binary header, only the TCP over IPv4 and IPv6
+// addresses are reported.
+func readProxyHeaderV2(br *bufio.Reader) (net.Addr, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 header version %d", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+
+	switch command := header[12] & 0xf; command {
+	case 0:
+		// LOCAL, e.g. a health check of the load balancer.
+		return nil, nil
+	case 1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("unsupported v2 header command %d", command)
+	}
+	switch header[13] {
+	case 0x11:
+		// TCP over IPv4: source and destination addresses, then ports.
+		if len(payload) < 12 {
+			return nil, errors.New("truncated v2 header addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21:
+		// TCP over IPv6.
+		if len(payload) < 36 {
+			return nil, errors.New("truncated v2 header addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
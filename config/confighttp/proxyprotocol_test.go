@@ -0,0 +1,205 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func proxyV2Header(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, byte(len(addresses)>>8), byte(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tcp4 := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x01, 0xbb}
+	tcp6 := make([]byte, 36)
+	copy(tcp6, net.ParseIP("2001:db8::1"))
+	copy(tcp6[32:], []byte{0xdc, 0x04})
+	tests := []struct {
+		name     string
+		version  string
+		header   []byte
+		wantAddr string
+		wantErr  string
+	}{
+		{
+			name:     "v1_tcp4",
+			header:   []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"),
+			wantAddr: "192.0.2.1:56324",
+		},
+		{
+			name:     "v1_tcp6",
+			version:  proxyProtocolV1,
+			header:   []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+			wantAddr: "[2001:db8::1]:56324",
+		},
+		{
+			name:   "v1_unknown",
+			header: []byte("PROXY UNKNOWN\r\n"),
+		},
+		{
+			name:    "v1_malformed",
+			header:  []byte("PROXY TCP4 192.0.2.1 56324\r\n"),
+			wantErr: `malformed v1 header "PROXY TCP4 192.0.2.1 56324\r\n"`,
+		},
+		{
+			name:    "v1_too_long",
+			header:  []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"),
+			wantErr: "v1 header too long",
+		},
+		{
+			name:     "v2_tcp4",
+			header:   proxyV2Header(1, 0x11, tcp4),
+			wantAddr: "192.0.2.1:56324",
+		},
+		{
+			name:     "v2_tcp6",
+			version:  proxyProtocolV2,
+			header:   proxyV2Header(1, 0x21, tcp6),
+			wantAddr: "[2001:db8::1]:56324",
+		},
+		{
+			name:   "v2_local",
+			header: proxyV2Header(0, 0x00, nil),
+		},
+		{
+			name:    "v2_truncated",
+			header:  proxyV2Header(1, 0x11, tcp4[:4]),
+			wantErr: "truncated v2 header addresses",
+		},
+		{
+			name:    "v1_not_accepted",
+			version: proxyProtocolV2,
+			header:  []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"),
+			wantErr: "missing header",
+		},
+		{
+			name:    "v2_not_accepted",
+			version: proxyProtocolV1,
+			header:  proxyV2Header(1, 0x11, tcp4),
+			wantErr: "missing header",
+		},
+		{
+			name:    "missing",
+			header:  []byte("POST /v1/trace HTTP/1.1\r\n"),
+			wantErr: "missing header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(append(tt.header, "payload"...)))
+			addr, err := readProxyHeader(br, tt.version)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantAddr == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, tt.wantAddr, addr.String())
+			}
+			// The header is consumed.
+			rest, err := ioutil.ReadAll(br)
+			require.NoError(t, err)
+			assert.Equal(t, "payload", string(rest))
+		})
+	}
+}
+
+func TestHttpProxyProtocol(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	for _, useTLS := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tls=%v", useTLS), func(t *testing.T) {
+			hss := &HTTPServerSettings{
+				Endpoint:            "127.0.0.1:0",
+				EnableProxyProtocol: true,
+			}
+			if useTLS {
+				hss.TLSSetting = &configtls.TLSServerSetting{
+					TLSSetting: configtls.TLSSetting{
+						CertFile: certs.serverCertFile,
+						KeyFile:  certs.serverKeyFile,
+					},
+				}
+			}
+			ln, err := hss.ToListener()
+			require.NoError(t, err)
+			s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, errWrite := fmt.Fprint(w, r.RemoteAddr)
+				assert.NoError(t, errWrite)
+			}))
+			go func() {
+				_ = s.Serve(ln)
+			}()
+			defer s.Close()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+			require.NoError(t, err)
+			if useTLS {
+				caPEM, errRead := ioutil.ReadFile(certs.caFile)
+				require.NoError(t, errRead)
+				rootCAs := x509.NewCertPool()
+				require.True(t, rootCAs.AppendCertsFromPEM(caPEM))
+				conn = tls.Client(conn, &tls.Config{RootCAs: rootCAs, ServerName: "127.0.0.1"})
+			}
+			req, err := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+			require.NoError(t, err)
+			require.NoError(t, req.Write(conn))
+			resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, "192.0.2.1:56324", string(body))
+		})
+	}
+}
+
+func TestHttpProxyProtocolMissingHeader(t *testing.T) {
+	hss := &HTTPServerSettings{
+		Endpoint:            "127.0.0.1:0",
+		EnableProxyProtocol: true,
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	s := hss.ToServer(http.NotFoundHandler())
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	_, err = http.Get("http://" + ln.Addr().String())
+	assert.Error(t, err)
+}
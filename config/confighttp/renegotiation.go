@@ -0,0 +1,67 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// The TLS renegotiation policies of the clients, see
+// HTTPClientSettings.Renegotiation.
+const (
+	RenegotiationNever  = "never"
+	RenegotiationOnce   = "once"
+	RenegotiationFreely = "freely"
+)
+
+// renegotiationSupports are the tls.Config.Renegotiation values by policy.
+var renegotiationSupports = map[string]tls.RenegotiationSupport{
+	RenegotiationNever:  tls.RenegotiateNever,
+	RenegotiationOnce:   tls.RenegotiateOnceAsClient,
+	RenegotiationFreely: tls.RenegotiateFreelyAsClient,
+}
+
+// renegotiation returns the tls.Config.Renegotiation value of the settings.
+func (hcs *HTTPClientSettings) renegotiation() (tls.RenegotiationSupport, error) {
+	if hcs.Renegotiation == "" {
+		return tls.RenegotiateNever, nil
+	}
+	support, ok := renegotiationSupports[hcs.Renegotiation]
+	if !ok {
+		return tls.RenegotiateNever, fmt.Errorf("unsupported renegotiation %q, must be %q, %q or %q",
+			hcs.Renegotiation, RenegotiationNever, RenegotiationOnce, RenegotiationFreely)
+	}
+	if support != tls.RenegotiateNever && hcs.HTTP3 {
+		return tls.RenegotiateNever, errors.New("renegotiation cannot be used with http3")
+	}
+	return support, nil
+}
+
+// applyRenegotiation returns the TLS config allowing the renegotiation of the
+// settings, the default TLS config if tlsCfg is nil and the renegotiation is
+// allowed, since the default config never renegotiates.
+func (hcs *HTTPClientSettings) applyRenegotiation(tlsCfg *tls.Config) (*tls.Config, error) {
+	support, err := hcs.renegotiation()
+	if err != nil || support == tls.RenegotiateNever {
+		return tlsCfg, err
+	}
+	if tlsCfg == nil {
+		tlsCfg = &tls.Config{}
+	}
+	tlsCfg.Renegotiation = support
+	return tlsCfg, nil
+}
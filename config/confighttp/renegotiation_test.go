@@ -0,0 +1,74 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestHttpClientRenegotiation(t *testing.T) {
+	tests := []struct {
+		renegotiation string
+		insecure      bool
+		want          tls.RenegotiationSupport
+	}{
+		{renegotiation: "", want: tls.RenegotiateNever},
+		{renegotiation: RenegotiationNever, want: tls.RenegotiateNever},
+		{renegotiation: RenegotiationOnce, want: tls.RenegotiateOnceAsClient},
+		{renegotiation: RenegotiationFreely, want: tls.RenegotiateFreelyAsClient},
+		// The default TLS config is replaced to allow the renegotiation.
+		{renegotiation: RenegotiationOnce, insecure: true, want: tls.RenegotiateOnceAsClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.renegotiation, func(t *testing.T) {
+			hcs := &HTTPClientSettings{
+				Endpoint:      "https://localhost:4318",
+				Renegotiation: tt.renegotiation,
+				TLSSetting:    configtls.TLSClientSetting{Insecure: tt.insecure},
+			}
+			require.NoError(t, hcs.Validate())
+			transport, err := hcs.ToTransport()
+			require.NoError(t, err)
+			if tt.want == tls.RenegotiateNever && transport.TLSClientConfig == nil {
+				return
+			}
+			require.NotNil(t, transport.TLSClientConfig)
+			assert.Equal(t, tt.want, transport.TLSClientConfig.Renegotiation)
+
+			client, err := hcs.ToClientWithBase(http.DefaultTransport)
+			require.NoError(t, err)
+			require.NotNil(t, client)
+		})
+	}
+}
+
+func TestHttpClientRenegotiationInvalid(t *testing.T) {
+	hcs := &HTTPClientSettings{Endpoint: "https://localhost:4318", Renegotiation: "always"}
+	assert.EqualError(t, hcs.Validate(), `unsupported renegotiation "always", must be "never", "once" or "freely"`)
+	_, err := hcs.ToClient()
+	assert.EqualError(t, err, `unsupported renegotiation "always", must be "never", "once" or "freely"`)
+	_, err = hcs.ToTransport()
+	assert.Error(t, err)
+
+	hcs = &HTTPClientSettings{Endpoint: "https://localhost:4318", Renegotiation: RenegotiationOnce, HTTP3: true}
+	assert.EqualError(t, hcs.Validate(), "renegotiation cannot be used with http3")
+}
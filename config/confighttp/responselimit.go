@@ -0,0 +1,74 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrResponseBodyTooLarge is returned by the reads of the response bodies
+// larger than HTTPClientSettings.MaxResponseBodySize.
+var ErrResponseBodyTooLarge = errors.New("response body too large")
+
+// maxResponseBodyRoundTripper limits the size of the response bodies read.
+type maxResponseBodyRoundTripper struct {
+	transport http.RoundTripper
+	maxSize   int64
+}
+
+func (rt *maxResponseBodyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.transport.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+	resp.Body = &maxSizeBody{ReadCloser: resp.Body, maxSize: rt.maxSize, remaining: rt.maxSize}
+	return resp, nil
+}
+
+// maxSizeBody returns the first maxSize bytes of the body, then an error
+// wrapping ErrResponseBodyTooLarge if the body has more, like http.MaxBytesReader.
+type maxSizeBody struct {
+	io.ReadCloser
+	maxSize   int64
+	remaining int64
+}
+
+func (b *maxSizeBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, b.tooLarge()
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// One more byte is read to detect the bodies over the limit.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		return n, err
+	}
+	n = int(b.remaining)
+	b.remaining = -1
+	return n, b.tooLarge()
+}
+
+func (b *maxSizeBody) tooLarge() error {
+	return fmt.Errorf("%w: more than %d bytes", ErrResponseBodyTooLarge, b.maxSize)
+}
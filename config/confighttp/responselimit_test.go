@@ -0,0 +1,70 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxResponseBodySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{
+			name: "under_limit",
+			body: "1234",
+		},
+		{
+			name: "at_limit",
+			body: "12345",
+		},
+		{
+			name:    "over_limit",
+			body:    "123456",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(tt.body))}, nil
+			})
+			hcs := &HTTPClientSettings{MaxResponseBodySize: 5}
+			client, err := hcs.ToClientWithBase(base)
+			require.NoError(t, err)
+			resp, err := client.Get("http://localhost:1234")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrResponseBodyTooLarge))
+				assert.EqualError(t, err, "response body too large: more than 5 bytes")
+				assert.Equal(t, "12345", string(body))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
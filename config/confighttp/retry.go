@@ -0,0 +1,190 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+const (
+	// NonRewindableBodyBuffer buffers request bodies that cannot be rewound
+	// in memory, up to RetrySettings.MaxBufferedBodySize, so they can be retried.
+	NonRewindableBodyBuffer = "buffer"
+	// NonRewindableBodyNoRetry sends requests with a body that cannot be
+	// rewound only once, without retries.
+	NonRewindableBodyNoRetry = "no_retry"
+
+	defaultRetryMaxAttempts     = 3
+	defaultRetryInitialInterval = 100 * time.Millisecond
+	defaultRetryMaxInterval     = 5 * time.Second
+	defaultMaxBufferedBodySize  = 4 * 1024 * 1024
+)
+
+// RetrySettings configures retrying the HTTP requests that fail with a transport
+// error or with a 429, 502, 503 or 504 response status.
+type RetrySettings struct {
+	// MaxAttempts is the maximum number of attempts per request, including the
+	// first one. (optional, default 3)
+	MaxAttempts int `mapstructure:"max_attempts,omitempty"`
+
+	// InitialInterval is the time to wait after the first failure before retrying.
+	// (optional, default 100ms)
+	InitialInterval time.Duration `mapstructure:"initial_interval,omitempty"`
+
+	// MaxInterval is the upper bound on backoff interval between two attempts.
+	// (optional, default 5s)
+	MaxInterval time.Duration `mapstructure:"max_interval,omitempty"`
+
+	// NonRewindableBody configures how requests with a body that cannot be
+	// rewound (a body without http.Request.GetBody) are retried. Either "buffer"
+	// or "no_retry". (optional, default "buffer")
+	NonRewindableBody string `mapstructure:"non_rewindable_body,omitempty"`
+
+	// MaxBufferedBodySize is the maximum size in bytes of a non rewindable
+	// body that is buffered with the "buffer" policy. Requests with a larger
+	// body fail. (optional, default 4MiB)
+	MaxBufferedBodySize int64 `mapstructure:"max_buffered_body_size,omitempty"`
+}
+
+// retryRoundTripper retries failed requests with an exponential backoff.
+type retryRoundTripper struct {
+	transport           http.RoundTripper
+	maxAttempts         int
+	initialInterval     time.Duration
+	maxInterval         time.Duration
+	bufferNonRewindable bool
+	maxBufferedBodySize int64
+}
+
+func newRetryRoundTripper(transport http.RoundTripper, rs *RetrySettings) (*retryRoundTripper, error) {
+	rt := &retryRoundTripper{
+		transport:           transport,
+		maxAttempts:         rs.MaxAttempts,
+		initialInterval:     rs.InitialInterval,
+		maxInterval:         rs.MaxInterval,
+		maxBufferedBodySize: rs.MaxBufferedBodySize,
+	}
+	switch rs.NonRewindableBody {
+	case "", NonRewindableBodyBuffer:
+		rt.bufferNonRewindable = true
+	case NonRewindableBodyNoRetry:
+	default:
+		return nil, fmt.Errorf("unsupported non_rewindable_body policy %q", rs.NonRewindableBody)
+	}
+	if rt.maxAttempts <= 0 {
+		rt.maxAttempts = defaultRetryMaxAttempts
+	}
+	if rt.initialInterval <= 0 {
+		rt.initialInterval = defaultRetryInitialInterval
+	}
+	if rt.maxInterval <= 0 {
+		rt.maxInterval = defaultRetryMaxInterval
+	}
+	if rt.maxBufferedBodySize <= 0 {
+		rt.maxBufferedBodySize = defaultMaxBufferedBodySize
+	}
+	return rt, nil
+}
+
+func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	getBody, err := rt.bodyRewinder(req)
+	if err != nil {
+		return nil, err
+	}
+	if getBody == nil {
+		return rt.transport.RoundTrip(req)
+	}
+
+	expBackoff := backoff.NewExponentialBackOff()
+	expBackoff.InitialInterval = rt.initialInterval
+	expBackoff.MaxInterval = rt.maxInterval
+	expBackoff.MaxElapsedTime = 0
+	expBackoff.Reset()
+
+	for attempt := 1; ; attempt++ {
+		// Each attempt uses its own copy of the request, see http.RoundTripper.
+		r := req.Clone(req.Context())
+		if r.Body, err = getBody(); err != nil {
+			return nil, err
+		}
+		r.GetBody = getBody
+
+		resp, err := rt.transport.RoundTrip(r)
+		if attempt >= rt.maxAttempts || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(expBackoff.NextBackOff()):
+		}
+	}
+}
+
+// bodyRewinder returns a function that provides a fresh copy of the request
+// body for each attempt, or nil if the request must not be retried.
+func (rt *retryRoundTripper) bodyRewinder(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return func() (io.ReadCloser, error) { return http.NoBody, nil }, nil
+	}
+	if req.GetBody != nil {
+		first := true
+		return func() (io.ReadCloser, error) {
+			if first {
+				first = false
+				return req.Body, nil
+			}
+			return req.GetBody()
+		}, nil
+	}
+	if !rt.bufferNonRewindable {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, rt.maxBufferedBodySize+1))
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > rt.maxBufferedBodySize {
+		return nil, fmt.Errorf("request body cannot be rewound and exceeds max_buffered_body_size of %d bytes", rt.maxBufferedBodySize)
+	}
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}, nil
+}
+
+// shouldRetry returns true if the request failed, unless it was short-circuited
+// by the circuit breaker: retrying would only fail again until the circuit is
+// half open, the circuit breaker takes care of probing the endpoint instead.
+func shouldRetry(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return isFailure(resp, err)
+}
@@ -0,0 +1,173 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nonSeekableReader hides the concrete type of the reader so that
+// http.NewRequest doesn't set http.Request.GetBody.
+type nonSeekableReader struct {
+	r *strings.Reader
+}
+
+func (n *nonSeekableReader) Read(p []byte) (int, error) {
+	return n.r.Read(p)
+}
+
+func newFlakyServer(t *testing.T, failures int, bodies *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		*bodies = append(*bodies, string(body))
+		if len(*bodies) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestRetryRoundTripper(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		maxSize    int64
+		body       func() *http.Request
+		wantStatus int
+		wantBodies []string
+		wantErr    string
+	}{
+		{
+			name: "rewindable",
+			body: func() *http.Request {
+				req, _ := http.NewRequest("POST", "/", bytes.NewBufferString("payload"))
+				return req
+			},
+			wantStatus: 200,
+			wantBodies: []string{"payload", "payload", "payload"},
+		},
+		{
+			name: "no_body",
+			body: func() *http.Request {
+				req, _ := http.NewRequest("GET", "/", nil)
+				return req
+			},
+			wantStatus: 200,
+			wantBodies: []string{"", "", ""},
+		},
+		{
+			name:   "non_rewindable_buffer",
+			policy: NonRewindableBodyBuffer,
+			body: func() *http.Request {
+				req, _ := http.NewRequest("POST", "/", &nonSeekableReader{strings.NewReader("payload")})
+				return req
+			},
+			wantStatus: 200,
+			wantBodies: []string{"payload", "payload", "payload"},
+		},
+		{
+			name:    "non_rewindable_buffer_exceeded",
+			policy:  NonRewindableBodyBuffer,
+			maxSize: 4,
+			body: func() *http.Request {
+				req, _ := http.NewRequest("POST", "/", &nonSeekableReader{strings.NewReader("payload")})
+				return req
+			},
+			wantErr: "request body cannot be rewound and exceeds max_buffered_body_size of 4 bytes",
+		},
+		{
+			name:   "non_rewindable_no_retry",
+			policy: NonRewindableBodyNoRetry,
+			body: func() *http.Request {
+				req, _ := http.NewRequest("POST", "/", &nonSeekableReader{strings.NewReader("payload")})
+				return req
+			},
+			wantStatus: 503,
+			wantBodies: []string{"payload"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			server := newFlakyServer(t, 2, &bodies)
+			defer server.Close()
+
+			hcs := &HTTPClientSettings{
+				Endpoint: server.URL,
+				Retry: &RetrySettings{
+					InitialInterval:     time.Millisecond,
+					NonRewindableBody:   tt.policy,
+					MaxBufferedBodySize: tt.maxSize,
+				},
+			}
+			client, err := hcs.ToClient()
+			require.NoError(t, err)
+
+			req := tt.body()
+			req.URL, err = req.URL.Parse(server.URL)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			if tt.wantErr != "" {
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Empty(t, bodies)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantBodies, bodies)
+		})
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var bodies []string
+	server := newFlakyServer(t, 10, &bodies)
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint: server.URL,
+		Retry: &RetrySettings{
+			MaxAttempts:     4,
+			InitialInterval: time.Millisecond,
+		},
+	}
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, bodies, 4)
+}
+
+func TestRetryInvalidPolicy(t *testing.T) {
+	hcs := &HTTPClientSettings{
+		Retry: &RetrySettings{NonRewindableBody: "unknown"},
+	}
+	_, err := hcs.ToClient()
+	assert.EqualError(t, err, `unsupported non_rewindable_body policy "unknown"`)
+}
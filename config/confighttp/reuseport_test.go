@@ -0,0 +1,48 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpServerReusePort(t *testing.T) {
+	hss := &HTTPServerSettings{Endpoint: "localhost:0", ReusePort: true}
+	if !reusePortSupported {
+		assert.EqualError(t, hss.Validate(), fmt.Sprintf("reuse_port is not supported on %s", runtime.GOOS))
+		return
+	}
+
+	first, err := hss.ToListener()
+	require.NoError(t, err)
+	defer first.Close()
+
+	// Both listeners bind the same port.
+	hss.Endpoint = first.Addr().String()
+	second, err := hss.ToListener()
+	require.NoError(t, err)
+	defer second.Close()
+	assert.Equal(t, first.Addr().String(), second.Addr().String())
+
+	// The listeners without the option cannot.
+	hss.ReusePort = false
+	_, err = hss.ToListener()
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"net/http"
+	"sort"
+)
+
+// The standard URL paths of the OTLP/HTTP signals, see ToServerWithRoutes.
+const (
+	OTLPTracesPath  = "/v1/traces"
+	OTLPMetricsPath = "/v1/metrics"
+	OTLPLogsPath    = "/v1/logs"
+)
+
+// ToServerWithRoutes is like ToServer but the requests are routed by URL path
+// to the handlers of routes, e.g. with the OTLPTracesPath, OTLPMetricsPath and
+// OTLPLogsPath keys for the handlers of each signal. The middlewares are built
+// once around the routing, and the requests for the other paths are rejected
+// with a 404 status by the error handler unless opts has WithPaths.
+func (hss *HTTPServerSettings) ToServerWithRoutes(routes map[string]http.Handler, opts ...ToServerOption) *http.Server {
+	mux := http.NewServeMux()
+	paths := make([]string, 0, len(routes))
+	for path, handler := range routes {
+		mux.Handle(path, handler)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return hss.ToServer(mux, append([]ToServerOption{WithPaths(paths...)}, opts...)...)
+}
@@ -0,0 +1,87 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToServerWithRoutes(t *testing.T) {
+	got := map[string]string{}
+	signalHandler := func(signal string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			got[signal] = string(body)
+		})
+	}
+	// The middlewares wrap the routing once for all the signals.
+	var decompressions int
+	hss := &HTTPServerSettings{}
+	s := hss.ToServerWithRoutes(map[string]http.Handler{
+		OTLPTracesPath:  signalHandler("traces"),
+		OTLPMetricsPath: signalHandler("metrics"),
+		OTLPLogsPath:    signalHandler("logs"),
+	}, WithMiddlewares(func(defaults []Middleware) []Middleware {
+		for i, m := range defaults {
+			if m.Name != MiddlewareDecompression {
+				continue
+			}
+			wrap := m.Wrap
+			defaults[i].Wrap = func(next http.Handler) http.Handler {
+				decompressions++
+				return wrap(next)
+			}
+		}
+		return defaults
+	}))
+	assert.Equal(t, 1, decompressions)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	for _, path := range []string{OTLPTracesPath, OTLPMetricsPath, OTLPLogsPath} {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(buf.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		s.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+	assert.Equal(t, map[string]string{"traces": "payload", "metrics": "payload", "logs": "payload"}, got)
+
+	// The other paths are rejected by the error handler.
+	var errorHandled bool
+	s = hss.ToServerWithRoutes(map[string]http.Handler{
+		OTLPTracesPath: signalHandler("traces"),
+	}, WithErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		errorHandled = true
+		w.WriteHeader(statusCode)
+	}))
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, httptest.NewRequest("POST", OTLPMetricsPath, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, errorHandled)
+}
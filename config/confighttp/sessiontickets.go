@@ -0,0 +1,92 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// sessionTicketKeys is the number of session ticket keys kept by the rotation:
+// the current key encrypts the new tickets and the previous one still decrypts
+// the tickets issued during the last interval.
+const sessionTicketKeys = 2
+
+// sessionTicketRotator replaces the session ticket keys of a TLS configuration
+// with a new random key at each interval.
+type sessionTicketRotator struct {
+	tlsCfg *tls.Config
+	keys   [][32]byte
+}
+
+func (r *sessionTicketRotator) rotate() error {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return fmt.Errorf("failed to generate a session ticket key: %w", err)
+	}
+	r.keys = append([][32]byte{key}, r.keys...)
+	if len(r.keys) > sessionTicketKeys {
+		r.keys = r.keys[:sessionTicketKeys]
+	}
+	r.tlsCfg.SetSessionTicketKeys(r.keys)
+	return nil
+}
+
+// sessionTicketListener is a TLS listener rotating the session ticket keys of
+// its configuration until it is closed.
+type sessionTicketListener struct {
+	net.Listener
+	rotator   *sessionTicketRotator
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSessionTicketListener(listener net.Listener, tlsCfg *tls.Config, interval time.Duration) (*sessionTicketListener, error) {
+	l := &sessionTicketListener{
+		rotator: &sessionTicketRotator{tlsCfg: tlsCfg},
+		stop:    make(chan struct{}),
+	}
+	if err := l.rotator.rotate(); err != nil {
+		return nil, err
+	}
+	l.Listener = tls.NewListener(listener, tlsCfg)
+	go l.rotateEvery(interval)
+	return l, nil
+}
+
+func (l *sessionTicketListener) rotateEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// On failure the current keys are kept until the next interval.
+			_ = l.rotator.rotate()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *sessionTicketListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.stop)
+	})
+	return l.Listener.Close()
+}
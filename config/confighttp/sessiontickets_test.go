@@ -0,0 +1,112 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+func TestSessionTicketKeyRotation(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	hss := &HTTPServerSettings{
+		Endpoint: "localhost:0",
+		TLSSetting: &configtls.TLSServerSetting{
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+		},
+		// The keys are rotated by the test.
+		SessionTicketKeyRotation: time.Hour,
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	stl, ok := ln.(*sessionTicketListener)
+	require.True(t, ok, "Unexpected listener %T", ln)
+	s := hss.ToServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, errWrite := fmt.Fprint(w, r.TLS.DidResume)
+		assert.NoError(t, errWrite)
+	}))
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	defer s.Close()
+
+	caPEM, err := ioutil.ReadFile(certs.caFile)
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	require.True(t, rootCAs.AppendCertsFromPEM(caPEM))
+	client := &http.Client{Transport: &http.Transport{
+		// A new connection per request, resumed with the cached session.
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			RootCAs:            rootCAs,
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		},
+	}}
+	didResume := func() string {
+		resp, errGet := client.Get("https://" + ln.Addr().String())
+		require.NoError(t, errGet)
+		body, errRead := ioutil.ReadAll(resp.Body)
+		require.NoError(t, errRead)
+		require.NoError(t, resp.Body.Close())
+		return string(body)
+	}
+
+	assert.Equal(t, "false", didResume())
+	assert.Equal(t, "true", didResume())
+	// The ticket issued with the previous key is still accepted.
+	require.NoError(t, stl.rotator.rotate())
+	assert.Equal(t, "true", didResume())
+	// The ticket was issued with a key that is no longer used.
+	require.NoError(t, stl.rotator.rotate())
+	require.NoError(t, stl.rotator.rotate())
+	assert.Equal(t, "false", didResume())
+}
+
+func TestSessionTicketKeyRotationInterval(t *testing.T) {
+	certs := newTestCertificates(t, "localhost", "127.0.0.1")
+	hss := &HTTPServerSettings{
+		Endpoint: "localhost:0",
+		TLSSetting: &configtls.TLSServerSetting{
+			TLSSetting: configtls.TLSSetting{
+				CertFile: certs.serverCertFile,
+				KeyFile:  certs.serverKeyFile,
+			},
+		},
+		SessionTicketKeyRotation: time.Millisecond,
+	}
+	ln, err := hss.ToListener()
+	require.NoError(t, err)
+	stl := ln.(*sessionTicketListener)
+	require.NoError(t, ln.Close())
+	// The rotation is stopped by Close.
+	select {
+	case <-stl.stop:
+	case <-time.After(time.Second):
+		t.Fatal("Rotation not stopped")
+	}
+}
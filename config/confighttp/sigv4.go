@@ -0,0 +1,274 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+)
+
+// SigV4Settings configures the signing of the requests with the AWS Signature
+// Version 4, for the AWS endpoints authenticating the requests with IAM.
+type SigV4Settings struct {
+	// Region is the AWS region of the endpoint, e.g. "us-east-1".
+	Region string `mapstructure:"region"`
+	// Service is the signing name of the AWS service of the endpoint, e.g. "aps".
+	Service string `mapstructure:"service"`
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials.
+	// When they are not set, the credentials are read from the
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+	// variables on each request, so that the rotated credentials are used.
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	SessionToken    string `mapstructure:"session_token"`
+}
+
+// validate checks that the region and the service are set, and that the static
+// credentials are complete.
+func (s *SigV4Settings) validate() error {
+	if s.Region == "" || s.Service == "" {
+		return errors.New("sigv4 requires a region and a service")
+	}
+	if (s.AccessKeyID == "") != (s.SecretAccessKey == "") {
+		return errors.New("sigv4 access_key_id and secret_access_key must be set together")
+	}
+	if s.AccessKeyID == "" && s.SessionToken != "" {
+		return errors.New("sigv4 session_token requires access_key_id and secret_access_key")
+	}
+	return nil
+}
+
+// sigV4Credentials are the credentials signing a request.
+type sigV4Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// credentialsProvider returns the function returning the credentials of each
+// request: the static credentials, or else the environment credentials.
+func (s *SigV4Settings) credentialsProvider() func() (sigV4Credentials, error) {
+	if s.AccessKeyID != "" {
+		creds := sigV4Credentials{accessKeyID: s.AccessKeyID, secretAccessKey: s.SecretAccessKey, sessionToken: s.SessionToken}
+		return func() (sigV4Credentials, error) { return creds, nil }
+	}
+	return func() (sigV4Credentials, error) {
+		creds := sigV4Credentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+			return sigV4Credentials{}, errors.New("sigv4 credentials not found: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+		}
+		return creds, nil
+	}
+}
+
+// sigV4RoundTripper signs each request, including the SHA-256 hash of its
+// body, with the AWS Signature Version 4. It is under the retries so that each
+// attempt is signed again with a fresh date.
+type sigV4RoundTripper struct {
+	transport   http.RoundTripper
+	region      string
+	service     string
+	credentials func() (sigV4Credentials, error)
+	now         func() time.Time
+}
+
+func newSigV4RoundTripper(transport http.RoundTripper, s *SigV4Settings) *sigV4RoundTripper {
+	return &sigV4RoundTripper{
+		transport:   transport,
+		region:      s.Region,
+		service:     s.Service,
+		credentials: s.credentialsProvider(),
+		now:         time.Now,
+	}
+}
+
+func (rt *sigV4RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	creds, err := rt.credentials()
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	// A RoundTripper must not modify the request, see http.RoundTripper.
+	signed := req.Clone(req.Context())
+	payload, err := readRequestBody(signed)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := sha256.Sum256(payload)
+	signed.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	signSigV4(signed, hex.EncodeToString(payloadHash[:]), creds, rt.region, rt.service, rt.now().UTC())
+	return rt.transport.RoundTrip(signed)
+}
+
+// readRequestBody returns the body of the request and replaces it with a copy
+// that can be read again, with GetBody if the request has it.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body := req.Body
+	if req.GetBody != nil {
+		var err error
+		if body, err = req.GetBody(); err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+	}
+	payload, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	if req.GetBody == nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(payload)), nil
+		}
+	}
+	return payload, nil
+}
+
+// closeRequestBody closes the body of a request that is not sent, as a
+// RoundTripper must, see http.RoundTripper.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// signSigV4 sets the X-Amz-Date, X-Amz-Security-Token and Authorization
+// headers of the request. The signed headers are the host, the Content-Type,
+// the Content-Encoding and the X-Amz-* headers, so that the headers added
+// below, e.g. the trace context ones, do not invalidate the signature.
+func signSigV4(req *http.Request, payloadHash string, creds sigV4Credentials, region, service string, now time.Time) {
+	amzDate := now.Format(sigV4TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "content-encoding" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	// The escaped path is escaped again, as required by the services other
+	// than S3.
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Escape(path, false),
+		sigV4CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format(sigV4DateFormat)
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// sigV4CanonicalQuery returns the query parameters sorted by name and value,
+// with their names and values escaped.
+func sigV4CanonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			params = append(params, sigV4Escape(name, true)+"="+sigV4Escape(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// sigV4Escape percent-encodes all the bytes but the unreserved characters of
+// RFC 3986, and the slashes unless escapeSlash is set.
+func sigV4Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,202 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The expected signatures are the ones of the AWS Signature Version 4 test suite.
+func TestSignSigV4(t *testing.T) {
+	creds := sigV4Credentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	emptyHash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{
+			name:   "get_vanilla",
+			method: "GET",
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "post_vanilla",
+			method: "POST",
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:   "get_vanilla_query_order_key_case",
+			method: "GET",
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			require.NoError(t, err)
+			signSigV4(req, emptyHash, creds, "us-east-1", "service", now)
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, tt.want, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestSigV4RoundTripper(t *testing.T) {
+	var dates, auths []string
+	var bodies []string
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+		dates = append(dates, req.Header.Get("X-Amz-Date"))
+		auths = append(auths, req.Header.Get("Authorization"))
+		hash := sha256.Sum256(body)
+		assert.Equal(t, hex.EncodeToString(hash[:]), req.Header.Get("X-Amz-Content-Sha256"))
+		assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token,")
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+	signer := newSigV4RoundTripper(base, &SigV4Settings{
+		Region:          "us-east-1",
+		Service:         "aps",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	})
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	rt, err := newRetryRoundTripper(signer, &RetrySettings{MaxAttempts: 2, InitialInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	// The body cannot be rewound, it is buffered by the retries.
+	req := httptest.NewRequest("POST", "https://aps-workspaces.us-east-1.amazonaws.com/api/v1/remote_write", ioutil.NopCloser(strings.NewReader("payload")))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	// Each attempt is signed again.
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+	assert.Equal(t, []string{"20200101T000001Z", "20200101T000002Z"}, dates)
+	assert.NotEqual(t, auths[0], auths[1])
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestSigV4RoundTripperNonRewindableBody(t *testing.T) {
+	var body string
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		b, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		body = string(b)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+	rt := newSigV4RoundTripper(base, &SigV4Settings{Region: "us-east-1", Service: "aps", AccessKeyID: "a", SecretAccessKey: "b"})
+	resp, err := rt.RoundTrip(httptest.NewRequest("POST", "https://example.com/", ioutil.NopCloser(strings.NewReader("payload"))))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "payload", body)
+}
+
+func TestSigV4EnvironmentCredentials(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+	provider := (&SigV4Settings{Region: "us-east-1", Service: "aps"}).credentialsProvider()
+	_, err := provider()
+	assert.EqualError(t, err, "sigv4 credentials not found: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "a")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	creds, err := provider()
+	require.NoError(t, err)
+	assert.Equal(t, sigV4Credentials{accessKeyID: "a", secretAccessKey: "b"}, creds)
+}
+
+func TestHttpClientSigV4(t *testing.T) {
+	tests := []struct {
+		name    string
+		hcs     *HTTPClientSettings
+		wantErr string
+	}{
+		{
+			name:    "missing_region",
+			hcs:     &HTTPClientSettings{Endpoint: "https://localhost:4318", SigV4: &SigV4Settings{Service: "aps"}},
+			wantErr: "sigv4 requires a region and a service",
+		},
+		{
+			name:    "incomplete_credentials",
+			hcs:     &HTTPClientSettings{Endpoint: "https://localhost:4318", SigV4: &SigV4Settings{Region: "us-east-1", Service: "aps", AccessKeyID: "a"}},
+			wantErr: "sigv4 access_key_id and secret_access_key must be set together",
+		},
+		{
+			name: "basic_auth",
+			hcs: &HTTPClientSettings{
+				Endpoint:  "https://localhost:4318",
+				SigV4:     &SigV4Settings{Region: "us-east-1", Service: "aps"},
+				BasicAuth: &BasicAuthSettings{Username: "user"},
+			},
+			wantErr: "sigv4 cannot be used with basic_auth",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, tt.hcs.Validate(), tt.wantErr)
+		})
+	}
+
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+	hcs := &HTTPClientSettings{
+		Endpoint:    server.URL,
+		Compression: "gzip",
+		SigV4:       &SigV4Settings{Region: "us-east-1", Service: "aps", AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"},
+	}
+	require.NoError(t, hcs.Validate())
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Post(server.URL, "application/x-protobuf", strings.NewReader("payload"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Contains(t, gotAuth, "SignedHeaders=content-encoding;content-type;host;x-amz-content-sha256;x-amz-date, ")
+}
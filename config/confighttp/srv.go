@@ -0,0 +1,209 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// srvScheme is the endpoint scheme that resolves the host as a DNS SRV
+	// name and sends the requests over plaintext HTTP to the resolved targets.
+	srvScheme = "dns+srv"
+	// srvSecureScheme is like srvScheme but sends the requests over HTTPS.
+	srvSecureScheme = "dns+srv+https"
+
+	defaultSRVRefreshInterval = 30 * time.Second
+	// srvLookupTimeout bounds the resolutions of the SRV names.
+	srvLookupTimeout = 10 * time.Second
+)
+
+// lookupSRVFunc has the signature of net.Resolver.LookupSRV.
+type lookupSRVFunc func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// isSRVEndpoint returns true if the endpoint uses one of the SRV discovery schemes.
+func isSRVEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, srvScheme+"://") || strings.HasPrefix(endpoint, srvSecureScheme+"://")
+}
+
+// srvRoundTripper resolves the host of the request URL as a DNS SRV name and
+// rewrites the request to one of the resolved targets. Targets are chosen
+// per request from the lowest priority group, randomly weighted by the SRV
+// weight, as described in RFC 2782. The records are resolved again in the
+// background once stale, the requests meanwhile use the previous records.
+type srvRoundTripper struct {
+	transport       http.RoundTripper
+	lookupSRV       lookupSRVFunc
+	refreshInterval time.Duration
+
+	mu        sync.Mutex
+	name      string
+	records   []*net.SRV
+	refreshed time.Time
+	lookups   map[string]*srvLookup
+	rand      *rand.Rand
+}
+
+// srvLookup is a resolution of a SRV name shared by the requests waiting for it.
+type srvLookup struct {
+	done    chan struct{}
+	records []*net.SRV
+	err     error
+}
+
+func newSRVRoundTripper(transport http.RoundTripper, lookup lookupSRVFunc, refreshInterval time.Duration) *srvRoundTripper {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultSRVRefreshInterval
+	}
+	return &srvRoundTripper{
+		transport:       transport,
+		lookupSRV:       lookup,
+		refreshInterval: refreshInterval,
+		lookups:         map[string]*srvLookup{},
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *srvRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var scheme string
+	switch req.URL.Scheme {
+	case srvScheme:
+		scheme = "http"
+	case srvSecureScheme:
+		scheme = "https"
+	default:
+		return s.transport.RoundTrip(req)
+	}
+
+	target, err := s.pick(req.Context(), req.URL.Hostname())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// The request must not be modified, see http.RoundTripper.
+	r := req.Clone(req.Context())
+	r.URL.Scheme = scheme
+	r.URL.Host = net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port)))
+	r.Host = ""
+	return s.transport.RoundTrip(r)
+}
+
+// pick returns the target for the next request. The stale records are used
+// while they are resolved again, the requests without records wait for their
+// resolution. If a refresh fails the previously resolved records are used until
+// the next attempt.
+func (s *srvRoundTripper) pick(ctx context.Context, name string) (*net.SRV, error) {
+	s.mu.Lock()
+	if name == s.name && len(s.records) > 0 {
+		if time.Since(s.refreshed) >= s.refreshInterval {
+			s.lookupLocked(name)
+		}
+		target := pickSRV(s.records, s.rand)
+		s.mu.Unlock()
+		return target, nil
+	}
+	l := s.lookupLocked(name)
+	s.mu.Unlock()
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if l.err != nil {
+		return nil, fmt.Errorf("failed to resolve SRV endpoint: %w", l.err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return pickSRV(l.records, s.rand), nil
+}
+
+// lookupLocked starts resolving name, unless it is already being resolved, and
+// returns the resolution. Must be called with the lock held.
+func (s *srvRoundTripper) lookupLocked(name string) *srvLookup {
+	if l, ok := s.lookups[name]; ok {
+		return l
+	}
+	l := &srvLookup{done: make(chan struct{})}
+	s.lookups[name] = l
+	go func() {
+		// The resolution is shared, it is not canceled with a request.
+		ctx, cancel := context.WithTimeout(context.Background(), srvLookupTimeout)
+		defer cancel()
+		_, records, err := s.lookupSRV(ctx, "", "", name)
+		if err == nil && len(records) == 0 {
+			err = fmt.Errorf("no SRV records found for %q", name)
+		}
+
+		s.mu.Lock()
+		delete(s.lookups, name)
+		switch {
+		case err == nil:
+			s.name = name
+			s.records = records
+			s.refreshed = time.Now()
+		case name == s.name:
+			// The next attempt is after the refresh interval.
+			s.refreshed = time.Now()
+		}
+		s.mu.Unlock()
+
+		l.records, l.err = records, err
+		close(l.done)
+	}()
+	return l
+}
+
+// pickSRV selects a record from the lowest priority group using weighted
+// random selection. Records with weight 0 are only selected if all records in
+// the group have weight 0.
+func pickSRV(records []*net.SRV, rnd *rand.Rand) *net.SRV {
+	var group []*net.SRV
+	for _, r := range records {
+		switch {
+		case len(group) == 0 || r.Priority < group[0].Priority:
+			group = []*net.SRV{r}
+		case r.Priority == group[0].Priority:
+			group = append(group, r)
+		}
+	}
+
+	total := 0
+	for _, r := range group {
+		total += int(r.Weight)
+	}
+	if total == 0 {
+		return group[rnd.Intn(len(group))]
+	}
+	n := rnd.Intn(total)
+	for _, r := range group {
+		n -= int(r.Weight)
+		if n < 0 {
+			return r
+		}
+	}
+	return group[len(group)-1]
+}
@@ -0,0 +1,251 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type stubResolver struct {
+	mu      sync.Mutex
+	records []*net.SRV
+	err     error
+	calls   int
+	// block, if set, delays the lookups until it is closed.
+	block chan struct{}
+}
+
+func (s *stubResolver) LookupSRV(_ context.Context, _, _, _ string) (string, []*net.SRV, error) {
+	s.mu.Lock()
+	s.calls++
+	block := s.block
+	s.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return "", s.records, s.err
+}
+
+func (s *stubResolver) set(records []*net.SRV, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records, s.err = records, err
+}
+
+func (s *stubResolver) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestSRVRoundTripper(t *testing.T) {
+	resolver := &stubResolver{
+		records: []*net.SRV{
+			{Target: "backup.example.com.", Port: 4318, Priority: 20, Weight: 100},
+			{Target: "a.example.com.", Port: 4318, Priority: 10, Weight: 75},
+			{Target: "b.example.com.", Port: 4319, Priority: 10, Weight: 25},
+			{Target: "c.example.com.", Port: 4320, Priority: 10, Weight: 0},
+		},
+	}
+	hosts := map[string]int{}
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "https", req.URL.Scheme)
+		assert.Equal(t, "/v1/trace", req.URL.Path)
+		hosts[req.URL.Host]++
+		return &http.Response{StatusCode: 200}, nil
+	})
+	rt := newSRVRoundTripper(base, resolver.LookupSRV, time.Hour)
+
+	for i := 0; i < 1000; i++ {
+		req, err := http.NewRequest("POST", "dns+srv+https://_otlp._tcp.example.com/v1/trace", nil)
+		require.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, "dns+srv+https", req.URL.Scheme, "original request must not be modified")
+	}
+
+	assert.Equal(t, 1, resolver.calls)
+	assert.Zero(t, hosts["backup.example.com:4318"])
+	assert.Zero(t, hosts["c.example.com:4320"])
+	assert.Equal(t, 1000, hosts["a.example.com:4318"]+hosts["b.example.com:4319"])
+	assert.Greater(t, hosts["a.example.com:4318"], hosts["b.example.com:4319"])
+}
+
+func TestSRVRoundTripperRefresh(t *testing.T) {
+	resolver := &stubResolver{
+		records: []*net.SRV{{Target: "a.example.com.", Port: 4318}},
+	}
+	var gotHost string
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		gotHost = req.URL.Host
+		return &http.Response{StatusCode: 200}, nil
+	})
+	rt := newSRVRoundTripper(base, resolver.LookupSRV, time.Nanosecond)
+
+	doRequest := func() error {
+		req, err := http.NewRequest("POST", "dns+srv://_otlp._tcp.example.com", nil)
+		require.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		return err
+	}
+
+	require.NoError(t, doRequest())
+	assert.Equal(t, "a.example.com:4318", gotHost)
+
+	// The stale records are used while they are resolved again.
+	resolver.set([]*net.SRV{{Target: "b.example.com.", Port: 4318}}, nil)
+	time.Sleep(time.Millisecond)
+	require.NoError(t, doRequest())
+	assert.Equal(t, "a.example.com:4318", gotHost)
+	assert.Eventually(t, func() bool {
+		require.NoError(t, doRequest())
+		return gotHost == "b.example.com:4318"
+	}, time.Second, time.Millisecond)
+
+	// Failed refreshes keep using the last resolved records.
+	resolver.set(nil, errors.New("lookup failed"))
+	calls := resolver.callCount()
+	time.Sleep(time.Millisecond)
+	require.NoError(t, doRequest())
+	assert.Eventually(t, func() bool { return resolver.callCount() > calls }, time.Second, time.Millisecond)
+	require.NoError(t, doRequest())
+	assert.Equal(t, "b.example.com:4318", gotHost)
+}
+
+func TestSRVRoundTripperSlowLookup(t *testing.T) {
+	resolver := &stubResolver{
+		records: []*net.SRV{{Target: "a.example.com.", Port: 4318}},
+		block:   make(chan struct{}),
+	}
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200}, nil
+	})
+	rt := newSRVRoundTripper(base, resolver.LookupSRV, time.Nanosecond)
+	doRequest := func() error {
+		req, err := http.NewRequest("POST", "dns+srv://_otlp._tcp.example.com", nil)
+		require.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		return err
+	}
+
+	// The concurrent requests without records share the first lookup.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, doRequest())
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	resolver.mu.Lock()
+	close(resolver.block)
+	resolver.block = make(chan struct{})
+	resolver.mu.Unlock()
+	wg.Wait()
+	assert.Equal(t, 1, resolver.callCount())
+
+	// A slow refresh does not block the requests using the resolved records.
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, doRequest())
+	}
+	assert.Eventually(t, func() bool { return resolver.callCount() == 2 }, time.Second, time.Millisecond)
+	resolver.mu.Lock()
+	close(resolver.block)
+	resolver.mu.Unlock()
+}
+
+func TestHttpClientSRVEndpoint(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	resolver := &stubResolver{records: []*net.SRV{{Target: host + ".", Port: uint16(portNum)}}}
+	hcs := &HTTPClientSettings{Endpoint: "dns+srv://_otlp._tcp.example.com", lookupSRV: resolver.LookupSRV}
+	require.NoError(t, hcs.Validate())
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+	resp, err := client.Post(hcs.Endpoint+"/v1/traces", "application/x-protobuf", strings.NewReader("payload"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "/v1/traces", gotPath)
+	assert.Equal(t, 1, resolver.callCount())
+}
+
+func TestSRVRoundTripperError(t *testing.T) {
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatal("request must not be sent")
+		return nil, nil
+	})
+
+	rt := newSRVRoundTripper(base, (&stubResolver{err: errors.New("lookup failed")}).LookupSRV, 0)
+	req, err := http.NewRequest("POST", "dns+srv://_otlp._tcp.example.com", nil)
+	require.NoError(t, err)
+	_, err = rt.RoundTrip(req)
+	assert.EqualError(t, err, "failed to resolve SRV endpoint: lookup failed")
+
+	// The body is closed when the request is not sent.
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req, err = http.NewRequest("POST", "dns+srv://_otlp._tcp.example.com", body)
+	require.NoError(t, err)
+	_, err = rt.RoundTrip(req)
+	assert.Error(t, err)
+	assert.True(t, body.closed)
+
+	rt = newSRVRoundTripper(base, (&stubResolver{}).LookupSRV, 0)
+	_, err = rt.RoundTrip(req)
+	assert.EqualError(t, err, `failed to resolve SRV endpoint: no SRV records found for "_otlp._tcp.example.com"`)
+}
+
+// closeRecorder is a request body recording whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// unixScheme is the scheme of the endpoints of a Unix domain socket, whose
+	// path is the path of the socket, e.g. "unix:///run/otel/agent.sock".
+	unixScheme = "unix"
+
+	// unixHost is the host of the requests sent over a Unix domain socket.
+	unixHost = "localhost"
+)
+
+// unixSocketPath returns the path of the socket of a "unix" endpoint, or empty
+// if the endpoint is not a "unix" URL.
+func unixSocketPath(endpoint string) string {
+	if !strings.HasPrefix(endpoint, unixScheme+"://") {
+		return ""
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// validateUnixEndpoint checks that a "unix" endpoint has the path of the socket
+// and no host.
+func validateUnixEndpoint(endpoint string, u *url.URL) error {
+	if u.Host != "" || u.Path == "" {
+		return fmt.Errorf("invalid endpoint %q: must be unix:// followed by the absolute path of the socket", endpoint)
+	}
+	return nil
+}
+
+// unixDialContext returns the function dialing the socket whatever the address.
+func unixDialContext(dial dialContextFunc, socketPath string) dialContextFunc {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dial(ctx, "unix", socketPath)
+	}
+}
+
+// unixSocketRoundTripper sends the requests for the URLs of the "unix" endpoint,
+// the path of the socket followed by the path of the request, e.g.
+// "unix:///run/otel/agent.sock/v1/traces", as HTTP requests for the path of the
+// request, e.g. "http://localhost/v1/traces", to the transport dialing the
+// socket.
+type unixSocketRoundTripper struct {
+	transport  http.RoundTripper
+	socketPath string
+}
+
+func (rt *unixSocketRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != unixScheme {
+		return rt.transport.RoundTrip(req)
+	}
+	path := strings.TrimPrefix(req.URL.Path, rt.socketPath)
+	if len(path) == len(req.URL.Path) || (path != "" && path[0] != '/') {
+		closeRequestBody(req)
+		return nil, fmt.Errorf("request URL %q is not under the socket %q of the endpoint", req.URL, rt.socketPath)
+	}
+	if path == "" {
+		path = "/"
+	}
+	// A RoundTripper must not modify the request, see http.RoundTripper.
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "http"
+	r.URL.Host = unixHost
+	r.URL.Path = path
+	r.URL.RawPath = ""
+	if r.Host == "" {
+		r.Host = unixHost
+	}
+	return rt.transport.RoundTrip(r)
+}
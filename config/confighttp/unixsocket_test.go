@@ -0,0 +1,125 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confighttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpClientUnixSocketValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hcs     *HTTPClientSettings
+		wantErr string
+	}{
+		{
+			name: "valid",
+			hcs:  &HTTPClientSettings{Endpoint: "unix:///run/otel/agent.sock"},
+		},
+		{
+			name:    "no_path",
+			hcs:     &HTTPClientSettings{Endpoint: "unix://"},
+			wantErr: `invalid endpoint "unix://": must be unix:// followed by the absolute path of the socket`,
+		},
+		{
+			name:    "host",
+			hcs:     &HTTPClientSettings{Endpoint: "unix://run/otel/agent.sock"},
+			wantErr: `invalid endpoint "unix://run/otel/agent.sock": must be unix:// followed by the absolute path of the socket`,
+		},
+		{
+			name:    "local_addr",
+			hcs:     &HTTPClientSettings{Endpoint: "unix:///run/otel/agent.sock", LocalAddr: "10.0.0.1"},
+			wantErr: "local_addr cannot be used with a unix endpoint",
+		},
+		{
+			name:    "require_tls",
+			hcs:     &HTTPClientSettings{Endpoint: "unix:///run/otel/agent.sock", RequireTLS: true},
+			wantErr: `invalid endpoint "unix:///run/otel/agent.sock": require_tls requires an https endpoint`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hcs.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHttpClientUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confighttp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "agent.sock")
+
+	ln, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	var gotPath, gotHost, gotTenant, gotBody string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotHost, gotTenant = r.URL.Path, r.Host, r.Header.Get("X-Tenant")
+		body, errRead := ioutil.ReadAll(r.Body)
+		assert.NoError(t, errRead)
+		gotBody = string(body)
+	})}
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	defer server.Close()
+
+	hcs := &HTTPClientSettings{
+		Endpoint: "unix://" + socketPath,
+		Headers:  map[string]string{"X-Tenant": "a"},
+		Retry:    &RetrySettings{},
+	}
+	require.NoError(t, hcs.Validate())
+	require.NoError(t, hcs.Probe(context.Background()))
+	client, err := hcs.ToClient()
+	require.NoError(t, err)
+
+	resp, err := client.Post(hcs.Endpoint+"/v1/traces", "application/x-protobuf", strings.NewReader("payload"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/v1/traces", gotPath)
+	assert.Equal(t, "localhost", gotHost)
+	assert.Equal(t, "a", gotTenant)
+	assert.Equal(t, "payload", gotBody)
+
+	resp, err = client.Get(hcs.Endpoint)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "/", gotPath)
+
+	_, err = client.Get("unix:///run/other.sock/v1/traces")
+	assert.Error(t, err)
+	_, err = client.Get(hcs.Endpoint + "s/v1/traces")
+	assert.Error(t, err)
+
+	hcs = &HTTPClientSettings{Endpoint: "unix://" + filepath.Join(dir, "missing.sock")}
+	assert.Error(t, hcs.Probe(context.Background()))
+}
@@ -55,9 +55,17 @@ type TLSClientSetting struct {
 	// pr.
 	Insecure bool `mapstructure:"insecure"`
 	// ServerName requested by client for virtual hosting.
-	// This sets the ServerName in the TLSConfig. Please refer to
-	// https://godoc.org/crypto/tls#Config for more information. (optional)
+	// This sets the ServerName in the TLSConfig, which is also the host name
+	// verified against the server certificate, e.g. when the server is addressed
+	// by IP. The connections are still dialed to the host of the endpoint.
+	// Please refer to https://godoc.org/crypto/tls#Config for more
+	// information. (optional)
 	ServerName string `mapstructure:"server_name_override"`
+	// IncludeSystemCACertsPool verifies the server certificate against the system
+	// root CAs in addition to the CA of CAFile, instead of the CA of CAFile only.
+	// Ignored if CAFile is empty, the system root CAs are used then.
+	// (optional, default false)
+	IncludeSystemCACertsPool bool `mapstructure:"include_system_ca_certs_pool"`
 }
 
 // TLSServerSetting contains TLS configurations that are specific to server
@@ -69,9 +77,28 @@ type TLSServerSetting struct {
 	// These are config options specific to server connections.
 
 	// Path to the TLS cert to use by the server to verify a client certificate. (optional)
-	// This sets the ClientCAs and ClientAuth to RequireAndVerifyClientCert in the TLSConfig. Please refer to
+	// This sets the ClientCAs and ClientAuth to RequireAndVerifyClientCert in the TLSConfig,
+	// unless ClientAuthType is set. Please refer to
 	// https://godoc.org/crypto/tls#Config for more information. (optional)
 	ClientCAFile string `mapstructure:"client_ca_file"`
+
+	// ClientAuthType is the policy of the server for the TLS client authentication,
+	// one of "no_client_cert", "request_client_cert", "require_any_client_cert",
+	// "verify_client_cert_if_given" and "require_and_verify_client_cert", see
+	// tls.ClientAuthType. The policies verifying the client certificates require
+	// ClientCAFile. (optional, default "require_and_verify_client_cert" if
+	// ClientCAFile is set, "no_client_cert" otherwise)
+	ClientAuthType string `mapstructure:"client_auth_type"`
+}
+
+// clientAuthTypes maps the values of TLSServerSetting.ClientAuthType to the
+// tls.ClientAuthType.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"no_client_cert":                 tls.NoClientCert,
+	"request_client_cert":            tls.RequestClientCert,
+	"require_any_client_cert":        tls.RequireAnyClientCert,
+	"verify_client_cert_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify_client_cert": tls.RequireAndVerifyClientCert,
 }
 
 // LoadTLSConfig loads TLS certificates and returns a tls.Config.
@@ -109,12 +136,16 @@ func (c TLSSetting) loadTLSConfig() (*tls.Config, error) {
 }
 
 func (c TLSSetting) loadCert(caPath string) (*x509.CertPool, error) {
+	return appendCertsFromFile(x509.NewCertPool(), caPath)
+}
+
+// appendCertsFromFile appends the PEM certificates of the file to certPool.
+func appendCertsFromFile(certPool *x509.CertPool, caPath string) (*x509.CertPool, error) {
 	caPEM, err := ioutil.ReadFile(filepath.Clean(caPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load CA %s: %w", caPath, err)
 	}
 
-	certPool := x509.NewCertPool()
 	if !certPool.AppendCertsFromPEM(caPEM) {
 		return nil, fmt.Errorf("failed to parse CA %s", caPath)
 	}
@@ -131,6 +162,15 @@ func (c TLSClientSetting) LoadTLSConfig() (*tls.Config, error) {
 		return nil, fmt.Errorf("failed to load TLS config: %w", err)
 	}
 	tlsCfg.ServerName = c.ServerName
+	if c.IncludeSystemCACertsPool && c.CAFile != "" {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS config: failed to load system CA CertPool: %w", err)
+		}
+		if tlsCfg.RootCAs, err = appendCertsFromFile(certPool, c.CAFile); err != nil {
+			return nil, fmt.Errorf("failed to load TLS config: failed to load CA CertPool: %w", err)
+		}
+	}
 	return tlsCfg, nil
 }
 
@@ -147,5 +187,15 @@ func (c TLSServerSetting) LoadTLSConfig() (*tls.Config, error) {
 		tlsCfg.ClientCAs = certPool
 		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
 	}
+	if c.ClientAuthType != "" {
+		clientAuth, ok := clientAuthTypes[c.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("failed to load TLS config: unsupported client_auth_type %q", c.ClientAuthType)
+		}
+		if clientAuth >= tls.VerifyClientCertIfGiven && tlsCfg.ClientCAs == nil {
+			return nil, fmt.Errorf("failed to load TLS config: client_auth_type %q requires client_ca_file", c.ClientAuthType)
+		}
+		tlsCfg.ClientAuth = clientAuth
+	}
 	return tlsCfg, nil
 }
@@ -15,6 +15,8 @@
 package configtls
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -148,6 +150,45 @@ func TestLoadTLSClientConfig(t *testing.T) {
 	assert.NotNil(t, tlsCfg)
 }
 
+func TestLoadTLSClientConfigSystemCACertsPool(t *testing.T) {
+	systemPool, err := x509.SystemCertPool()
+	require.NoError(t, err)
+	systemCount := len(systemPool.Subjects())
+
+	tests := []struct {
+		name          string
+		includeSystem bool
+		caFile        string
+		wantCount     int
+	}{
+		{name: "custom_only", caFile: "testdata/testCA.pem", wantCount: 1},
+		{name: "system_and_custom", includeSystem: true, caFile: "testdata/testCA.pem", wantCount: systemCount + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsSetting := TLSClientSetting{
+				TLSSetting:               TLSSetting{CAFile: tt.caFile},
+				IncludeSystemCACertsPool: tt.includeSystem,
+			}
+			tlsCfg, err := tlsSetting.LoadTLSConfig()
+			require.NoError(t, err)
+			require.NotNil(t, tlsCfg.RootCAs)
+			assert.Len(t, tlsCfg.RootCAs.Subjects(), tt.wantCount)
+		})
+	}
+
+	// Without CA file the system root CAs are used by crypto/tls.
+	tlsCfg, err := TLSClientSetting{IncludeSystemCACertsPool: true}.LoadTLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, tlsCfg.RootCAs)
+
+	_, err = TLSClientSetting{
+		TLSSetting:               TLSSetting{CAFile: "testdata/testCA-bad.txt"},
+		IncludeSystemCACertsPool: true,
+	}.LoadTLSConfig()
+	assert.Error(t, err)
+}
+
 func TestLoadTLSServerConfigError(t *testing.T) {
 	tlsSetting := TLSServerSetting{
 		TLSSetting: TLSSetting{
@@ -171,3 +212,53 @@ func TestLoadTLSServerConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, tlsCfg)
 }
+
+func TestLoadTLSServerConfigClientAuthType(t *testing.T) {
+	tests := []struct {
+		clientCAFile   string
+		clientAuthType string
+		want           tls.ClientAuthType
+		wantErr        string
+	}{
+		{
+			want: tls.NoClientCert,
+		},
+		{
+			clientCAFile: "testdata/testCA.pem",
+			want:         tls.RequireAndVerifyClientCert,
+		},
+		{
+			clientCAFile:   "testdata/testCA.pem",
+			clientAuthType: "verify_client_cert_if_given",
+			want:           tls.VerifyClientCertIfGiven,
+		},
+		{
+			clientAuthType: "request_client_cert",
+			want:           tls.RequestClientCert,
+		},
+		{
+			clientAuthType: "require_and_verify_client_cert",
+			wantErr:        `failed to load TLS config: client_auth_type "require_and_verify_client_cert" requires client_ca_file`,
+		},
+		{
+			clientCAFile:   "testdata/testCA.pem",
+			clientAuthType: "always",
+			wantErr:        `failed to load TLS config: unsupported client_auth_type "always"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.clientAuthType, func(t *testing.T) {
+			tlsSetting := TLSServerSetting{
+				ClientCAFile:   test.clientCAFile,
+				ClientAuthType: test.clientAuthType,
+			}
+			tlsCfg, err := tlsSetting.LoadTLSConfig()
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, tlsCfg.ClientAuth)
+		})
+	}
+}
@@ -6,6 +6,7 @@ require (
 	contrib.go.opencensus.io/exporter/prometheus v0.2.0
 	github.com/OneOfOne/xxhash v1.2.5 // indirect
 	github.com/Shopify/sarama v1.27.0
+	github.com/andybalholm/brotli v1.0.0
 	github.com/apache/thrift v0.13.0
 	github.com/cenkalti/backoff v2.2.1+incompatible
 	github.com/census-instrumentation/opencensus-proto v0.3.0
@@ -32,6 +33,7 @@ require (
 	github.com/jaegertracing/jaeger v1.19.2
 	github.com/joshdk/go-junit v0.0.0-20200702055522-6efcf4050909
 	github.com/jstemmer/go-junit-report v0.9.1
+	github.com/klauspost/compress v1.10.10
 	github.com/mjibson/esc v0.2.0
 	github.com/openzipkin/zipkin-go v0.2.4-0.20200818204336-dc18516bbb4c
 	github.com/orijtech/prometheus-go-metrics-exporter v0.0.5
@@ -0,0 +1,286 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCaptureMaxBodySize = 64 << 10
+	defaultCaptureMaxFiles    = 100
+	defaultCaptureRate        = 10
+	defaultCaptureInterval    = time.Minute
+
+	captureFilePrefix = "capture-"
+	captureFileSuffix = ".http"
+	redactedValue     = "[REDACTED]"
+)
+
+// defaultRedactedHeaders are the headers always redacted from the captures.
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+type bodyCapture struct {
+	dir         string
+	maxBodySize int64
+	maxFiles    int
+	rate        int
+	interval    time.Duration
+	redacted    map[string]bool
+	logger      *zap.Logger
+
+	mu          sync.Mutex
+	windowStart time.Time
+	captures    int
+
+	// writeMu serializes the writes, so that the number of files is not
+	// exceeded by concurrent captures.
+	writeMu sync.Mutex
+	seq     uint64
+}
+
+type BodyCaptureOption func(c *bodyCapture)
+
+// WithCaptureMaxBodySize sets the maximum number of bytes of the body written
+// to each capture, the rest of the body is dropped. Non positive values keep the
+// default of 64KiB.
+func WithCaptureMaxBodySize(size int64) BodyCaptureOption {
+	return func(c *bodyCapture) {
+		if size > 0 {
+			c.maxBodySize = size
+		}
+	}
+}
+
+// WithCaptureMaxFiles sets the maximum number of captures kept in the
+// directory, the oldest ones are removed first. Non positive values keep the
+// default of 100.
+func WithCaptureMaxFiles(files int) BodyCaptureOption {
+	return func(c *bodyCapture) {
+		if files > 0 {
+			c.maxFiles = files
+		}
+	}
+}
+
+// WithCaptureRate sets the maximum number of captures written during each
+// interval, the other rejected requests are not captured. Non positive values
+// keep the defaults of 10 captures per minute.
+func WithCaptureRate(captures int, interval time.Duration) BodyCaptureOption {
+	return func(c *bodyCapture) {
+		if captures > 0 {
+			c.rate = captures
+		}
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// WithRedactedHeaders sets the request headers whose values are replaced by
+// "[REDACTED]" in the captures, in addition to the Authorization,
+// Proxy-Authorization and Cookie headers.
+func WithRedactedHeaders(headers []string) BodyCaptureOption {
+	return func(c *bodyCapture) {
+		for _, h := range headers {
+			c.redacted[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// WithCaptureLogger sets the logger reporting the written captures and the
+// failures to write them.
+func WithCaptureLogger(logger *zap.Logger) BodyCaptureOption {
+	return func(c *bodyCapture) {
+		c.logger = logger
+	}
+}
+
+// BodyCapture is a middleware that writes the requests rejected by the handler
+// with a 400 status, the status of the payloads failing to be decoded or
+// validated, to files of dir, so that they can be reproduced. Each capture holds
+// the request line, the headers, with the sensitive ones redacted, and the
+// bytes of the body read by the handler, after their decompression when the
+// middleware is called by the decompressor, up to the maximum body size. The
+// disk usage is bounded by the maximum number of files and the writes by the
+// capture rate. The failures to write the captures are logged and do not change
+// the responses.
+func BodyCapture(h http.Handler, dir string, opts ...BodyCaptureOption) http.Handler {
+	c := &bodyCapture{
+		dir:         dir,
+		maxBodySize: defaultCaptureMaxBodySize,
+		maxFiles:    defaultCaptureMaxFiles,
+		rate:        defaultCaptureRate,
+		interval:    defaultCaptureInterval,
+		redacted:    map[string]bool{},
+		logger:      zap.NewNop(),
+	}
+	for _, name := range defaultRedactedHeaders {
+		c.redacted[name] = true
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c.wrap(h)
+}
+
+func (c *bodyCapture) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The bodies are not buffered while no capture can be written.
+		if r.Body == nil || r.Body == http.NoBody || !c.available(time.Now()) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body := &captureReader{ReadCloser: r.Body, max: c.maxBodySize}
+		r.Body = body
+		sr := NewStatusRecorder(w)
+		h.ServeHTTP(sr, r)
+		if sr.Status() != http.StatusBadRequest || !c.take(time.Now()) {
+			return
+		}
+		if err := c.write(r, body); err != nil {
+			c.logger.Warn("Failed to capture the body of a rejected request", zap.String("path", r.URL.Path), zap.Error(err))
+		}
+	})
+}
+
+// available reports whether a capture can be written during the current
+// interval.
+func (c *bodyCapture) available(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.startWindow(now)
+	return c.captures < c.rate
+}
+
+// take consumes a capture of the current interval, if any.
+func (c *bodyCapture) take(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.startWindow(now)
+	if c.captures >= c.rate {
+		return false
+	}
+	c.captures++
+	return true
+}
+
+// startWindow starts a new interval once the current one is over. Must be called
+// with the lock held.
+func (c *bodyCapture) startWindow(now time.Time) {
+	if now.Sub(c.windowStart) >= c.interval {
+		c.windowStart = now
+		c.captures = 0
+	}
+}
+
+// write writes the capture of the request to a new file of the directory, after
+// removing the oldest captures over the maximum number of files.
+func (c *bodyCapture) write(r *http.Request, body *captureReader) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	if err := c.prune(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s %s\r\n", r.Method, r.URL.Path, r.Proto)
+	header := r.Header.Clone()
+	for name := range header {
+		if c.redacted[name] {
+			header[name] = []string{redactedValue}
+		}
+	}
+	if err := header.Write(&buf); err != nil {
+		return err
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.buf.Bytes())
+
+	c.seq++
+	name := fmt.Sprintf("%s%s-%06d%s", captureFilePrefix, time.Now().UTC().Format("20060102T150405.000000000Z"), c.seq%1000000, captureFileSuffix)
+	path := filepath.Join(c.dir, name)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	c.logger.Info(
+		"Captured the body of a rejected request",
+		zap.String("path", r.URL.Path),
+		zap.String("file", path),
+		zap.Int("body_bytes", body.buf.Len()),
+		zap.Bool("truncated", body.truncated),
+	)
+	return nil
+}
+
+// prune removes the oldest captures of the directory so that a new one can be
+// written without exceeding the maximum number of files. The names of the
+// captures sort by their creation time.
+func (c *bodyCapture) prune() error {
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), captureFilePrefix) && strings.HasSuffix(e.Name(), captureFileSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) >= c.maxFiles {
+		if err := os.Remove(filepath.Join(c.dir, names[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// captureReader keeps the first max bytes read from the body.
+type captureReader struct {
+	io.ReadCloser
+	max       int64
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (cr *captureReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	if n > 0 {
+		keep := int64(n)
+		if room := cr.max - int64(cr.buf.Len()); keep > room {
+			keep = room
+			cr.truncated = true
+		}
+		cr.buf.Write(p[:keep])
+	}
+	return n, err
+}
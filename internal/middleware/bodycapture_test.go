@@ -0,0 +1,127 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rejectingHandler reads the request body and rejects the requests with the
+// "bad" body with a 400 status.
+var rejectingHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if strings.HasPrefix(string(body), "bad") {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+	}
+})
+
+func captureDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bodycapture")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "captures")
+}
+
+func readCaptures(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, captureFilePrefix+"*"+captureFileSuffix))
+	require.NoError(t, err)
+	captures := make([]string, 0, len(files))
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		require.NoError(t, err)
+		captures = append(captures, string(data))
+	}
+	return captures
+}
+
+func sendCaptured(h http.Handler, body string) int {
+	req := httptest.NewRequest("POST", "/v1/traces?token=secret", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestBodyCapture(t *testing.T) {
+	dir := captureDir(t)
+	h := BodyCapture(rejectingHandler, dir, WithRedactedHeaders([]string{"x-api-key"}))
+
+	assert.Equal(t, http.StatusOK, sendCaptured(h, "good payload"))
+	assert.Equal(t, http.StatusBadRequest, sendCaptured(h, "bad payload"))
+
+	captures := readCaptures(t, dir)
+	require.Len(t, captures, 1)
+	assert.Equal(t, "POST /v1/traces HTTP/1.1\r\n"+
+		"Authorization: [REDACTED]\r\n"+
+		"Content-Type: application/json\r\n"+
+		"X-Api-Key: [REDACTED]\r\n"+
+		"\r\n"+
+		"bad payload", captures[0])
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
+
+func TestBodyCaptureMaxBodySize(t *testing.T) {
+	dir := captureDir(t)
+	h := BodyCapture(rejectingHandler, dir, WithCaptureMaxBodySize(5))
+
+	assert.Equal(t, http.StatusBadRequest, sendCaptured(h, "bad payload"))
+	captures := readCaptures(t, dir)
+	require.Len(t, captures, 1)
+	assert.True(t, strings.HasSuffix(captures[0], "\r\n\r\nbad p"), captures[0])
+}
+
+func TestBodyCaptureMaxFiles(t *testing.T) {
+	dir := captureDir(t)
+	h := BodyCapture(rejectingHandler, dir, WithCaptureMaxFiles(2))
+
+	for _, body := range []string{"bad 1", "bad 2", "bad 3"} {
+		assert.Equal(t, http.StatusBadRequest, sendCaptured(h, body))
+	}
+	captures := readCaptures(t, dir)
+	require.Len(t, captures, 2)
+	assert.True(t, strings.HasSuffix(captures[0], "bad 2"))
+	assert.True(t, strings.HasSuffix(captures[1], "bad 3"))
+}
+
+func TestBodyCaptureRate(t *testing.T) {
+	dir := captureDir(t)
+	h := BodyCapture(rejectingHandler, dir, WithCaptureRate(2, time.Hour))
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusBadRequest, sendCaptured(h, "bad payload"))
+	}
+	assert.Len(t, readCaptures(t, dir), 2)
+
+	c := &bodyCapture{rate: 1, interval: time.Minute}
+	now := time.Now()
+	assert.True(t, c.take(now))
+	assert.False(t, c.available(now.Add(59*time.Second)))
+	assert.True(t, c.take(now.Add(time.Minute)))
+}
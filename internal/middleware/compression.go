@@ -15,16 +15,40 @@
 package middleware
 
 import (
+	"bufio"
 	"compress/gzip"
 	"compress/zlib"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/stats/view"
+	"go.uber.org/zap"
 )
 
 type ErrorHandler func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int)
 
+// defaultReadAheadSize is the default size of the buffer batching the reads of
+// compressed request bodies.
+const defaultReadAheadSize = 32 * 1024
+
 type decompressor struct {
-	errorHandler ErrorHandler
+	errorHandler     ErrorHandler
+	slots            chan struct{}
+	readAheadSize    int
+	sniffCompression bool
+	lenientGzipLog   *zap.Logger
+	logger           *zap.Logger
+	meter            view.Meter
+	maxLengthHint    int64
+	encodings        *encodingFilter
+	// supported lists the encodings decompressed, for the rejections.
+	supported []string
 }
 
 type DecompressorOption func(d *decompressor)
@@ -35,58 +59,354 @@ func WithErrorHandler(e ErrorHandler) DecompressorOption {
 	}
 }
 
+// WithReadAheadSize sets the size of the buffer wrapping the compressed request
+// bodies, so that the decompressor reads the body in chunks of up to size bytes.
+// Larger buffers improve the throughput on large payloads. Non positive values
+// keep the default of 32KiB.
+func WithReadAheadSize(size int) DecompressorOption {
+	return func(d *decompressor) {
+		if size > 0 {
+			d.readAheadSize = size
+		}
+	}
+}
+
+// WithSniffCompression enables the detection of the gzip and zstd bodies of the
+// requests without "Content-Encoding" header, by their first bytes. This is
+// opt-in since an uncompressed body, e.g. binary protobuf, may start with the
+// same bytes.
+func WithSniffCompression(sniff bool) DecompressorOption {
+	return func(d *decompressor) {
+		d.sniffCompression = sniff
+	}
+}
+
+// WithLenientGzip enables a lenient decoding of the gzip bodies, for the clients
+// appending extra bytes after the gzip stream: only the first gzip member of the
+// body is decompressed and the bytes after it, up to 64KiB, are discarded with a
+// warning logged with logger, instead of failing the request. The bodies made of
+// several gzip members are truncated to the first one, so this is opt-in.
+// Disabled if logger is nil.
+func WithLenientGzip(logger *zap.Logger) DecompressorOption {
+	return func(d *decompressor) {
+		d.lenientGzipLog = logger
+	}
+}
+
 // HTTPContentDecompressor is a middleware that offloads the task of handling compressed
 // HTTP requests by identifying the compression format in the "Content-Encoding" header and re-writing
 // request body so that the handlers further in the chain can work on decompressed data.
-// It supports gzip and deflate/zlib compression.
+// It supports gzip, deflate/zlib and zstd compression, and brotli when built with
+// the "brotli" build tag. The bodies encoded several times, with the encodings
+// listed in the order they were applied (e.g.: "gzip, zstd"), are decoded in
+// the reverse order. The requests with another encoding are rejected with
+// a 501 status, an UnsupportedEncodingError message listing the supported
+// encodings and the same list in the "Accept-Encoding" header of the response.
+// The requests without encoding or with the "identity" encoding are passed as
+// is, the "identity" encoding is removed from their "Content-Encoding" header.
 func HTTPContentDecompressor(h http.Handler, opts ...DecompressorOption) http.Handler {
-	d := &decompressor{}
+	d := &decompressor{readAheadSize: defaultReadAheadSize}
 	for _, o := range opts {
 		o(d)
 	}
 	if d.errorHandler == nil {
 		d.errorHandler = defaultErrorHandler
 	}
+	if d.encodings != nil {
+		d.supported = d.encodings.accepted
+	} else {
+		d.supported = supportedEncodings(func(string) bool { return true })
+	}
 	return d.wrap(h)
 }
 
 func (d *decompressor) wrap(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		newBody, err := newBodyReader(r)
+		var metrics *decompressionMetrics
+		if d.meter != nil {
+			metrics = &decompressionMetrics{}
+		}
+		newBody, err := d.newBodyReader(r, metrics)
+		var notAccepted *encodingNotAcceptedError
+		if errors.As(err, &notAccepted) {
+			recordRejection(r, RejectionReasonUnsupportedEncoding)
+			w.Header().Set("Accept-Encoding", strings.Join(notAccepted.accepted, ", "))
+			d.errorHandler(w, r, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		var unsupported *UnsupportedEncodingError
+		if errors.As(err, &unsupported) {
+			recordRejection(r, RejectionReasonUnsupportedEncoding)
+			supported := strings.Join(unsupported.Supported, ", ")
+			w.Header().Set("Accept-Encoding", supported)
+			d.errorHandler(w, r, fmt.Sprintf("%s, supported encodings: %s", err, supported), http.StatusNotImplemented)
+			return
+		}
+		if errors.Is(err, errTooManyDecompressions) {
+			recordRejection(r, RejectionReasonDecompressionLimit)
+			d.errorHandler(w, r, err.Error(), http.StatusTooManyRequests)
+			return
+		}
 		if err != nil {
+			if metrics != nil {
+				metrics.err = err
+				metrics.record(r.Context(), d.meter)
+			}
+			recordRejection(r, RejectionReasonDecompressionFailure)
 			d.errorHandler(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 		if newBody != nil {
 			defer newBody.Close()
+			if metrics != nil {
+				newBody = &metricsReadCloser{ReadCloser: newBody, metrics: metrics}
+				defer metrics.record(r.Context(), d.meter)
+			}
+			if stats, ok := requestStatsFromContext(r.Context()); ok {
+				stats.decompressed = true
+				newBody = &countingReadCloser{ReadCloser: newBody, n: &stats.decompressedBytes}
+			}
 			// "Content-Encoding" header is removed to avoid decompressing twice
 			// in case the next handler(s) have implemented a similar mechanism.
 			r.Header.Del("Content-Encoding")
-			// "Content-Length" is set to -1 as the size of the decompressed body is unknown.
+			// "Content-Length" is set to -1 as the size of the decompressed body is
+			// unknown, both for the bodies sent with a length and the chunked ones.
 			r.Header.Del("Content-Length")
 			r.ContentLength = -1
+			if length, ok := d.uncompressedLength(r); ok {
+				newBody = &exactLengthReadCloser{ReadCloser: newBody, length: length, remaining: length}
+				r.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+				r.ContentLength = length
+			}
 			r.Body = newBody
 		}
 		h.ServeHTTP(w, r)
 	})
 }
 
-func newBodyReader(r *http.Request) (io.ReadCloser, error) {
-	switch r.Header.Get("Content-Encoding") {
-	case "gzip":
-		gr, err := gzip.NewReader(r.Body)
-		if err != nil {
+// decoders maps the supported "Content-Encoding" values to the function wrapping
+// the request body in a decompressing reader. Encodings relying on additional
+// dependencies are registered by files built with the matching build tag.
+var decoders = map[string]func(body io.Reader) (io.ReadCloser, error){
+	"gzip":    newGzipReader,
+	"deflate": newZlibReader,
+	"zlib":    newZlibReader,
+}
+
+// DecompressReader returns a reader decompressing r according to encoding, a
+// "Content-Encoding" value supported by HTTPContentDecompressor, or an error if
+// the encoding is not supported or the beginning of r is not valid. The reader
+// must be closed once read to release its resources, e.g. the pooled gzip
+// readers, it does not close r. The "identity" encoding returns r as is. The
+// encodings are case-insensitive.
+func DecompressReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	if strings.EqualFold(encoding, "identity") {
+		return ioutil.NopCloser(r), nil
+	}
+	decoder, ok := decoders[strings.ToLower(encoding)]
+	if !ok {
+		return nil, &UnsupportedEncodingError{Encoding: encoding, Supported: supportedEncodings(func(string) bool { return true })}
+	}
+	return decoder(r)
+}
+
+// gzipReaderPool holds the gzip readers of the bodies fully decompressed, to be
+// reset on new bodies.
+var gzipReaderPool sync.Pool
+
+var errReaderClosed = errors.New("read on closed gzip reader")
+
+// pooledGzipReader is a gzip reader taken from gzipReaderPool and put back in the
+// pool when it is closed, unless the body was not read until its end without
+// error: the reader of a partially read or a corrupted body is discarded.
+type pooledGzipReader struct {
+	zr  *gzip.Reader
+	eof bool
+}
+
+func newGzipReader(body io.Reader) (io.ReadCloser, error) {
+	if zr, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(body); err != nil {
 			return nil, err
 		}
-		return gr, nil
-	case "deflate", "zlib":
-		zr, err := zlib.NewReader(r.Body)
-		if err != nil {
-			return nil, err
+		return &pooledGzipReader{zr: zr}, nil
+	}
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledGzipReader{zr: zr}, nil
+}
+
+func (r *pooledGzipReader) Read(p []byte) (int, error) {
+	if r.zr == nil {
+		return 0, errReaderClosed
+	}
+	n, err := r.zr.Read(p)
+	r.eof = err == io.EOF
+	return n, err
+}
+
+func (r *pooledGzipReader) Close() error {
+	if r.zr == nil {
+		return nil
+	}
+	err := r.zr.Close()
+	if r.eof && err == nil {
+		gzipReaderPool.Put(r.zr)
+	}
+	r.zr = nil
+	return err
+}
+
+func newZlibReader(body io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(body)
+}
+
+// newBodyReader returns the decompressing reader of the request body, or nil if
+// the body is not compressed. The encoding and the compressed bytes are
+// collected in metrics if not nil.
+func (d *decompressor) newBodyReader(r *http.Request, metrics *decompressionMetrics) (io.ReadCloser, error) {
+	header := r.Header.Get("Content-Encoding")
+	encodings := parseContentEncodings(header)
+	for _, encoding := range encodings {
+		if d.encodings != nil && !d.encodings.accepts(encoding) {
+			return nil, &encodingNotAcceptedError{encoding: encoding, accepted: d.encodings.accepted}
+		}
+		if _, ok := decoders[encoding]; !ok {
+			return nil, &UnsupportedEncodingError{Encoding: encoding, Supported: d.supported}
+		}
+	}
+	// The bodies with the "identity" encoding are not sniffed.
+	sniff := len(encodings) == 0 && strings.TrimSpace(header) == "" && d.sniffCompression && r.Body != http.NoBody
+	if len(encodings) == 0 && !sniff {
+		// The body is not encoded, the next handlers do not have to recognize
+		// the "identity" encoding.
+		r.Header.Del("Content-Encoding")
+		return nil, nil
+	}
+	if !d.acquireSlot() {
+		return nil, errTooManyDecompressions
+	}
+	body, err := d.newDecodingReader(r, encodings, sniff, metrics)
+	if err != nil || body == nil {
+		d.releaseSlot()
+		return body, err
+	}
+	return d.withSlot(body), nil
+}
+
+// newDecodingReader returns the decoding reader of the request body with the
+// given encodings, or sniffed, or nil if the sniffed body is not compressed.
+func (d *decompressor) newDecodingReader(r *http.Request, encodings []string, sniff bool, metrics *decompressionMetrics) (io.ReadCloser, error) {
+	var src io.Reader = r.Body
+	if metrics != nil {
+		src = &countingReadCloser{ReadCloser: r.Body, n: &metrics.compressedBytes}
+	}
+	body := bufio.NewReaderSize(src, d.readAheadSize)
+	if sniff {
+		var encoding string
+		switch {
+		case isGzip(body):
+			encoding = "gzip"
+		case isZstd(body):
+			encoding = "zstd"
+		default:
+			// The sniffed bytes are buffered, the body is read from the buffer.
+			r.Body = &bufferedReadCloser{Reader: body, Closer: r.Body}
+			return nil, nil
+		}
+		if d.encodings != nil && !d.encodings.accepts(encoding) {
+			return nil, &encodingNotAcceptedError{encoding: encoding, accepted: d.encodings.accepted}
+		}
+		encodings = []string{encoding}
+	}
+	if metrics != nil {
+		metrics.encoding = strings.Join(encodings, ",")
+	}
+	var decoded io.ReadCloser
+	var err error
+	switch {
+	case len(encodings) > 1:
+		decoded, err = newStackedDecompressReader(body, encodings)
+	case encodings[0] == "gzip" && d.lenientGzipLog != nil:
+		decoded, err = newLenientGzipReader(body, d.lenientGzipLog.With(zap.String("path", r.URL.Path)))
+	default:
+		decoded, err = DecompressReader(encodings[0], body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &decompressionErrorReader{
+		ReadCloser: decoded,
+		encoding:   strings.Join(encodings, ", "),
+		path:       r.URL.Path,
+		logger:     d.logger,
+	}, nil
+}
+
+// maxLenientGzipTrailingBytes is the maximum number of bytes discarded after the
+// gzip stream by lenientGzipReader, the bodies with more trailing bytes fail.
+const maxLenientGzipTrailingBytes = 64 << 10
+
+// errTooManyTrailingBytes is returned by lenientGzipReader past the discarded bytes.
+var errTooManyTrailingBytes = errors.New("too many trailing bytes after the gzip stream of the request body")
+
+// lenientGzipReader decompresses the first gzip member of the body and discards
+// the bytes after it, see WithLenientGzip. It is not pooled since the reset of
+// a pooled reader restores the multistream mode.
+type lenientGzipReader struct {
+	zr     *gzip.Reader
+	body   *bufio.Reader
+	logger *zap.Logger
+	err    error
+}
+
+func newLenientGzipReader(body *bufio.Reader, logger *zap.Logger) (io.ReadCloser, error) {
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	zr.Multistream(false)
+	return &lenientGzipReader{zr: zr, body: body, logger: logger}, nil
+}
+
+func (r *lenientGzipReader) Read(p []byte) (int, error) {
+	n, err := r.zr.Read(p)
+	if err == io.EOF && r.logger != nil {
+		// The trailing bytes are only counted once, at the end of the member.
+		trailing, _ := io.CopyN(ioutil.Discard, r.body, maxLenientGzipTrailingBytes+1)
+		logger := r.logger
+		r.logger = nil
+		if trailing > maxLenientGzipTrailingBytes {
+			r.err = errTooManyTrailingBytes
+			return n, r.err
+		}
+		if trailing > 0 {
+			logger.Warn("Discarded the trailing bytes after the gzip stream of the request body",
+				zap.Int64("trailing_bytes", trailing))
 		}
-		return zr, nil
 	}
-	return nil, nil
+	if r.err != nil && err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func (r *lenientGzipReader) Close() error {
+	return r.zr.Close()
+}
+
+// isGzip returns whether the buffered body starts with the magic number of the
+// gzip format followed by the deflate compression method, see RFC 1952.
+func isGzip(body *bufio.Reader) bool {
+	header, err := body.Peek(3)
+	return err == nil && header[0] == 0x1f && header[1] == 0x8b && header[2] == 8
+}
+
+type bufferedReadCloser struct {
+	io.Reader
+	io.Closer
 }
 
 // defaultErrorHandler writes the error message in plain text.
@@ -0,0 +1,40 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build brotli
+
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	decoders["br"] = newBrotliReader
+}
+
+func newBrotliReader(body io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(brotli.NewReader(body))
+	// Unlike gzip and zlib the brotli format has no header validated when the
+	// reader is created, decode the beginning of the stream so that invalid
+	// bodies are rejected with a 400 status before reaching the next handler.
+	if _, err := br.Peek(1); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return ioutil.NopCloser(br), nil
+}
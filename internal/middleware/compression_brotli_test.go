@@ -0,0 +1,72 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build brotli
+
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPContentDecompressionHandlerBrotli(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	var compressed bytes.Buffer
+	bw := brotli.NewWriter(&compressed)
+	_, err := bw.Write(testBody)
+	require.NoError(t, err)
+	require.NoError(t, bw.Close())
+
+	tests := []struct {
+		name     string
+		body     []byte
+		respCode int
+	}{
+		{
+			name:     "ValidBrotli",
+			body:     compressed.Bytes(),
+			respCode: 200,
+		},
+		{
+			name:     "InvalidBrotli",
+			body:     testBody,
+			respCode: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Empty(t, r.Header.Get("Content-Encoding"))
+				body, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, testBody, body)
+				w.WriteHeader(200)
+			})
+
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", "br")
+			rec := httptest.NewRecorder()
+			HTTPContentDecompressor(handler).ServeHTTP(rec, req)
+			assert.Equal(t, tt.respCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// responseEncoder compresses the response bodies with writers reset on each
+// response, kept in a pool so that they are not allocated for each response.
+type responseEncoder struct {
+	pool sync.Pool
+}
+
+// resettableWriter is implemented by gzip.Writer and zlib.Writer.
+type resettableWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// responseEncoders are the encoders of the response bodies by Content-Encoding,
+// in order of preference when the client accepts them equally.
+var responseEncoders = []struct {
+	encoding string
+	encoder  *responseEncoder
+}{
+	{encoding: "gzip", encoder: &responseEncoder{pool: sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}}},
+	{encoding: "deflate", encoder: &responseEncoder{pool: sync.Pool{New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}}}},
+}
+
+// ResponseCompressor is a middleware that compresses the response bodies of
+// the next handler(s) with the gzip or deflate encoding accepted in the
+// "Accept-Encoding" header of the request. The responses already encoded, the
+// responses without body and the ones to the HEAD requests are not compressed.
+// The compressing writers are pooled: a writer is taken on the first write of
+// a body and put back once the response is complete, unless writing the
+// response failed or the handler panicked, since its state is then unknown.
+func ResponseCompressor(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding, encoder := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoder == nil || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{StatusRecorder: NewStatusRecorder(w), encoding: encoding, encoder: encoder}
+		h.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality in
+// the "Accept-Encoding" header, or nil if none is accepted.
+func negotiateEncoding(accept string) (string, *responseEncoder) {
+	var best *responseEncoder
+	bestEncoding, bestQ := "", 0.0
+	for _, e := range responseEncoders {
+		// The first encoders are kept on ties.
+		if q := acceptedQuality(accept, e.encoding); q > bestQ {
+			best, bestEncoding, bestQ = e.encoder, e.encoding, q
+		}
+	}
+	return bestEncoding, best
+}
+
+// acceptedQuality returns the quality of encoding in the "Accept-Encoding"
+// header, the one of "*" when it is not listed, or 0 if it is not accepted.
+func acceptedQuality(accept, encoding string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, q := strings.TrimSpace(part), 1.0
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			params := strings.TrimSpace(name[i+1:])
+			name = strings.TrimSpace(name[:i])
+			if strings.HasPrefix(params, "q=") {
+				v, err := strconv.ParseFloat(params[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		switch {
+		case strings.EqualFold(name, encoding):
+			return q
+		case name == "*":
+			wildcard = q
+		}
+	}
+	return wildcard
+}
+
+// compressWriter delays the headers until the first write of the body, or the
+// end of the response, to only compress the responses with a body.
+type compressWriter struct {
+	*StatusRecorder
+	encoding string
+	encoder  *responseEncoder
+
+	status      int
+	wroteHeader bool
+	zw          resettableWriter
+	failed      bool
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.status != 0 {
+		return
+	}
+	// The informational responses are sent as is.
+	if statusCode >= 100 && statusCode < 200 {
+		w.StatusRecorder.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+}
+
+// sendHeader sends the delayed headers, with the compression enabled if compress
+// is set and the response can be compressed.
+func (w *compressWriter) sendHeader(compress bool) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		w.zw = w.encoder.pool.Get().(resettableWriter)
+		w.zw.Reset(w.StatusRecorder)
+	}
+	w.StatusRecorder.WriteHeader(w.status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 && !w.wroteHeader {
+		return 0, nil
+	}
+	w.sendHeader(true)
+	if w.zw == nil {
+		return w.StatusRecorder.Write(b)
+	}
+	n, err := w.zw.Write(b)
+	if err != nil {
+		w.failed = true
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher, used by the grpc-gateway for streaming
+// responses: the bytes compressed so far are sent.
+func (w *compressWriter) Flush() {
+	w.sendHeader(true)
+	if w.zw != nil {
+		if err := w.zw.Flush(); err != nil {
+			w.failed = true
+		}
+	}
+	w.StatusRecorder.Flush()
+}
+
+// close completes the response once the handler returned: the headers of the
+// responses without body are sent uncompressed, and the writer is put back in
+// the pool if the response was written without error.
+func (w *compressWriter) close() {
+	w.sendHeader(false)
+	if w.zw == nil {
+		return
+	}
+	if err := w.zw.Close(); err != nil {
+		w.failed = true
+	}
+	if !w.failed {
+		// The pooled writer must not keep the response.
+		w.zw.Reset(ioutil.Discard)
+		w.encoder.pool.Put(w.zw)
+	}
+	w.zw = nil
+}
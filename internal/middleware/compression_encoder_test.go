@@ -0,0 +1,262 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "deflate", want: "deflate"},
+		{accept: "deflate, gzip", want: "gzip"},
+		{accept: "gzip;q=0.5, deflate", want: "deflate"},
+		{accept: "GZIP", want: "gzip"},
+		{accept: "*", want: "gzip"},
+		{accept: "*, gzip;q=0", want: "deflate"},
+		{accept: "gzip;q=0, deflate;q=0", want: ""},
+		{accept: "br, zstd", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, _ := negotiateEncoding(tt.accept)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResponseCompressor(t *testing.T) {
+	body := strings.Repeat("compressible response body ", 100)
+	tests := []struct {
+		name         string
+		method       string
+		accept       string
+		handler      http.HandlerFunc
+		wantEncoding string
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:         "gzip",
+			accept:       "gzip",
+			handler:      writeBody(body),
+			wantEncoding: "gzip",
+			wantCode:     http.StatusOK,
+			wantBody:     body,
+		},
+		{
+			name:         "deflate",
+			accept:       "deflate",
+			handler:      writeBody(body),
+			wantEncoding: "deflate",
+			wantCode:     http.StatusOK,
+			wantBody:     body,
+		},
+		{
+			name:     "not_accepted",
+			handler:  writeBody(body),
+			wantCode: http.StatusOK,
+			wantBody: body,
+		},
+		{
+			name:     "head",
+			method:   "HEAD",
+			accept:   "gzip",
+			handler:  writeBody(""),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "already_encoded",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				_, _ = w.Write([]byte(body))
+			},
+			wantEncoding: "br",
+			wantCode:     http.StatusOK,
+			wantBody:     body,
+		},
+		{
+			name:   "no_body",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:   "empty_write",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(nil)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:   "no_content",
+			accept: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+				_, _ = w.Write([]byte(body))
+			},
+			wantCode: http.StatusNoContent,
+			// The body rejected by http.Server is passed as is.
+			wantBody: body,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			ResponseCompressor(tt.handler).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantEncoding, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			assert.Equal(t, tt.wantBody, decodeResponseBody(t, tt.wantEncoding, rec.Body.Bytes()))
+		})
+	}
+}
+
+func TestResponseCompressorContentLength(t *testing.T) {
+	handler := ResponseCompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4")
+		_, _ = w.Write([]byte("body"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "body", decodeResponseBody(t, "gzip", rec.Body.Bytes()))
+}
+
+func TestResponseCompressorFlush(t *testing.T) {
+	handler := ResponseCompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("second"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "firstsecond", decodeResponseBody(t, "gzip", rec.Body.Bytes()))
+}
+
+// failingResponseWriter fails all the writes of the body.
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w *failingResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestResponseCompressorWriteError(t *testing.T) {
+	body := strings.Repeat("a", 100000)
+	handler := ResponseCompressor(writeBody(body))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// The writers of the failed responses are not reused, the next responses
+	// are complete.
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(&failingResponseWriter{httptest.NewRecorder()}, req)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, body, decodeResponseBody(t, "gzip", rec.Body.Bytes()))
+	}
+}
+
+func writeBody(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+func decodeResponseBody(t *testing.T, encoding string, body []byte) string {
+	var r io.Reader = bytes.NewReader(body)
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	}
+	require.NoError(t, err)
+	decoded, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(decoded)
+}
+
+func benchmarkResponseCompression(b *testing.B, handler http.Handler) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkResponseCompressorPooled(b *testing.B) {
+	benchmarkResponseCompression(b, ResponseCompressor(writeBody(strings.Repeat("a", 4096))))
+}
+
+func BenchmarkResponseCompressorNaive(b *testing.B) {
+	next := writeBody(strings.Repeat("a", 4096))
+	benchmarkResponseCompression(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		next.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, zw: zw}, r)
+		_ = zw.Close()
+	}))
+}
+
+// gzipResponseWriter compresses the body with a new writer for each response.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	zw *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	return w.zw.Write(b)
+}
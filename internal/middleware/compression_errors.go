@@ -0,0 +1,99 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+// DecompressionError is returned by the reads of the decompressed request
+// bodies failing in the middle of the body, after the decompression started. It
+// distinguishes the truncated bodies, e.g. a connection cut during the upload,
+// from the corrupt ones, e.g. a checksum mismatch, with the number of bytes
+// successfully decompressed before the failure.
+type DecompressionError struct {
+	// Encoding is the encoding of the body, e.g. "gzip", or the encodings of
+	// the bodies encoded several times separated by commas.
+	Encoding string
+	// DecompressedBytes is the number of bytes decompressed before the failure.
+	DecompressedBytes int64
+	// Truncated reports whether the body ended before the end of the
+	// compressed stream.
+	Truncated bool
+	// Err is the error of the decoder.
+	Err error
+}
+
+func (e *DecompressionError) Error() string {
+	kind := "corrupt"
+	if e.Truncated {
+		kind = "truncated"
+	}
+	return fmt.Sprintf("failed to decompress the %s request body, %s after %d decompressed bytes: %v", e.Encoding, kind, e.DecompressedBytes, e.Err)
+}
+
+func (e *DecompressionError) Unwrap() error {
+	return e.Err
+}
+
+// WithDecompressionLogger logs the failures of the decompression of the request
+// bodies read by the handler, with the number of bytes decompressed before the
+// failure, on logger. Disabled if logger is nil.
+func WithDecompressionLogger(logger *zap.Logger) DecompressorOption {
+	return func(d *decompressor) {
+		d.logger = logger
+	}
+}
+
+// decompressionErrorReader reports the errors of the decompressing reader as a
+// DecompressionError, logged once if logger is not nil.
+type decompressionErrorReader struct {
+	io.ReadCloser
+	encoding string
+	path     string
+	logger   *zap.Logger
+	n        int64
+	err      *DecompressionError
+}
+
+func (r *decompressionErrorReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	r.err = &DecompressionError{
+		Encoding:          r.encoding,
+		DecompressedBytes: r.n,
+		Truncated:         errors.Is(err, io.ErrUnexpectedEOF),
+		Err:               err,
+	}
+	if r.logger != nil {
+		r.logger.Warn("Failed to decompress the request body",
+			zap.String("path", r.path),
+			zap.String("encoding", r.encoding),
+			zap.Int64("decompressed_bytes", r.n),
+			zap.Bool("truncated", r.err.Truncated),
+			zap.Error(err))
+	}
+	return n, r.err
+}
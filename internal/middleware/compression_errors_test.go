@@ -0,0 +1,95 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDecompressionError(t *testing.T) {
+	testBody := []byte(strings.Repeat("uncompressed_text", 1000))
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+	truncated := compressed.Bytes()[:compressed.Len()-16]
+	// The CRC-32 of the gzip trailer does not match the content.
+	corrupt := append([]byte{}, compressed.Bytes()...)
+	corrupt[len(corrupt)-8] ^= 0xff
+
+	tests := []struct {
+		name          string
+		body          []byte
+		wantTruncated bool
+		wantErr       error
+		wantMsg       string
+	}{
+		{
+			name:          "truncated",
+			body:          truncated,
+			wantTruncated: true,
+			wantMsg:       "failed to decompress the gzip request body, truncated after ",
+		},
+		{
+			name:    "corrupt",
+			body:    corrupt,
+			wantErr: gzip.ErrChecksum,
+			wantMsg: "failed to decompress the gzip request body, corrupt after 17000 decompressed bytes: gzip: invalid checksum",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+			var readErr error
+			var read int
+			handler := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body []byte
+				body, readErr = ioutil.ReadAll(r.Body)
+				read = len(body)
+			}), WithDecompressionLogger(zap.New(core)))
+			req := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", "gzip")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var decompressionErr *DecompressionError
+			require.True(t, errors.As(readErr, &decompressionErr))
+			assert.Equal(t, "gzip", decompressionErr.Encoding)
+			assert.EqualValues(t, read, decompressionErr.DecompressedBytes)
+			assert.Equal(t, tt.wantTruncated, decompressionErr.Truncated)
+			assert.Contains(t, readErr.Error(), tt.wantMsg)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(readErr, tt.wantErr))
+			}
+
+			warnLogs := logs.FilterMessage("Failed to decompress the request body").All()
+			require.Len(t, warnLogs, 1)
+			fields := warnLogs[0].ContextMap()
+			assert.Equal(t, "/v1/traces", fields["path"])
+			assert.Equal(t, int64(read), fields["decompressed_bytes"])
+			assert.Equal(t, tt.wantTruncated, fields["truncated"])
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// encodingFilter restricts the encodings decompressed by the decompressor.
+type encodingFilter struct {
+	allowed map[string]struct{}
+	denied  map[string]struct{}
+	// accepted lists the accepted encodings, for the rejections.
+	accepted []string
+}
+
+// WithEncodings restricts the "Content-Encoding" values accepted by the
+// decompressor: if allowed is not empty only its encodings are accepted, and
+// the encodings of denied are never accepted. The requests with another
+// encoding, or whose body is sniffed with another encoding, are rejected with a
+// 501 status and the accepted encodings in the "Accept-Encoding" header of the
+// response, see RFC 7694. The requests without encoding, or with the
+// "identity" encoding, are always accepted.
+func WithEncodings(allowed, denied []string) DecompressorOption {
+	return func(d *decompressor) {
+		if len(allowed) == 0 && len(denied) == 0 {
+			d.encodings = nil
+			return
+		}
+		d.encodings = newEncodingFilter(allowed, denied)
+	}
+}
+
+func newEncodingFilter(allowed, denied []string) *encodingFilter {
+	f := &encodingFilter{denied: make(map[string]struct{}, len(denied))}
+	if len(allowed) > 0 {
+		f.allowed = make(map[string]struct{}, len(allowed))
+		for _, encoding := range allowed {
+			f.allowed[strings.ToLower(encoding)] = struct{}{}
+		}
+	}
+	for _, encoding := range denied {
+		f.denied[strings.ToLower(encoding)] = struct{}{}
+	}
+	f.accepted = supportedEncodings(f.accepts)
+	return f
+}
+
+// accepts returns whether the body of the given encoding is accepted.
+func (f *encodingFilter) accepts(encoding string) bool {
+	encoding = strings.ToLower(encoding)
+	if encoding == "" || encoding == "identity" {
+		return true
+	}
+	if _, ok := f.denied[encoding]; ok {
+		return false
+	}
+	if f.allowed == nil {
+		return true
+	}
+	_, ok := f.allowed[encoding]
+	return ok
+}
+
+// supportedEncodings returns the sorted encodings of the decoders for which
+// accepts returns true, followed by "identity".
+func supportedEncodings(accepts func(encoding string) bool) []string {
+	var encodings []string
+	for encoding := range decoders {
+		if accepts(encoding) {
+			encodings = append(encodings, encoding)
+		}
+	}
+	sort.Strings(encodings)
+	return append(encodings, "identity")
+}
+
+// encodingNotAcceptedError is returned for the bodies of an encoding not
+// accepted by the encodingFilter.
+type encodingNotAcceptedError struct {
+	encoding string
+	accepted []string
+}
+
+func (e *encodingNotAcceptedError) Error() string {
+	return fmt.Sprintf("content encoding %q is not accepted, accepted encodings: %s", e.encoding, strings.Join(e.accepted, ", "))
+}
+
+// UnsupportedEncodingError is returned for the bodies of a "Content-Encoding"
+// that cannot be decompressed, see DecompressReader.
+type UnsupportedEncodingError struct {
+	// Encoding is the unsupported encoding.
+	Encoding string
+	// Supported lists the supported encodings, "identity" included.
+	Supported []string
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q", e.Encoding)
+}
@@ -0,0 +1,136 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithEncodings(t *testing.T) {
+	const body = "payload"
+	gzipBody, err := compressGzip([]byte(body))
+	require.NoError(t, err)
+	zstdBody, err := compressZstd([]byte(body))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		allowed      []string
+		denied       []string
+		encoding     string
+		body         []byte
+		sniff        bool
+		wantStatus   int
+		wantAccepted string
+	}{
+		{
+			name:       "no_filter",
+			encoding:   "zstd",
+			body:       zstdBody.Bytes(),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed",
+			allowed:    []string{"gzip"},
+			encoding:   "gzip",
+			body:       gzipBody.Bytes(),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "not_allowed",
+			allowed:      []string{"gzip", "deflate"},
+			encoding:     "zstd",
+			body:         zstdBody.Bytes(),
+			wantStatus:   http.StatusNotImplemented,
+			wantAccepted: "deflate, gzip, identity",
+		},
+		{
+			name:       "not_denied",
+			denied:     []string{"ZSTD"},
+			encoding:   "gzip",
+			body:       gzipBody.Bytes(),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "denied",
+			denied:     []string{"zstd"},
+			encoding:   "zstd",
+			body:       zstdBody.Bytes(),
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "denied_sniffed",
+			denied:     []string{"zstd"},
+			body:       zstdBody.Bytes(),
+			sniff:      true,
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "identity",
+			allowed:    []string{"gzip"},
+			encoding:   "identity",
+			body:       []byte(body),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "uncompressed",
+			allowed:    []string{"gzip"},
+			body:       []byte(body),
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				got, err = ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+			}), WithEncodings(tt.allowed, tt.denied), WithSniffCompression(tt.sniff))
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Contains(t, rec.Body.String(), "is not accepted")
+				assert.NotEmpty(t, rec.Header().Get("Accept-Encoding"))
+				if tt.wantAccepted != "" {
+					assert.Equal(t, tt.wantAccepted, rec.Header().Get("Accept-Encoding"))
+				}
+				return
+			}
+			assert.Equal(t, body, string(got))
+		})
+	}
+}
+
+func TestEncodingFilterAccepted(t *testing.T) {
+	f := newEncodingFilter(nil, []string{"zstd"})
+	assert.NotContains(t, f.accepted, "zstd")
+	assert.Contains(t, f.accepted, "gzip")
+	assert.True(t, f.accepts(""))
+	assert.True(t, f.accepts("Identity"))
+	assert.False(t, f.accepts("Zstd"))
+}
@@ -0,0 +1,84 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// UncompressedContentLengthHeader is the request header with the length of the
+// uncompressed body sent by some clients, see WithUncompressedLengthHint.
+const UncompressedContentLengthHeader = "X-Uncompressed-Content-Length"
+
+// WithUncompressedLengthHint sets the ContentLength of the decompressed
+// requests to the length of the UncompressedContentLengthHeader header when it
+// is at most maxSize, so that the next handlers can allocate their buffers
+// upfront. The larger lengths, that could be spoofed to cause large
+// allocations, are ignored. The decompressed body must have the announced
+// length, its reads fail otherwise. Disabled if maxSize is not positive.
+func WithUncompressedLengthHint(maxSize int64) DecompressorOption {
+	return func(d *decompressor) {
+		d.maxLengthHint = maxSize
+	}
+}
+
+// uncompressedLength returns the valid length hint of the request.
+func (d *decompressor) uncompressedLength(r *http.Request) (int64, bool) {
+	if d.maxLengthHint <= 0 {
+		return 0, false
+	}
+	length, err := strconv.ParseInt(r.Header.Get(UncompressedContentLengthHeader), 10, 64)
+	if err != nil || length < 0 || length > d.maxLengthHint {
+		return 0, false
+	}
+	return length, true
+}
+
+// exactLengthReadCloser fails the reads of the bodies longer or shorter than
+// the length announced by the client, like http.Request.Body does for the
+// Content-Length.
+type exactLengthReadCloser struct {
+	io.ReadCloser
+	length    int64
+	remaining int64
+}
+
+func (r *exactLengthReadCloser) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		// Reads one more byte to detect the longer bodies.
+		var b [1]byte
+		n, err := r.ReadCloser.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("the decompressed body is longer than the %s of %d bytes", UncompressedContentLengthHeader, r.length)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		// The end of the decompressed stream is checked by the next read.
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPContentDecompressionLengthHint(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		maxSize    int64
+		hint       string
+		wantLength int64
+		wantErr    string
+	}{
+		{
+			name:       "hint",
+			maxSize:    1024,
+			hint:       "17",
+			wantLength: 17,
+		},
+		{
+			name:       "disabled",
+			hint:       "17",
+			wantLength: -1,
+		},
+		{
+			name:       "over_max_size",
+			maxSize:    16,
+			hint:       "17",
+			wantLength: -1,
+		},
+		{
+			name:       "invalid",
+			maxSize:    1024,
+			hint:       "-17",
+			wantLength: -1,
+		},
+		{
+			name:       "shorter_body",
+			maxSize:    1024,
+			hint:       "20",
+			wantLength: 20,
+			wantErr:    io.ErrUnexpectedEOF.Error(),
+		},
+		{
+			name:       "longer_body",
+			maxSize:    1024,
+			hint:       "10",
+			wantLength: 10,
+			wantErr:    "the decompressed body is longer than the X-Uncompressed-Content-Length of 10 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLength int64
+			var gotBody []byte
+			var gotErr error
+			h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotLength = r.ContentLength
+				gotBody, gotErr = ioutil.ReadAll(r.Body)
+			}), WithUncompressedLengthHint(tt.maxSize))
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+			req.Header.Set("Content-Encoding", "gzip")
+			req.Header.Set(UncompressedContentLengthHeader, tt.hint)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.wantLength, gotLength)
+			if tt.wantErr != "" {
+				assert.EqualError(t, gotErr, tt.wantErr)
+				return
+			}
+			require.NoError(t, gotErr)
+			assert.Equal(t, testBody, gotBody)
+		})
+	}
+}
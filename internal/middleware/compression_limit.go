@@ -0,0 +1,81 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// errTooManyDecompressions rejects the compressed requests over the limit of
+// WithMaxConcurrentDecompressions.
+var errTooManyDecompressions = errors.New("too many concurrent decompressions, retry later")
+
+// WithMaxConcurrentDecompressions limits the number of request bodies
+// decompressed concurrently to max, the compressed requests over the limit are
+// rejected with a 429 status rather than waiting, so that the memory of the
+// decompressions, the read-ahead buffer, see WithReadAheadSize, and the state
+// of the decoders of each body, has a hard ceiling. A body takes a slot until
+// it is closed, once the handler returns. Disabled if not positive.
+func WithMaxConcurrentDecompressions(max int) DecompressorOption {
+	return func(d *decompressor) {
+		if max > 0 {
+			d.slots = make(chan struct{}, max)
+		} else {
+			d.slots = nil
+		}
+	}
+}
+
+// acquireSlot takes a decompression slot, it returns false if all the slots
+// are taken.
+func (d *decompressor) acquireSlot() bool {
+	if d.slots == nil {
+		return true
+	}
+	select {
+	case d.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *decompressor) releaseSlot() {
+	if d.slots != nil {
+		<-d.slots
+	}
+}
+
+// withSlot returns body releasing its decompression slot once closed.
+func (d *decompressor) withSlot(body io.ReadCloser) io.ReadCloser {
+	if d.slots == nil {
+		return body
+	}
+	return &slotReadCloser{ReadCloser: body, release: d.releaseSlot}
+}
+
+type slotReadCloser struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (s *slotReadCloser) Close() error {
+	err := s.ReadCloser.Close()
+	s.once.Do(s.release)
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConcurrentDecompressions(t *testing.T) {
+	compressed, err := compressGzip([]byte("payload"))
+	require.NoError(t, err)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		if string(body) == "payload" && r.URL.Path == "/block" {
+			entered <- struct{}{}
+			<-release
+		}
+	}), WithMaxConcurrentDecompressions(1))
+	newRequest := func(path, encoding string, body []byte) *http.Request {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		return req
+	}
+
+	// An invalid body releases its slot.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("/", "gzip", []byte("invalid")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("/block", "gzip", compressed.Bytes()))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}()
+	<-entered
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("/", "gzip", compressed.Bytes()))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "too many concurrent decompressions, retry later\n", rec.Body.String())
+
+	// The uncompressed requests do not take a slot.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("/", "", []byte(strings.Repeat("a", 10))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	close(release)
+	<-done
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("/", "gzip", compressed.Bytes()))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,155 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagEncoding, _  = tag.NewKey("encoding")
+	tagErrorType, _ = tag.NewKey("error_type")
+
+	statCompressedBytes = stats.Int64(
+		"http.server.decompression.compressed_bytes",
+		"Number of compressed bytes read from the HTTP request bodies",
+		stats.UnitBytes)
+	statDecompressedBytes = stats.Int64(
+		"http.server.decompression.decompressed_bytes",
+		"Number of bytes decompressed from the HTTP request bodies",
+		stats.UnitBytes)
+	statCompressionRatio = stats.Float64(
+		"http.server.decompression.ratio",
+		"Ratio of the decompressed size to the compressed size of the HTTP request bodies",
+		stats.UnitDimensionless)
+	statDecompressionFailures = stats.Int64(
+		"http.server.decompression.failures",
+		"Number of HTTP request bodies which failed to be decompressed",
+		stats.UnitDimensionless)
+)
+
+// WithDecompressionMetrics records the sizes of the decompressed bodies and the
+// decompression failures, tagged by encoding, with the given meter. The views of
+// DecompressionMetricViews must be registered on the meter. Disabled if nil.
+func WithDecompressionMetrics(meter view.Meter) DecompressorOption {
+	return func(d *decompressor) {
+		d.meter = meter
+	}
+}
+
+// DecompressionMetricViews returns the metric views recorded by
+// HTTPContentDecompressor with WithDecompressionMetrics.
+func DecompressionMetricViews() []*view.View {
+	return []*view.View{
+		{
+			Name:        statCompressedBytes.Name(),
+			Measure:     statCompressedBytes,
+			Description: statCompressedBytes.Description(),
+			TagKeys:     []tag.Key{tagEncoding},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        statDecompressedBytes.Name(),
+			Measure:     statDecompressedBytes,
+			Description: statDecompressedBytes.Description(),
+			TagKeys:     []tag.Key{tagEncoding},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        statCompressionRatio.Name(),
+			Measure:     statCompressionRatio,
+			Description: statCompressionRatio.Description(),
+			TagKeys:     []tag.Key{tagEncoding},
+			Aggregation: view.Distribution(1, 2, 4, 8, 16, 32, 64),
+		},
+		{
+			Name:        statDecompressionFailures.Name(),
+			Measure:     statDecompressionFailures,
+			Description: statDecompressionFailures.Description(),
+			TagKeys:     []tag.Key{tagEncoding, tagErrorType},
+			Aggregation: view.Sum(),
+		},
+	}
+}
+
+// decompressionMetrics collects the sizes of a request body and its first
+// decompression error.
+type decompressionMetrics struct {
+	encoding          string
+	compressedBytes   int64
+	decompressedBytes int64
+	err               error
+}
+
+// record records the metrics once the body is handled. The ratio is only
+// recorded for the bodies fully decompressed.
+func (m *decompressionMetrics) record(ctx context.Context, meter view.Meter) {
+	mutators := []tag.Mutator{tag.Upsert(tagEncoding, m.encoding)}
+	var ms []stats.Measurement
+	if m.err != nil {
+		mutators = append(mutators, tag.Upsert(tagErrorType, decompressionErrorType(m.err)))
+		ms = append(ms, statDecompressionFailures.M(1))
+	} else {
+		ms = append(ms, statCompressedBytes.M(m.compressedBytes), statDecompressedBytes.M(m.decompressedBytes))
+		if m.compressedBytes > 0 {
+			ms = append(ms, statCompressionRatio.M(float64(m.decompressedBytes)/float64(m.compressedBytes)))
+		}
+	}
+	_ = stats.RecordWithOptions(ctx,
+		stats.WithRecorder(meter),
+		stats.WithTags(mutators...),
+		stats.WithMeasurements(ms...))
+}
+
+// decompressionErrorType returns the error_type tag of a decompression error.
+func decompressionErrorType(err error) string {
+	var corrupt flate.CorruptInputError
+	switch {
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, zlib.ErrHeader):
+		return "invalid_header"
+	case errors.Is(err, gzip.ErrChecksum), errors.Is(err, zlib.ErrChecksum):
+		return "checksum"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "truncated"
+	case errors.As(err, &corrupt):
+		return "corrupt_input"
+	default:
+		return "other"
+	}
+}
+
+// metricsReadCloser counts the decompressed bytes and keeps the first read error.
+type metricsReadCloser struct {
+	io.ReadCloser
+	metrics *decompressionMetrics
+}
+
+func (r *metricsReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.metrics.decompressedBytes += int64(n)
+	if err != nil && err != io.EOF && r.metrics.err == nil {
+		r.metrics.err = err
+	}
+	return n, err
+}
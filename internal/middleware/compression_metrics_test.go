@@ -0,0 +1,112 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+// retrieveSums returns the sums of the view recorded by meter, keyed by the
+// values of the tags.
+func retrieveSums(t *testing.T, meter view.Meter, name string) map[string]int64 {
+	rows, err := meter.RetrieveData(name)
+	require.NoError(t, err)
+	got := map[string]int64{}
+	for _, row := range rows {
+		var values []string
+		for _, tag := range row.Tags {
+			values = append(values, tag.Value)
+		}
+		got[strings.Join(values, ",")] = int64(row.Data.(*view.SumData).Value)
+	}
+	return got
+}
+
+func TestDecompressionMetrics(t *testing.T) {
+	meter := view.NewMeter()
+	meter.Start()
+	defer meter.Stop()
+	require.NoError(t, meter.Register(DecompressionMetricViews()...))
+
+	testBody := []byte(strings.Repeat("uncompressed_text", 100))
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+	zlibCompressed, err := compressZlib(testBody)
+	require.NoError(t, err)
+
+	h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+	}), WithDecompressionMetrics(meter))
+	send := func(encoding string, body []byte) {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", encoding)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send("gzip", compressed.Bytes())
+	send("gzip", compressed.Bytes())
+	send("zlib", zlibCompressed.Bytes())
+	// Rejected when the reader is created.
+	send("gzip", testBody)
+	// Failed while the body is read by the handler.
+	send("gzip", compressed.Bytes()[:compressed.Len()-4])
+	// Not compressed, not recorded.
+	send("", testBody)
+
+	assert.Equal(t, map[string]int64{
+		"gzip": 2 * int64(compressed.Len()),
+		"zlib": int64(zlibCompressed.Len()),
+	}, retrieveSums(t, meter, statCompressedBytes.Name()))
+	assert.Equal(t, map[string]int64{
+		"gzip": 2 * int64(len(testBody)),
+		"zlib": int64(len(testBody)),
+	}, retrieveSums(t, meter, statDecompressedBytes.Name()))
+	assert.Equal(t, map[string]int64{
+		"gzip,invalid_header": 1,
+		"gzip,truncated":      1,
+	}, retrieveSums(t, meter, statDecompressionFailures.Name()))
+
+	rows, err := meter.RetrieveData(statCompressionRatio.Name())
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	for _, row := range rows {
+		data := row.Data.(*view.DistributionData)
+		assert.Greater(t, data.Mean, 1.0)
+	}
+}
+
+func TestDecompressionMetricsDisabled(t *testing.T) {
+	// Recording to the default meter without registered views is a no-op, the
+	// metrics are only collected when a meter is given.
+	testBody := []byte("uncompressed_text")
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+	var got []byte
+	h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ioutil.ReadAll(r.Body)
+	}))
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, testBody, got)
+}
@@ -0,0 +1,102 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type responseDecompressor struct {
+	transport      http.RoundTripper
+	acceptEncoding string
+}
+
+// ResponseDecompressor is a client middleware that advertises the encodings
+// supported by HTTPContentDecompressor in the "Accept-Encoding" header of the
+// requests and decompresses the response bodies accordingly. Setting the header
+// disables the transparent gzip decompression of http.Transport, which is thus
+// handled here. Like with http.Transport, HEAD requests and requests with an
+// "Accept-Encoding" or a "Range" header set by the caller are sent and returned
+// unchanged.
+func ResponseDecompressor(rt http.RoundTripper) http.RoundTripper {
+	encodings := make([]string, 0, len(decoders))
+	for encoding := range decoders {
+		encodings = append(encodings, encoding)
+	}
+	sort.Strings(encodings)
+	return &responseDecompressor{
+		transport:      rt,
+		acceptEncoding: strings.Join(encodings, ", "),
+	}
+}
+
+func (d *responseDecompressor) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodHead || req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return d.transport.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request, see http.RoundTripper.
+	cReq := req.Clone(req.Context())
+	cReq.Header.Set("Accept-Encoding", d.acceptEncoding)
+	resp, err := d.transport.RoundTrip(cReq)
+	if err != nil {
+		return resp, err
+	}
+	decoder, ok := decoders[resp.Header.Get("Content-Encoding")]
+	if !ok || resp.Body == nil {
+		return resp, nil
+	}
+	resp.Body = &lazyDecompressReader{body: resp.Body, decoder: decoder}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// lazyDecompressReader creates the decompressing reader on the first read, so
+// that responses with an empty body, like the ones with a 204 status, don't fail
+// on the missing header of the compression format.
+type lazyDecompressReader struct {
+	body    io.ReadCloser
+	decoder func(body io.Reader) (io.ReadCloser, error)
+	r       io.ReadCloser
+	err     error
+}
+
+func (l *lazyDecompressReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		r, err := l.decoder(l.body)
+		if err != nil {
+			l.err = err
+			return 0, err
+		}
+		l.r = r
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
+
+func (l *lazyDecompressReader) Close() error {
+	if l.r != nil {
+		l.r.Close()
+	}
+	return l.body.Close()
+}
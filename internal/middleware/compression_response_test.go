@@ -0,0 +1,139 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseDecompressor(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	gzipBody, err := compressGzip(testBody)
+	require.NoError(t, err)
+	zlibBody, err := compressZlib(testBody)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		encoding       string
+		body           []byte
+		wantBody       []byte
+		wantEncoding   string
+		passthrough    bool
+	}{
+		{
+			name:     "gzip",
+			encoding: "gzip",
+			body:     gzipBody.Bytes(),
+			wantBody: testBody,
+		},
+		{
+			name:     "deflate",
+			encoding: "deflate",
+			body:     zlibBody.Bytes(),
+			wantBody: testBody,
+		},
+		{
+			name:     "uncompressed",
+			body:     testBody,
+			wantBody: testBody,
+		},
+		{
+			name:         "head",
+			method:       "HEAD",
+			encoding:     "gzip",
+			wantEncoding: "gzip",
+			passthrough:  true,
+		},
+		{
+			name:     "empty_body",
+			encoding: "gzip",
+		},
+		{
+			name:           "caller_accept_encoding",
+			acceptEncoding: "gzip",
+			encoding:       "gzip",
+			body:           gzipBody.Bytes(),
+			wantBody:       gzipBody.Bytes(),
+			wantEncoding:   "gzip",
+			passthrough:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAcceptEncoding string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAcceptEncoding = r.Header.Get("Accept-Encoding")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req, err := http.NewRequest(method, srv.URL, nil)
+			require.NoError(t, err)
+			if tt.passthrough {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			client := &http.Client{Transport: ResponseDecompressor(http.DefaultTransport)}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.True(t, bytes.Equal(tt.wantBody, body), "Unexpected body %q", body)
+			assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+			if tt.passthrough {
+				assert.Equal(t, tt.acceptEncoding, gotAcceptEncoding)
+			} else {
+				assert.Contains(t, gotAcceptEncoding, "gzip")
+				assert.Contains(t, gotAcceptEncoding, "deflate")
+				// The request of the caller is not modified.
+				assert.Empty(t, req.Header.Get("Accept-Encoding"))
+			}
+		})
+	}
+}
+
+func TestResponseDecompressorInvalidBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("not a gzip body"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: ResponseDecompressor(http.DefaultTransport)}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.EqualError(t, err, "gzip: invalid header")
+	require.NoError(t, resp.Body.Close())
+}
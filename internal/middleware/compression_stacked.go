@@ -0,0 +1,70 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io"
+	"strings"
+)
+
+// parseContentEncodings returns the encodings of a "Content-Encoding" header,
+// in the order they were applied, see RFC 7231. The content codings are
+// case-insensitive, and the "identity" encodings are removed.
+func parseContentEncodings(header string) []string {
+	var encodings []string
+	for _, encoding := range strings.Split(header, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+// stackedDecompressReader decompresses a body encoded with several encodings,
+// the last encoding applied is decoded first.
+type stackedDecompressReader struct {
+	io.Reader
+	// layers are the decompressing readers, from the innermost one reading the
+	// body to the outermost one.
+	layers []io.ReadCloser
+}
+
+// newStackedDecompressReader returns a reader decoding the given encodings, in
+// the order they were applied to body. The encodings must be supported.
+func newStackedDecompressReader(body io.Reader, encodings []string) (io.ReadCloser, error) {
+	r := &stackedDecompressReader{Reader: body, layers: make([]io.ReadCloser, 0, len(encodings))}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		layer, err := DecompressReader(encodings[i], r.Reader)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.layers = append(r.layers, layer)
+		r.Reader = layer
+	}
+	return r, nil
+}
+
+// Close closes the decompressing readers, from the outermost one.
+func (r *stackedDecompressReader) Close() error {
+	var err error
+	for i := len(r.layers) - 1; i >= 0; i-- {
+		if cerr := r.layers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
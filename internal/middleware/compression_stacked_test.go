@@ -0,0 +1,102 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContentEncodings(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{header: "", want: nil},
+		{header: "identity", want: nil},
+		{header: "gzip", want: []string{"gzip"}},
+		{header: "gzip, zstd", want: []string{"gzip", "zstd"}},
+		{header: " GZIP ,identity,zstd ", want: []string{"gzip", "zstd"}},
+		{header: "gzip,,zstd", want: []string{"gzip", "zstd"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseContentEncodings(tt.header))
+		})
+	}
+}
+
+func TestHTTPContentDecompressionStacked(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	gzipped, err := compressGzip(testBody)
+	require.NoError(t, err)
+	// The body is compressed with gzip, then with zstd.
+	stacked, err := compressZstd(gzipped.Bytes())
+	require.NoError(t, err)
+
+	var gotBody []byte
+	handler := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var errRead error
+		gotBody, errRead = ioutil.ReadAll(r.Body)
+		assert.NoError(t, errRead)
+		assert.Empty(t, r.Header.Get("Content-Encoding"))
+	}))
+
+	tests := []struct {
+		name     string
+		encoding string
+		wantCode int
+		wantBody string
+	}{
+		{name: "stacked", encoding: "gzip, zstd", wantCode: http.StatusOK},
+		{name: "stacked_with_identity", encoding: "gzip, identity, zstd", wantCode: http.StatusOK},
+		{name: "reversed", encoding: "zstd, gzip", wantCode: http.StatusBadRequest, wantBody: "gzip: invalid header\n"},
+		{name: "unsupported_layer", encoding: "gzip, lz4", wantCode: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBody = nil
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(stacked.Bytes()))
+			req.Header.Set("Content-Encoding", tt.encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusOK {
+				assert.Nil(t, gotBody)
+				if tt.wantBody != "" {
+					assert.Equal(t, tt.wantBody, rec.Body.String())
+				}
+				return
+			}
+			assert.Equal(t, testBody, gotBody)
+		})
+	}
+}
+
+func TestHTTPContentDecompressionStackedNotAccepted(t *testing.T) {
+	handler := HTTPContentDecompressor(http.NotFoundHandler(), WithEncodings(nil, []string{"zstd"}))
+	req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte("body")))
+	req.Header.Set("Content-Encoding", "gzip, zstd")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.NotContains(t, rec.Header().Get("Accept-Encoding"), "zstd")
+}
@@ -18,15 +18,23 @@ import (
 	"bytes"
 	"compress/gzip"
 	"compress/zlib"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"go.opentelemetry.io/collector/testutil"
 )
@@ -64,6 +72,31 @@ func TestHTTPContentDecompressionHandler(t *testing.T) {
 			},
 			respCode: 200,
 		},
+		{
+			name:     "Identity",
+			encoding: "identity",
+			reqBodyFunc: func() (*bytes.Buffer, error) {
+				return bytes.NewBuffer(testBody), nil
+			},
+			respCode: 200,
+		},
+		{
+			name:     "UppercaseGzip",
+			encoding: "GZIP",
+			reqBodyFunc: func() (*bytes.Buffer, error) {
+				return compressGzip(testBody)
+			},
+			respCode: 200,
+		},
+		{
+			name:     "UnsupportedEncoding",
+			encoding: "lz4",
+			reqBodyFunc: func() (*bytes.Buffer, error) {
+				return bytes.NewBuffer(testBody), nil
+			},
+			respCode: 501,
+			respBody: fmt.Sprintf("unsupported content encoding \"lz4\", supported encodings: %s\n", strings.Join(supportedEncodings(func(string) bool { return true }), ", ")),
+		},
 		{
 			name:     "InvalidGzip",
 			encoding: "gzip",
@@ -128,6 +161,392 @@ func TestHTTPContentDecompressionHandler(t *testing.T) {
 	}
 }
 
+func TestHTTPContentDecompressionIdentity(t *testing.T) {
+	testBody := []byte(strings.Repeat("uncompressed_text", 100))
+	for _, encoding := range []string{"identity", "Identity", "identity, identity"} {
+		t.Run(encoding, func(t *testing.T) {
+			var gotBody []byte
+			var gotContentLength int64
+			var gotHeader http.Header
+			handler := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				gotBody, err = ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				gotContentLength = r.ContentLength
+				gotHeader = r.Header
+			}), WithSniffCompression(true))
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(testBody))
+			req.Header.Set("Content-Encoding", encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, testBody, gotBody)
+			assert.EqualValues(t, len(testBody), gotContentLength)
+			assert.NotContains(t, gotHeader, "Content-Encoding")
+		})
+	}
+}
+
+func TestHTTPContentDecompressionContentLength(t *testing.T) {
+	testBody := []byte(strings.Repeat("uncompressed_text", 100))
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+
+	type seen struct {
+		contentLength       int64
+		contentLengthHeader string
+		transferEncoding    []string
+		body                []byte
+	}
+	gotCh := make(chan seen, 1)
+	srv := httptest.NewServer(HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, errRead := ioutil.ReadAll(r.Body)
+		assert.NoError(t, errRead)
+		gotCh <- seen{
+			contentLength:       r.ContentLength,
+			contentLengthHeader: r.Header.Get("Content-Length"),
+			transferEncoding:    r.TransferEncoding,
+			body:                body,
+		}
+	})))
+	defer srv.Close()
+
+	tests := []struct {
+		name                 string
+		body                 func() io.Reader
+		wantTransferEncoding []string
+	}{
+		{
+			name: "content_length",
+			body: func() io.Reader {
+				return bytes.NewReader(compressed.Bytes())
+			},
+		},
+		{
+			// A body of unknown length is sent with the chunked transfer encoding.
+			name: "chunked",
+			body: func() io.Reader {
+				pr, pw := io.Pipe()
+				go func() {
+					zw := gzip.NewWriter(pw)
+					for i := 0; i < 100; i++ {
+						_, _ = zw.Write([]byte("uncompressed_text"))
+						_ = zw.Flush()
+					}
+					_ = pw.CloseWithError(zw.Close())
+				}()
+				return pr
+			},
+			wantTransferEncoding: []string{"chunked"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", srv.URL, tt.body())
+			require.NoError(t, err)
+			req.Header.Set("Content-Encoding", "gzip")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			got := <-gotCh
+			assert.Equal(t, int64(-1), got.contentLength)
+			assert.Empty(t, got.contentLengthHeader)
+			assert.Equal(t, tt.wantTransferEncoding, got.transferEncoding)
+			assert.Equal(t, string(testBody), string(got.body))
+		})
+	}
+}
+
+func TestHTTPContentDecompressionSniff(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+	zstdCompressed, err := compressZstd(testBody)
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		sniff    bool
+		body     []byte
+		wantBody []byte
+	}{
+		{
+			name:     "gzip",
+			sniff:    true,
+			body:     compressed.Bytes(),
+			wantBody: testBody,
+		},
+		{
+			name:     "zstd",
+			sniff:    true,
+			body:     zstdCompressed.Bytes(),
+			wantBody: testBody,
+		},
+		{
+			name:     "gzip_without_sniffing",
+			body:     compressed.Bytes(),
+			wantBody: compressed.Bytes(),
+		},
+		{
+			name:     "uncompressed",
+			sniff:    true,
+			body:     testBody,
+			wantBody: testBody,
+		},
+		{
+			name:     "short_body",
+			sniff:    true,
+			body:     compressed.Bytes()[:2],
+			wantBody: compressed.Bytes()[:2],
+		},
+		{
+			name:  "empty_body",
+			sniff: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody []byte
+			h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var errRead error
+				gotBody, errRead = ioutil.ReadAll(r.Body)
+				assert.NoError(t, errRead)
+			}), WithSniffCompression(tt.sniff))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("POST", "/", bytes.NewReader(tt.body)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, string(tt.wantBody), string(gotBody))
+		})
+	}
+}
+
+func TestHTTPContentDecompressionLenientGzip(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+	withTrailing := append(append([]byte{}, compressed.Bytes()...), "\n\x00\x00garbage"...)
+	// A multistream body, only the first member is read in the lenient mode.
+	multistream := append(append([]byte{}, compressed.Bytes()...), compressed.Bytes()...)
+
+	tests := []struct {
+		name         string
+		lenient      bool
+		body         []byte
+		wantStatus   int
+		wantBody     string
+		wantTrailing int64
+	}{
+		{
+			name:       "trailing_bytes_rejected",
+			body:       withTrailing,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "trailing_bytes",
+			lenient:      true,
+			body:         withTrailing,
+			wantStatus:   http.StatusOK,
+			wantBody:     "uncompressed_text",
+			wantTrailing: 10,
+		},
+		{
+			name:       "valid",
+			lenient:    true,
+			body:       compressed.Bytes(),
+			wantStatus: http.StatusOK,
+			wantBody:   "uncompressed_text",
+		},
+		{
+			name:         "multistream",
+			lenient:      true,
+			body:         multistream,
+			wantStatus:   http.StatusOK,
+			wantBody:     "uncompressed_text",
+			wantTrailing: int64(compressed.Len()),
+		},
+		{
+			name:       "too_many_trailing_bytes",
+			lenient:    true,
+			body:       append(append([]byte{}, compressed.Bytes()...), make([]byte, maxLenientGzipTrailingBytes+1)...),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+			var opts []DecompressorOption
+			if tt.lenient {
+				opts = append(opts, WithLenientGzip(zap.New(core)))
+			}
+			h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, errRead := ioutil.ReadAll(r.Body)
+				if errRead != nil {
+					http.Error(w, errRead.Error(), http.StatusBadRequest)
+					return
+				}
+				w.Write(body)
+			}), opts...)
+			req := httptest.NewRequest("POST", "/v1/trace", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+			if tt.wantTrailing == 0 {
+				assert.Zero(t, logs.Len())
+				return
+			}
+			require.Equal(t, 1, logs.Len())
+			fields := logs.All()[0].ContextMap()
+			assert.Equal(t, tt.wantTrailing, fields["trailing_bytes"])
+			assert.Equal(t, "/v1/trace", fields["path"])
+		})
+	}
+}
+
+func BenchmarkHTTPContentDecompressionReadAhead(b *testing.B) {
+	payload := make([]byte, 16*1024*1024)
+	rnd := rand.New(rand.NewSource(0))
+	for i := range payload {
+		payload[i] = byte('a' + rnd.Intn(16))
+	}
+	compressed, err := compressGzip(payload)
+	require.NoError(b, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.Copy(ioutil.Discard, r.Body)
+		assert.NoError(b, err)
+	})
+	for _, size := range []int{4 * 1024, defaultReadAheadSize, 256 * 1024} {
+		b.Run(fmt.Sprintf("%dKiB", size/1024), func(b *testing.B) {
+			h := HTTPContentDecompressor(handler, WithReadAheadSize(size))
+			b.SetBytes(int64(compressed.Len()))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// The body is streamed through a pipe so that, like for a network
+				// connection, each read of the body has a fixed cost.
+				pr, pw := io.Pipe()
+				go func() {
+					_, err := io.Copy(pw, bytes.NewReader(compressed.Bytes()))
+					pw.CloseWithError(err)
+				}()
+				req := httptest.NewRequest("POST", "/", pr)
+				req.Header.Set("Content-Encoding", "gzip")
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				assert.Equal(b, http.StatusOK, rec.Code)
+			}
+		})
+	}
+}
+
+func TestPooledGzipReader(t *testing.T) {
+	first, err := compressGzip([]byte("first body"))
+	require.NoError(t, err)
+	second, err := compressGzip([]byte("second body"))
+	require.NoError(t, err)
+	truncated := first.Bytes()[:first.Len()-4]
+
+	read := func(body []byte, limit int64) (string, error) {
+		r, err := newGzipReader(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		b, err := ioutil.ReadAll(io.LimitReader(r, limit))
+		return string(b), err
+	}
+	// The readers of partially read and of corrupted bodies are not reused,
+	// the following bodies are still decompressed correctly.
+	for i := 0; i < 3; i++ {
+		got, err := read(first.Bytes(), 5)
+		require.NoError(t, err)
+		assert.Equal(t, "first", got)
+
+		_, err = read(truncated, 1024)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+		got, err = read(second.Bytes(), 1024)
+		require.NoError(t, err)
+		assert.Equal(t, "second body", got)
+	}
+
+	_, err = newGzipReader(strings.NewReader("not a gzip body"))
+	assert.EqualError(t, err, "gzip: invalid header")
+}
+
+func TestPooledGzipReaderClosed(t *testing.T) {
+	compressed, err := compressGzip([]byte("body"))
+	require.NoError(t, err)
+	r, err := newGzipReader(compressed)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+	// The reader can be in use by another body once closed.
+	_, err = r.Read(make([]byte, 1))
+	assert.Equal(t, errReaderClosed, err)
+}
+
+func TestDecompressReader(t *testing.T) {
+	testBody := []byte("uncompressed_text")
+	gzipped, err := compressGzip(testBody)
+	require.NoError(t, err)
+	zlibCompressed, err := compressZlib(testBody)
+	require.NoError(t, err)
+
+	for encoding, body := range map[string][]byte{
+		"gzip":     gzipped.Bytes(),
+		"deflate":  zlibCompressed.Bytes(),
+		"zlib":     zlibCompressed.Bytes(),
+		"identity": testBody,
+		"GZIP":     gzipped.Bytes(),
+		"Deflate":  zlibCompressed.Bytes(),
+		"Identity": testBody,
+	} {
+		t.Run(encoding, func(t *testing.T) {
+			r, err := DecompressReader(encoding, bytes.NewReader(body))
+			require.NoError(t, err)
+			got, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			assert.Equal(t, testBody, got)
+		})
+	}
+
+	_, err = DecompressReader("lz4", bytes.NewReader(testBody))
+	assert.EqualError(t, err, `unsupported content encoding "lz4"`)
+	var unsupported *UnsupportedEncodingError
+	require.True(t, errors.As(err, &unsupported))
+	assert.Equal(t, "lz4", unsupported.Encoding)
+	assert.Contains(t, unsupported.Supported, "gzip")
+	assert.Contains(t, unsupported.Supported, "identity")
+	_, err = DecompressReader("gzip", bytes.NewReader(testBody))
+	assert.Error(t, err)
+}
+
+func BenchmarkHTTPContentDecompressionGzip(b *testing.B) {
+	compressed, err := compressGzip(bytes.Repeat([]byte("payload"), 1024))
+	require.NoError(b, err)
+	h := HTTPContentDecompressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.Copy(ioutil.Discard, r.Body)
+		assert.NoError(b, err)
+	}))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(compressed.Bytes()))
+		req.Header.Set("Content-Encoding", "gzip")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
 func compressGzip(body []byte) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
 
@@ -0,0 +1,66 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The zstd decoder does not need a build tag, its module is already a
+// dependency of the collector.
+func init() {
+	decoders["zstd"] = newZstdReader
+}
+
+// zstdMaxWindowSize bounds the memory allocated by the decoder for the window
+// declared by the frames, that is up to 3.75TB in the format.
+const zstdMaxWindowSize = 64 << 20
+
+type zstdReader struct {
+	*bufio.Reader
+	zr *zstd.Decoder
+}
+
+func newZstdReader(body io.Reader) (io.ReadCloser, error) {
+	// The frames are decoded by the goroutine reading the body.
+	zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(zstdMaxWindowSize))
+	if err != nil {
+		return nil, err
+	}
+	r := &zstdReader{Reader: bufio.NewReader(zr), zr: zr}
+	// Like brotli, the header is only validated when the stream is decoded, the
+	// beginning of the stream is decoded so that invalid bodies are rejected
+	// with a 400 status before reaching the next handler.
+	if _, err := r.Peek(1); err != nil && err != io.EOF {
+		zr.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *zstdReader) Close() error {
+	r.zr.Close()
+	return nil
+}
+
+// isZstd returns whether the buffered body starts with the magic number of the
+// zstd frames, see RFC 8878.
+func isZstd(body *bufio.Reader) bool {
+	header, err := body.Peek(4)
+	return err == nil && header[0] == 0x28 && header[1] == 0xb5 && header[2] == 0x2f && header[3] == 0xfd
+}
@@ -0,0 +1,74 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type contentTypeFilter struct {
+	mediaTypes   map[string]struct{}
+	supported    string
+	errorHandler ErrorHandler
+}
+
+type ContentTypeFilterOption func(f *contentTypeFilter)
+
+// WithContentTypeFilterErrorHandler overrides the HTTP error handler invoked
+// when a request is rejected because of its content type.
+func WithContentTypeFilterErrorHandler(e ErrorHandler) ContentTypeFilterOption {
+	return func(f *contentTypeFilter) {
+		f.errorHandler = e
+	}
+}
+
+// ContentTypeFilter is a middleware that rejects the requests with a 415 status
+// when the media type of their "Content-Type" header is not one of the given
+// media types. The parameters of the header, like the charset, are ignored.
+// The OPTIONS requests, like the CORS preflight requests, have no body and are
+// not filtered.
+func ContentTypeFilter(h http.Handler, mediaTypes []string, opts ...ContentTypeFilterOption) http.Handler {
+	f := &contentTypeFilter{
+		mediaTypes: make(map[string]struct{}, len(mediaTypes)),
+		supported:  strings.Join(mediaTypes, ", "),
+	}
+	for _, mt := range mediaTypes {
+		f.mediaTypes[strings.ToLower(mt)] = struct{}{}
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	if f.errorHandler == nil {
+		f.errorHandler = defaultErrorHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+		contentType := r.Header.Get("Content-Type")
+		// ParseMediaType returns the media type in lower case.
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if _, ok := f.mediaTypes[mediaType]; err != nil || !ok {
+			recordRejection(r, RejectionReasonUnsupportedMediaType)
+			f.errorHandler(w, r, fmt.Sprintf("unsupported content type %q, supported content types: %s", contentType, f.supported), http.StatusUnsupportedMediaType)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentTypeFilter(t *testing.T) {
+	h := ContentTypeFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), []string{"application/x-protobuf", "application/json"})
+	tests := []struct {
+		contentType string
+		wantStatus  int
+		wantBody    string
+	}{
+		{contentType: "application/x-protobuf", wantStatus: http.StatusOK, wantBody: "ok"},
+		{contentType: "Application/JSON; charset=utf-8", wantStatus: http.StatusOK, wantBody: "ok"},
+		{
+			contentType: "text/plain",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantBody:    "unsupported content type \"text/plain\", supported content types: application/x-protobuf, application/json\n",
+		},
+		{
+			contentType: "",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantBody:    "unsupported content type \"\", supported content types: application/x-protobuf, application/json\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
+
+func TestContentTypeFilterOptions(t *testing.T) {
+	h := ContentTypeFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), []string{"application/x-protobuf"})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,118 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// DefaultRequestIDHeader is the default header with the id of the requests.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+type contextLogger struct {
+	logger          *zap.Logger
+	requestIDHeader string
+	tenantHeader    string
+}
+
+type ContextLoggerOption func(l *contextLogger)
+
+// WithRequestIDHeader sets the header with the id of the requests. Empty values
+// keep the default of DefaultRequestIDHeader.
+func WithRequestIDHeader(header string) ContextLoggerOption {
+	return func(l *contextLogger) {
+		if header != "" {
+			l.requestIDHeader = header
+		}
+	}
+}
+
+// WithTenantHeader sets the header with the tenant of the requests, added to
+// the logger when present. Disabled if empty.
+func WithTenantHeader(header string) ContextLoggerOption {
+	return func(l *contextLogger) {
+		l.tenantHeader = header
+	}
+}
+
+type contextLoggerKey struct{}
+
+// ContextLogger is a middleware that puts in the request context a logger
+// derived from logger with the id of the request, the tenant and the trace id
+// of the W3C "traceparent" header, to correlate the logs of the handlers and
+// of the consumers of the request, see LoggerFromContext. The id is read from
+// the request id header, or generated if it is absent and then set on the
+// request so that the next handlers see it.
+func ContextLogger(h http.Handler, logger *zap.Logger, opts ...ContextLoggerOption) http.Handler {
+	l := &contextLogger{
+		logger:          logger,
+		requestIDHeader: DefaultRequestIDHeader,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(l.requestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+			r.Header.Set(l.requestIDHeader, requestID)
+		}
+		fields := []zap.Field{zap.String("request_id", requestID)}
+		if l.tenantHeader != "" {
+			if tenant := r.Header.Get(l.tenantHeader); tenant != "" {
+				fields = append(fields, zap.String("tenant", tenant))
+			}
+		}
+		if traceID, ok := traceIDFromTraceparent(r.Header.Get("traceparent")); ok {
+			fields = append(fields, zap.String("trace_id", traceID))
+		}
+		ctx := context.WithValue(r.Context(), contextLoggerKey{}, l.logger.With(fields...))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoggerFromContext returns the logger put in the request context by
+// ContextLogger, or false if there is none.
+func LoggerFromContext(ctx context.Context) (*zap.Logger, bool) {
+	logger, ok := ctx.Value(contextLoggerKey{}).(*zap.Logger)
+	return logger, ok
+}
+
+// newRequestID returns a random id of 16 bytes in hexadecimal.
+func newRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// traceIDFromTraceparent returns the trace id of a W3C "traceparent" header,
+// e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func traceIDFromTraceparent(traceparent string) (string, bool) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 {
+		return "", false
+	}
+	traceID := strings.ToLower(parts[1])
+	if _, err := hex.DecodeString(traceID); err != nil || traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return traceID, true
+}
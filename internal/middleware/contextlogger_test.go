@@ -0,0 +1,84 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestContextLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	var gotRequestID string
+	h := ContextLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRequestID = r.Header.Get("X-Correlation-Id")
+		logger, ok := LoggerFromContext(r.Context())
+		require.True(t, ok)
+		logger.Info("consumed")
+	}), zap.New(core), WithRequestIDHeader("X-Correlation-Id"), WithTenantHeader("X-Scope-OrgID"))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Correlation-Id", "abc")
+	req.Header.Set("X-Scope-OrgID", "tenant-1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, map[string]interface{}{
+		"request_id": "abc",
+		"tenant":     "tenant-1",
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+	}, logs.All()[0].ContextMap())
+	assert.Equal(t, "abc", gotRequestID)
+
+	// The id is generated when absent.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	require.Equal(t, 2, logs.Len())
+	fields := logs.All()[1].ContextMap()
+	assert.Len(t, fields["request_id"], 32)
+	assert.Equal(t, fields["request_id"], gotRequestID)
+	assert.NotContains(t, fields, "tenant")
+	assert.NotContains(t, fields, "trace_id")
+}
+
+func TestLoggerFromContextMissing(t *testing.T) {
+	_, ok := LoggerFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestTraceIDFromTraceparent(t *testing.T) {
+	tests := []struct {
+		traceparent string
+		want        string
+	}{
+		{traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{traceparent: ""},
+		{traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{traceparent: "00-not-hex-01"},
+		{traceparent: "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01"},
+	}
+	for _, tt := range tests {
+		got, ok := traceIDFromTraceparent(tt.traceparent)
+		assert.Equal(t, tt.want != "", ok, tt.traceparent)
+		assert.Equal(t, tt.want, got)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// DebugHandler is a middleware that serves the pprof profiles under
+// prefix+"/pprof/" and the expvar variables at prefix+"/vars", without calling
+// the next handler(s), for the in-situ debugging of the server. Only the
+// requests from a peer in allowed, or with the "Authorization: Bearer <token>"
+// header when token is not empty, are answered, the others are rejected with a
+// 404 status so that the debug endpoints are not disclosed. The peer is the
+// RemoteAddr of the request as accepted by the server, the forwarded headers are
+// not trusted. The other requests are passed to h.
+func DebugHandler(h http.Handler, prefix string, allowed []*net.IPNet, token string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		// pprof.Index only serves the profiles under "/debug/pprof/".
+		name := strings.TrimPrefix(r.URL.Path, prefix+"/pprof/")
+		if name == "" {
+			pprof.Index(w, r)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, r)
+	})
+	mux.HandleFunc(prefix+"/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc(prefix+"/pprof/profile", pprof.Profile)
+	mux.HandleFunc(prefix+"/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc(prefix+"/pprof/trace", pprof.Trace)
+	mux.Handle(prefix+"/vars", expvar.Handler())
+
+	authorized := func(r *http.Request) bool {
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") &&
+				subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(token)) == 1 {
+				return true
+			}
+		}
+		peer := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(peer); err == nil {
+			peer = host
+		}
+		if ip := net.ParseIP(peer); ip != nil {
+			for _, n := range allowed {
+				if n.Contains(ip) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if !authorized(r) {
+			http.NotFound(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
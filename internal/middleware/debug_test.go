@@ -0,0 +1,74 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	_, allowed, _ := net.ParseCIDR("10.0.0.0/8")
+	handler := DebugHandler(next, "/debug/", []*net.IPNet{allowed}, "secret")
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		auth       string
+		wantCode   int
+	}{
+		{name: "allowed_ip_vars", path: "/debug/vars", remoteAddr: "10.1.2.3:1234", wantCode: http.StatusOK},
+		{name: "allowed_ip_pprof_index", path: "/debug/pprof/", remoteAddr: "10.1.2.3:1234", wantCode: http.StatusOK},
+		{name: "allowed_ip_pprof_profile", path: "/debug/pprof/goroutine", remoteAddr: "10.1.2.3:1234", wantCode: http.StatusOK},
+		{name: "allowed_ip_unknown_path", path: "/debug/other", remoteAddr: "10.1.2.3:1234", wantCode: http.StatusNotFound},
+		{name: "token", path: "/debug/vars", remoteAddr: "192.0.2.1:1234", auth: "Bearer secret", wantCode: http.StatusOK},
+		{name: "wrong_token", path: "/debug/vars", remoteAddr: "192.0.2.1:1234", auth: "Bearer other", wantCode: http.StatusNotFound},
+		{name: "not_allowed", path: "/debug/pprof/", remoteAddr: "192.0.2.1:1234", wantCode: http.StatusNotFound},
+		{name: "other_path", path: "/v1/traces", remoteAddr: "192.0.2.1:1234", wantCode: http.StatusAccepted},
+		{name: "prefix_lookalike", path: "/debugger", remoteAddr: "10.1.2.3:1234", wantCode: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path+"?debug=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+}
+
+func TestDebugHandlerForwardedHeadersIgnored(t *testing.T) {
+	_, allowed, _ := net.ParseCIDR("127.0.0.1/32")
+	handler := DebugHandler(http.NotFoundHandler(), "/debug", []*net.IPNet{allowed}, "")
+
+	req := httptest.NewRequest("GET", "/debug/vars", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "127.0.0.1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,251 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	// #nosec
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrDigestMismatch is the error returned when reading the end of a request
+// body whose hash is not the one of its digest header.
+var ErrDigestMismatch = errors.New("the request body does not match its digest")
+
+// digestAlgorithms maps the supported algorithms of the "Digest" header, in
+// lower case, to their hash.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+type digestValidator struct {
+	errorHandler ErrorHandler
+}
+
+type DigestValidatorOption func(v *digestValidator)
+
+// WithDigestErrorHandler overrides the HTTP error handler invoked when a
+// request is rejected because of its digest.
+func WithDigestErrorHandler(e ErrorHandler) DigestValidatorOption {
+	return func(v *digestValidator) {
+		v.errorHandler = e
+	}
+}
+
+// DigestValidator is a middleware that checks the request bodies against their
+// "Content-MD5" header, see RFC 1864, or their "Digest" header, see RFC 3230,
+// with the md5, sha-256 and sha-512 algorithms. The body is hashed while it is
+// read by the handler, and reading its end returns ErrDigestMismatch when one
+// of the hashes does not match. The requests are rejected with a 400 status
+// when a digest of a supported algorithm is malformed, or when the mismatch is
+// detected before the handler writes its response: the response of the
+// handler is then replaced. The requests without digest of a supported
+// algorithm are not checked.
+func DigestValidator(h http.Handler, opts ...DigestValidatorOption) http.Handler {
+	v := &digestValidator{}
+	for _, o := range opts {
+		o(v)
+	}
+	if v.errorHandler == nil {
+		v.errorHandler = defaultErrorHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		digests, err := parseDigests(r.Header)
+		if err != nil {
+			recordRejection(r, RejectionReasonDigestMismatch)
+			v.errorHandler(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(digests) == 0 || r.Body == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		state := &digestState{}
+		r.Body = &digestReadCloser{ReadCloser: r.Body, digests: digests, state: state}
+		dw := &digestWriter{StatusRecorder: NewStatusRecorder(w), state: state}
+		h.ServeHTTP(dw, r)
+		if state.replaceResponse() {
+			recordRejection(r, RejectionReasonDigestMismatch)
+			v.errorHandler(w, r, ErrDigestMismatch.Error(), http.StatusBadRequest)
+		}
+	})
+}
+
+// expectedDigest is a hash of the body and the value expected at its end.
+type expectedDigest struct {
+	hash hash.Hash
+	sum  []byte
+}
+
+// parseDigests returns the digests of the supported algorithms of the headers,
+// the unknown algorithms are ignored.
+func parseDigests(header http.Header) ([]expectedDigest, error) {
+	var digests []expectedDigest
+	if value := header.Get("Content-MD5"); value != "" {
+		d, err := newExpectedDigest("md5", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-MD5 header: %w", err)
+		}
+		digests = append(digests, d)
+	}
+	for _, value := range header.Values("Digest") {
+		for _, item := range strings.Split(value, ",") {
+			algorithm, sum := item, ""
+			if i := strings.IndexByte(item, '='); i >= 0 {
+				algorithm, sum = item[:i], item[i+1:]
+			}
+			algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+			if _, ok := digestAlgorithms[algorithm]; !ok {
+				continue
+			}
+			d, err := newExpectedDigest(algorithm, strings.TrimSpace(sum))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value of the Digest header: %w", algorithm, err)
+			}
+			digests = append(digests, d)
+		}
+	}
+	return digests, nil
+}
+
+func newExpectedDigest(algorithm, value string) (expectedDigest, error) {
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return expectedDigest{}, err
+	}
+	h := digestAlgorithms[algorithm]()
+	if len(sum) != h.Size() {
+		return expectedDigest{}, fmt.Errorf("%d bytes instead of %d", len(sum), h.Size())
+	}
+	return expectedDigest{hash: h, sum: sum}, nil
+}
+
+// digestState tracks whether the mismatch was detected before the response.
+type digestState struct {
+	mu          sync.Mutex
+	mismatch    bool
+	wroteHeader bool
+}
+
+// setMismatch records the mismatch detected at the end of the body.
+func (s *digestState) setMismatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mismatch = true
+}
+
+// writeHeader records that the handler writes its response and returns whether
+// it is discarded because of a mismatch.
+func (s *digestState) writeHeader() (discard bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mismatch {
+		return true
+	}
+	s.wroteHeader = true
+	return false
+}
+
+// replaceResponse returns whether the response of the handler was discarded
+// and has to be replaced by the rejection.
+func (s *digestState) replaceResponse() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mismatch && !s.wroteHeader
+}
+
+// digestReadCloser hashes the body while it is read and compares the hashes
+// with the digests at its end.
+type digestReadCloser struct {
+	io.ReadCloser
+	digests []expectedDigest
+	state   *digestState
+	// err is the error returned once the end of the body was read.
+	err error
+}
+
+func (r *digestReadCloser) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.ReadCloser.Read(p)
+	for _, d := range r.digests {
+		_, _ = d.hash.Write(p[:n])
+	}
+	if err != io.EOF {
+		return n, err
+	}
+	for _, d := range r.digests {
+		if !bytes.Equal(d.hash.Sum(nil), d.sum) {
+			r.state.setMismatch()
+			r.err = ErrDigestMismatch
+			return n, r.err
+		}
+	}
+	r.err = io.EOF
+	return n, r.err
+}
+
+// digestWriter discards the response of the handler once a mismatch was
+// detected, to be replaced by the rejection.
+type digestWriter struct {
+	*StatusRecorder
+	state     *digestState
+	started   bool
+	discarded bool
+}
+
+func (w *digestWriter) WriteHeader(statusCode int) {
+	if w.started {
+		if !w.discarded {
+			w.StatusRecorder.WriteHeader(statusCode)
+		}
+		return
+	}
+	w.started = true
+	w.discarded = w.state.writeHeader()
+	if !w.discarded {
+		w.StatusRecorder.WriteHeader(statusCode)
+	}
+}
+
+func (w *digestWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discarded {
+		return len(b), nil
+	}
+	return w.StatusRecorder.Write(b)
+}
+
+func (w *digestWriter) Flush() {
+	if w.discarded {
+		return
+	}
+	w.StatusRecorder.Flush()
+}
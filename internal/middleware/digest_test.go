@@ -0,0 +1,137 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	// #nosec
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestValidator(t *testing.T) {
+	const body = "payload"
+	md5Sum := md5.Sum([]byte(body)) // #nosec
+	sha256Sum := sha256.Sum256([]byte(body))
+	validMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	validSHA256 := base64.StdEncoding.EncodeToString(sha256Sum[:])
+	otherSum := sha256.Sum256([]byte("other"))
+	invalidSHA256 := base64.StdEncoding.EncodeToString(otherSum[:])
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+		wantErr    error
+	}{
+		{
+			name:       "no_digest",
+			header:     http.Header{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "content_md5",
+			header:     http.Header{"Content-Md5": {validMD5}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "digest",
+			header:     http.Header{"Digest": {"SHA-256=" + validSHA256 + ", md5=" + validMD5}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown_algorithm",
+			header:     http.Header{"Digest": {"unixsum=30637"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "mismatch",
+			header:     http.Header{"Digest": {"md5=" + validMD5 + ",sha-256=" + invalidSHA256}},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    ErrDigestMismatch,
+		},
+		{
+			name:       "malformed",
+			header:     http.Header{"Digest": {"sha-256=" + validMD5}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readErr error
+			h := DigestValidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = ioutil.ReadAll(r.Body)
+				if readErr != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_, _ = w.Write([]byte("ok"))
+			}))
+			req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantErr, readErr)
+			if tt.wantErr != nil {
+				assert.Contains(t, rec.Body.String(), ErrDigestMismatch.Error())
+			}
+		})
+	}
+}
+
+func TestDigestValidatorDecompressed(t *testing.T) {
+	const body = "payload"
+	sum := sha256.Sum256([]byte(body))
+	var got string
+	h := HTTPContentDecompressor(DigestValidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		got = string(b)
+	})))
+	compressed, err := compressGzip([]byte(body))
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/", compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, body, got)
+}
+
+func TestDigestValidatorMismatchAfterResponse(t *testing.T) {
+	// The response already written by the handler is not replaced.
+	h := DigestValidator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, err := ioutil.ReadAll(r.Body)
+		assert.Equal(t, ErrDigestMismatch, err)
+	}))
+	req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(make([]byte, md5.Size)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+}
@@ -0,0 +1,81 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type headerLimits struct {
+	errorHandler ErrorHandler
+}
+
+type HeaderLimitsOption func(l *headerLimits)
+
+// WithHeaderLimitsErrorHandler overrides the HTTP error handler invoked when a
+// request is rejected because of its headers.
+func WithHeaderLimitsErrorHandler(e ErrorHandler) HeaderLimitsOption {
+	return func(l *headerLimits) {
+		l.errorHandler = e
+	}
+}
+
+// HeaderLimiter is a middleware that rejects with a 431 status the requests
+// with more than maxHeaders header values, or with a header name longer than
+// maxNameLength or a header value longer than maxValueLength, to protect the
+// server from the clients sending many small headers that the limit of the
+// total size of the headers does not catch. The limits are disabled if zero.
+func HeaderLimiter(h http.Handler, maxHeaders, maxNameLength, maxValueLength int, opts ...HeaderLimitsOption) http.Handler {
+	l := &headerLimits{}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.errorHandler == nil {
+		l.errorHandler = defaultErrorHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if msg := checkHeaderLimits(r.Header, maxHeaders, maxNameLength, maxValueLength); msg != "" {
+			recordRejection(r, RejectionReasonHeaderLimit)
+			l.errorHandler(w, r, msg, http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkHeaderLimits returns the message of the rejection of the headers, or
+// empty if they are within the limits. The header values are not included in
+// the messages.
+func checkHeaderLimits(header http.Header, maxHeaders, maxNameLength, maxValueLength int) string {
+	count := 0
+	for name, values := range header {
+		count += len(values)
+		if maxHeaders > 0 && count > maxHeaders {
+			return fmt.Sprintf("the request has more than %d headers", maxHeaders)
+		}
+		if maxNameLength > 0 && len(name) > maxNameLength {
+			return fmt.Sprintf("the request has a header name longer than %d bytes", maxNameLength)
+		}
+		if maxValueLength > 0 {
+			for _, value := range values {
+				if len(value) > maxValueLength {
+					return fmt.Sprintf("the value of the %q header is longer than %d bytes", name, maxValueLength)
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderLimiter(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "within_limits",
+			handler:  HeaderLimiter(next, 3, 10, 10),
+			header:   http.Header{"X-A": {"1", "2"}, "X-B": {"0123456789"}},
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "too_many_headers",
+			handler:  HeaderLimiter(next, 3, 0, 0),
+			header:   http.Header{"X-A": {"1", "2"}, "X-B": {"3", "4"}},
+			wantCode: http.StatusRequestHeaderFieldsTooLarge,
+			wantBody: "the request has more than 3 headers\n",
+		},
+		{
+			name:     "name_too_long",
+			handler:  HeaderLimiter(next, 0, 10, 0),
+			header:   http.Header{"X-" + strings.Repeat("a", 9): {"1"}},
+			wantCode: http.StatusRequestHeaderFieldsTooLarge,
+			wantBody: "the request has a header name longer than 10 bytes\n",
+		},
+		{
+			name:     "value_too_long",
+			handler:  HeaderLimiter(next, 0, 0, 10),
+			header:   http.Header{"X-A": {"short", strings.Repeat("a", 11)}},
+			wantCode: http.StatusRequestHeaderFieldsTooLarge,
+			wantBody: "the value of the \"X-A\" header is longer than 10 bytes\n",
+		},
+		{
+			name:     "disabled",
+			handler:  HeaderLimiter(next, 0, 0, 0),
+			header:   http.Header{"X-" + strings.Repeat("a", 100): {strings.Repeat("a", 100)}},
+			wantCode: http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHeaderLimiterErrorHandler(t *testing.T) {
+	var gotCode int
+	handler := HeaderLimiter(http.NotFoundHandler(), 1, 0, 0, WithHeaderLimitsErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		gotCode = statusCode
+	}))
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header = http.Header{"X-A": {"1", "2"}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, gotCode)
+}
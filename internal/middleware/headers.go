@@ -0,0 +1,75 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"sort"
+)
+
+type headerRename struct {
+	source string
+	target string
+}
+
+// HeaderRenamer is a middleware that renames the request headers according to
+// the renames map, from the source header names (the keys) to the target header
+// names (the values), so that the handlers further in the chain only see the
+// target names. The source headers are removed. A target header already present
+// in the request is kept, and when several source headers of the request have the
+// same target the first one in the alphabetical order is used.
+func HeaderRenamer(h http.Handler, renames map[string]string) http.Handler {
+	rules := make([]headerRename, 0, len(renames))
+	for source, target := range renames {
+		rules = append(rules, headerRename{
+			source: http.CanonicalHeaderKey(source),
+			target: http.CanonicalHeaderKey(target),
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].source < rules[j].source })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			values, ok := r.Header[rule.source]
+			if !ok || rule.source == rule.target {
+				continue
+			}
+			delete(r.Header, rule.source)
+			if _, exists := r.Header[rule.target]; !exists {
+				r.Header[rule.target] = values
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ResponseHeaders is a middleware that sets the given headers on all the
+// responses, including the error responses of the middlewares further in the
+// chain. The headers are set before calling the next handler, so that they are
+// sent whether or not the handler calls WriteHeader, and the handler can still
+// override them.
+func ResponseHeaders(h http.Handler, headers map[string]string) http.Handler {
+	canonical := make(map[string]string, len(headers))
+	for k, v := range headers {
+		canonical[http.CanonicalHeaderKey(k)] = v
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		for k, v := range canonical {
+			header[k] = []string{v}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
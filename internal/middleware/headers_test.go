@@ -0,0 +1,116 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderRenamer(t *testing.T) {
+	renames := map[string]string{
+		"x-tenant":    "X-Scope-OrgID",
+		"X-Org-Id":    "x-scope-orgid",
+		"X-Unchanged": "X-Unchanged",
+	}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    http.Header
+	}{
+		{
+			name:    "renamed",
+			headers: map[string]string{"X-Tenant": "a", "Other": "b"},
+			want:    http.Header{"X-Scope-Orgid": {"a"}, "Other": {"b"}},
+		},
+		{
+			name:    "target_kept",
+			headers: map[string]string{"X-Tenant": "a", "X-Scope-OrgID": "b"},
+			want:    http.Header{"X-Scope-Orgid": {"b"}},
+		},
+		{
+			name:    "first_source",
+			headers: map[string]string{"X-Tenant": "a", "X-Org-Id": "b"},
+			want:    http.Header{"X-Scope-Orgid": {"b"}},
+		},
+		{
+			name:    "same_name",
+			headers: map[string]string{"X-Unchanged": "a"},
+			want:    http.Header{"X-Unchanged": {"a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			h := HeaderRenamer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}), renames)
+			req := httptest.NewRequest("POST", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	headers := map[string]string{
+		"x-collector-instance": "collector-1",
+		"X-Overridden":         "default",
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    http.Header
+	}{
+		{
+			name:    "no_write",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    http.Header{"X-Collector-Instance": {"collector-1"}, "X-Overridden": {"default"}},
+		},
+		{
+			name: "write_header",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Overridden", "handler")
+				w.WriteHeader(http.StatusAccepted)
+			},
+			want: http.Header{"X-Collector-Instance": {"collector-1"}, "X-Overridden": {"handler"}},
+		},
+		{
+			name: "error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "error", http.StatusBadRequest)
+			},
+			want: http.Header{
+				"X-Collector-Instance":   {"collector-1"},
+				"X-Overridden":           {"default"},
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ResponseHeaders(tt.handler, headers).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(t, tt.want, rec.Result().Header)
+		})
+	}
+}
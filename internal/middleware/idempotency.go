@@ -0,0 +1,230 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// IdempotentReplayedHeader is set to "true" on the responses replayed from the
+// cache of the Idempotency middleware.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// defaultIdempotencyMaxResponseSize is the default maximum size of the cached
+// response bodies, see WithIdempotencyMaxResponseSize.
+const defaultIdempotencyMaxResponseSize = 64 << 10
+
+type IdempotencyOption func(c *idempotencyCache)
+
+// WithIdempotencyErrorHandler overrides the HTTP error handler invoked when a
+// request is rejected because its key was used by a request with another body.
+func WithIdempotencyErrorHandler(e ErrorHandler) IdempotencyOption {
+	return func(c *idempotencyCache) {
+		c.errorHandler = e
+	}
+}
+
+// WithIdempotencyMaxResponseSize sets the maximum size of the response bodies
+// cached, the larger responses are not cached. (default 64KiB)
+func WithIdempotencyMaxResponseSize(size int) IdempotencyOption {
+	return func(c *idempotencyCache) {
+		c.maxResponseSize = size
+	}
+}
+
+// Idempotency is a middleware that caches during ttl the successful (2xx)
+// responses to the requests with the given header, keyed by the method, the
+// path and the value of the header, and replays them to the requests with the
+// same key and the same body instead of calling the next handler again, so that
+// the retries of a request whose response was lost are not processed twice. The
+// requests with the key of a request being handled wait for its response, the
+// ones with another body are rejected with a 422 status. At most maxEntries
+// responses are kept, the least recently used ones are evicted first.
+func Idempotency(h http.Handler, header string, ttl time.Duration, maxEntries int, opts ...IdempotencyOption) http.Handler {
+	c := &idempotencyCache{entries: lru.New(maxEntries), ttl: ttl, maxResponseSize: defaultIdempotencyMaxResponseSize}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.errorHandler == nil {
+		c.errorHandler = defaultErrorHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(header)
+		if value == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			// The handler gets the read error, e.g. of a body over the limit.
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+			h.ServeHTTP(w, r)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		digest := sha256.Sum256(body)
+		key := r.Method + " " + r.URL.Path + " " + value
+		for {
+			e, owner := c.acquire(key, digest)
+			if owner {
+				c.handle(h, w, r, key, e)
+				return
+			}
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				return
+			}
+			if e.ok {
+				if e.digest != digest {
+					recordRejection(r, RejectionReasonIdempotencyKeyReuse)
+					c.errorHandler(w, r, "the idempotency key was used by a request with another body", http.StatusUnprocessableEntity)
+					return
+				}
+				e.replay(w)
+				return
+			}
+			// The request failed and was removed from the cache, the next
+			// request with the key handles it again.
+		}
+	})
+}
+
+type idempotencyCache struct {
+	mu              sync.Mutex
+	entries         *lru.Cache
+	ttl             time.Duration
+	maxResponseSize int
+	errorHandler    ErrorHandler
+}
+
+// idempotentResponse is the response to the request with the body of the given
+// digest, complete once done is closed.
+type idempotentResponse struct {
+	digest  [sha256.Size]byte
+	done    chan struct{}
+	ok      bool
+	expires time.Time
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+// acquire returns the cached response of the key, or a new pending response
+// that the caller owns and must complete if there is none.
+func (c *idempotencyCache) acquire(key string, digest [sha256.Size]byte) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, found := c.entries.Get(key); found {
+		e := v.(*idempotentResponse)
+		select {
+		case <-e.done:
+			if time.Now().Before(e.expires) {
+				return e, false
+			}
+		default:
+			return e, false
+		}
+	}
+	e := &idempotentResponse{digest: digest, done: make(chan struct{})}
+	c.entries.Add(key, e)
+	return e, true
+}
+
+// handle calls the handler and completes the response e of the key, removed
+// from the cache if it is not successful or too large.
+func (c *idempotencyCache) handle(h http.Handler, w http.ResponseWriter, r *http.Request, key string, e *idempotentResponse) {
+	rw := &idempotencyWriter{StatusRecorder: NewStatusRecorder(w), maxSize: c.maxResponseSize}
+	defer func() {
+		p := recover()
+		c.mu.Lock()
+		if status := rw.Status(); p == nil && !rw.overflow && status >= 200 && status < 300 {
+			e.ok = true
+			e.expires = time.Now().Add(c.ttl)
+			e.status = status
+			e.header = rw.header
+			if e.header == nil {
+				e.header = w.Header().Clone()
+			}
+			e.body = rw.body.Bytes()
+		} else if v, found := c.entries.Get(key); found && v == e {
+			c.entries.Remove(key)
+		}
+		c.mu.Unlock()
+		close(e.done)
+		if p != nil {
+			panic(p)
+		}
+	}()
+	h.ServeHTTP(rw, r)
+}
+
+func (e *idempotentResponse) replay(w http.ResponseWriter) {
+	for k, v := range e.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(e.status)
+	_, _ = w.Write(e.body)
+}
+
+// idempotencyWriter keeps a copy of the response written by the handler, unless
+// its body is larger than maxSize.
+type idempotencyWriter struct {
+	*StatusRecorder
+	header   http.Header
+	body     bytes.Buffer
+	maxSize  int
+	overflow bool
+}
+
+func (w *idempotencyWriter) WriteHeader(statusCode int) {
+	w.StatusRecorder.WriteHeader(statusCode)
+	if w.header == nil && w.WroteHeader() {
+		w.header = w.Header().Clone()
+	}
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	if !w.WroteHeader() {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.maxSize {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.StatusRecorder.Write(b)
+}
+
+// errorReader returns err on every read.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
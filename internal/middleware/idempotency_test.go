@@ -0,0 +1,186 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls int32
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte{'0' + byte(n)})
+	}), "Idempotency-Key", time.Minute, 2)
+
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("/", "a")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "1", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+
+	rec = send("/", "a")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "1", rec.Body.String())
+	assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rec.Header().Get(IdempotentReplayedHeader))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	// Without key, or with the key on another path.
+	assert.Equal(t, "2", send("/", "").Body.String())
+	assert.Equal(t, "3", send("/other", "a").Body.String())
+
+	// The failed responses are not cached.
+	assert.Equal(t, http.StatusServiceUnavailable, send("/fail", "b").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, send("/fail", "b").Code)
+	assert.EqualValues(t, 5, atomic.LoadInt32(&calls))
+
+	// "/ a" is the least recently used and evicted.
+	assert.Equal(t, "6", send("/", "c").Body.String())
+	assert.Equal(t, "7", send("/", "a").Body.String())
+}
+
+func TestIdempotencyBodyMismatch(t *testing.T) {
+	var bodies []string
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}), "Idempotency-Key", time.Minute, 10)
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "a")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusAccepted, send("first").Code)
+	assert.Equal(t, http.StatusAccepted, send("first").Code)
+	rec := send("second")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "the idempotency key was used by a request with another body\n", rec.Body.String())
+	assert.Equal(t, []string{"first"}, bodies)
+}
+
+func TestIdempotencyMaxResponseSize(t *testing.T) {
+	var calls int32
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(r.URL.Path))
+	}), "Idempotency-Key", time.Minute, 10, WithIdempotencyMaxResponseSize(4))
+	send := func(path string) string {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Idempotency-Key", "a")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	// The responses over the size are not cached.
+	assert.Equal(t, "/large", send("/large"))
+	assert.Equal(t, "/large", send("/large"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	assert.Equal(t, "/abc", send("/abc"))
+	assert.Equal(t, "/abc", send("/abc"))
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyBodyReadError(t *testing.T) {
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "partial", string(body))
+		assert.EqualError(t, err, "body too large")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}), "Idempotency-Key", time.Minute, 10)
+	req := httptest.NewRequest("POST", "/", ioutil.NopCloser(io.MultiReader(strings.NewReader("partial"), errorReader{errors.New("body too large")})))
+	req.Header.Set("Idempotency-Key", "a")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestIdempotencyTTL(t *testing.T) {
+	var calls int32
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}), "Idempotency-Key", 50*time.Millisecond, 10)
+	send := func() {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Idempotency-Key", "a")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send()
+	send()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	time.Sleep(100 * time.Millisecond)
+	send()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestIdempotencyConcurrent(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		_, _ = w.Write([]byte("done"))
+	}), "Idempotency-Key", time.Minute, 10)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Idempotency-Key", "a")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			bodies[i] = rec.Body.String()
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	assert.Equal(t, []string{"done", "done", "done", "done", "done"}, bodies)
+}
@@ -0,0 +1,62 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+)
+
+type inflightLimiter struct {
+	errorHandler ErrorHandler
+	slots        chan struct{}
+}
+
+type InflightLimiterOption func(l *inflightLimiter)
+
+// WithInflightLimiterErrorHandler overrides the HTTP error handler invoked when
+// a request is rejected because the maximum number of in-flight requests is
+// reached.
+func WithInflightLimiterErrorHandler(e ErrorHandler) InflightLimiterOption {
+	return func(l *inflightLimiter) {
+		l.errorHandler = e
+	}
+}
+
+// InflightLimiter is a middleware that limits the number of requests handled
+// concurrently to max, rejecting the requests over the limit with a 503 status
+// instead of queuing them, so that the clients back off while the server is
+// overloaded. Unlike AdaptiveConcurrencyLimiter the limit is fixed.
+func InflightLimiter(h http.Handler, max int, opts ...InflightLimiterOption) http.Handler {
+	l := &inflightLimiter{slots: make(chan struct{}, max)}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.errorHandler == nil {
+		l.errorHandler = defaultErrorHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			recordRejection(r, RejectionReasonInflightLimit)
+			l.errorHandler(w, r, "too many in-flight requests", http.StatusServiceUnavailable)
+			return
+		}
+		defer func() {
+			<-l.slots
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+
+	// Parameters of the gradient algorithm, the values are the ones used by
+	// https://github.com/Netflix/concurrency-limits Gradient2Limit.
+	limitSmoothing = 0.2
+	rttTolerance   = 1.5
+	longRTTWindow  = 600
+)
+
+type adaptiveLimiter struct {
+	errorHandler ErrorHandler
+
+	mu       sync.Mutex
+	limit    float64
+	minLimit float64
+	maxLimit float64
+	inflight int
+	longRTT  float64
+	samples  int
+}
+
+type AdaptiveLimiterOption func(l *adaptiveLimiter)
+
+// WithLimits sets the initial concurrency limit and the bounds within which the
+// limit is adjusted. Non positive values keep the defaults (20, 1 and 1000).
+func WithLimits(initial, min, max int) AdaptiveLimiterOption {
+	return func(l *adaptiveLimiter) {
+		if initial > 0 {
+			l.limit = float64(initial)
+		}
+		if min > 0 {
+			l.minLimit = float64(min)
+		}
+		if max > 0 {
+			l.maxLimit = float64(max)
+		}
+	}
+}
+
+// WithLimiterErrorHandler overrides the HTTP error handler invoked when a
+// request is rejected because the concurrency limit is reached.
+func WithLimiterErrorHandler(e ErrorHandler) AdaptiveLimiterOption {
+	return func(l *adaptiveLimiter) {
+		l.errorHandler = e
+	}
+}
+
+// AdaptiveConcurrencyLimiter is a middleware that limits the number of requests
+// handled concurrently, rejecting the requests over the limit with a 503 status.
+// The limit is adjusted by comparing the latency of each request with the long
+// term average latency: it grows while the latency is stable and shrinks when
+// the latency increases, following the gradient algorithm of
+// https://github.com/Netflix/concurrency-limits.
+func AdaptiveConcurrencyLimiter(h http.Handler, opts ...AdaptiveLimiterOption) http.Handler {
+	l := &adaptiveLimiter{
+		limit:    defaultInitialLimit,
+		minLimit: defaultMinLimit,
+		maxLimit: defaultMaxLimit,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.errorHandler == nil {
+		l.errorHandler = defaultErrorHandler
+	}
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, l.limit))
+	return l.wrap(h)
+}
+
+func (l *adaptiveLimiter) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflight, ok := l.acquire()
+		if !ok {
+			recordRejection(r, RejectionReasonConcurrencyLimit)
+			l.errorHandler(w, r, "too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		start := time.Now()
+		defer func() {
+			l.release(time.Since(start), inflight)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (l *adaptiveLimiter) acquire() (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if float64(l.inflight) >= math.Floor(l.limit) {
+		return 0, false
+	}
+	l.inflight++
+	return l.inflight, true
+}
+
+func (l *adaptiveLimiter) release(rtt time.Duration, inflight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	l.update(rtt, inflight)
+}
+
+// update adjusts the limit with a new latency sample, measured while inflight
+// requests were being handled. Must be called with the lock held.
+func (l *adaptiveLimiter) update(rtt time.Duration, inflight int) {
+	shortRTT := float64(rtt)
+	if shortRTT <= 0 {
+		return
+	}
+
+	// Exponential moving average of the latency, warmed up as a plain average.
+	l.samples++
+	window := math.Min(float64(l.samples), longRTTWindow)
+	l.longRTT = l.longRTT*(window-1)/window + shortRTT/window
+
+	// Let the long term latency converge faster when it drifts far above the
+	// current latency, for example after a period of overload.
+	if l.longRTT/shortRTT > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// Don't grow the limit while the server is not using the current limit.
+	if float64(inflight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, rttTolerance*l.longRTT/shortRTT))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	newLimit = l.limit*(1-limitSmoothing) + newLimit*limitSmoothing
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, newLimit))
+}
+
+// currentLimit returns the current concurrency limit.
+func (l *adaptiveLimiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
@@ -0,0 +1,88 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveLimiterAdapts(t *testing.T) {
+	limiter := &adaptiveLimiter{limit: 10, minLimit: 5, maxLimit: 100}
+
+	// Stable latency with the limit fully used: the limit grows up to the max.
+	for i := 0; i < 200; i++ {
+		limiter.update(10*time.Millisecond, limiter.currentLimit())
+	}
+	assert.Equal(t, 100, limiter.currentLimit())
+
+	// Latency increases: the limit shrinks.
+	for i := 0; i < 50; i++ {
+		limiter.update(100*time.Millisecond, limiter.currentLimit())
+	}
+	assert.Less(t, limiter.currentLimit(), 10)
+
+	// Latency goes back to normal: the limit grows again.
+	for i := 0; i < 200; i++ {
+		limiter.update(10*time.Millisecond, limiter.currentLimit())
+	}
+	assert.Equal(t, 100, limiter.currentLimit())
+}
+
+func TestAdaptiveLimiterAppLimited(t *testing.T) {
+	limiter := &adaptiveLimiter{limit: 10, minLimit: 1, maxLimit: 100}
+	// The limit doesn't grow when less than half of it is used.
+	for i := 0; i < 100; i++ {
+		limiter.update(10*time.Millisecond, 2)
+	}
+	assert.Equal(t, 10, limiter.currentLimit())
+}
+
+func TestAdaptiveConcurrencyLimiter(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := AdaptiveConcurrencyLimiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(200)
+	}), WithLimits(1, 1, 1))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	}()
+	<-started
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	close(release)
+	wg.Wait()
+}
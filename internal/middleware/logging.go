@@ -0,0 +1,170 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type requestLogger struct {
+	logger             *zap.Logger
+	level              zapcore.Level
+	samplingInitial    int
+	samplingThereafter int
+	jsonOutput         zapcore.WriteSyncer
+}
+
+type RequestLoggerOption func(l *requestLogger)
+
+// WithLogLevel sets the level of the request logs. (default debug)
+func WithLogLevel(level zapcore.Level) RequestLoggerOption {
+	return func(l *requestLogger) {
+		l.level = level
+	}
+}
+
+// WithLogSampling limits the number of request logs: during each second the
+// first initial requests are logged and then one every thereafter requests.
+// A non positive initial disables the sampling.
+func WithLogSampling(initial, thereafter int) RequestLoggerOption {
+	return func(l *requestLogger) {
+		l.samplingInitial = initial
+		l.samplingThereafter = thereafter
+	}
+}
+
+// WithJSONFormat writes the request logs as JSON lines to out, with the zap
+// JSON encoder and the stable field names method, path, status, duration_ms,
+// bytes_in, bytes_out and remote_ip, for the log pipelines ingesting structured
+// logs, instead of logging with the logger of RequestLogger. All the requests
+// are written, with the level of WithLogLevel. Disabled if nil.
+func WithJSONFormat(out zapcore.WriteSyncer) RequestLoggerOption {
+	return func(l *requestLogger) {
+		l.jsonOutput = out
+	}
+}
+
+// RequestLogger is a middleware that logs the method, path, status, the number
+// of bytes received and sent, the duration and the remote address of each request.
+// When the request body is decompressed by HTTPContentDecompressor further in the
+// chain the number of decompressed bytes is logged as well.
+func RequestLogger(h http.Handler, logger *zap.Logger, opts ...RequestLoggerOption) http.Handler {
+	l := &requestLogger{
+		logger: logger,
+		level:  zapcore.DebugLevel,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.jsonOutput != nil {
+		l.logger = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), l.jsonOutput, l.level))
+	}
+	if l.samplingInitial > 0 {
+		l.logger = l.logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewSampler(core, time.Second, l.samplingInitial, l.samplingThereafter)
+		}))
+	}
+	return l.wrap(h)
+}
+
+func (l *requestLogger) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := &requestStats{}
+		r = r.WithContext(context.WithValue(r.Context(), requestStatsKey{}, stats))
+		if r.Body != nil {
+			r.Body = &countingReadCloser{ReadCloser: r.Body, n: &stats.receivedBytes}
+		}
+		rw := NewStatusRecorder(w)
+
+		start := time.Now()
+		h.ServeHTTP(rw, r)
+		duration := time.Since(start)
+
+		ce := l.logger.Check(l.level, "HTTP request")
+		if ce == nil {
+			return
+		}
+		if l.jsonOutput != nil {
+			ce.Write(jsonLogFields(r, rw, stats, duration)...)
+			return
+		}
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", rw.Status()),
+			zap.Int64("received_bytes", stats.receivedBytes),
+		}
+		if stats.decompressed {
+			fields = append(fields, zap.Int64("decompressed_bytes", stats.decompressedBytes))
+		}
+		fields = append(fields,
+			zap.Int64("sent_bytes", rw.BytesWritten()),
+			zap.Duration("duration", duration),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		ce.Write(fields...)
+	})
+}
+
+// jsonLogFields returns the fields of the JSON request logs, whose names are
+// stable for the log pipelines.
+func jsonLogFields(r *http.Request, rw *StatusRecorder, stats *requestStats, duration time.Duration) []zap.Field {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	return []zap.Field{
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", rw.Status()),
+		zap.Float64("duration_ms", float64(duration)/float64(time.Millisecond)),
+		zap.Int64("bytes_in", stats.receivedBytes),
+		zap.Int64("bytes_out", rw.BytesWritten()),
+		zap.String("remote_ip", remoteIP),
+	}
+}
+
+// requestStats is put in the request context by RequestLogger to collect the
+// statistics of the request computed by the other middlewares.
+type requestStats struct {
+	receivedBytes     int64
+	decompressed      bool
+	decompressedBytes int64
+}
+
+type requestStatsKey struct{}
+
+func requestStatsFromContext(ctx context.Context) (*requestStats, bool) {
+	stats, ok := ctx.Value(requestStatsKey{}).(*requestStats)
+	return stats, ok
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,143 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestLogger(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusAccepted)
+		_, err = w.Write([]byte("done"))
+		require.NoError(t, err)
+	})
+	testBody := []byte(strings.Repeat("uncompressed_text", 10))
+	compressed, err := compressGzip(testBody)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		req    func() *http.Request
+		fields map[string]interface{}
+	}{
+		{
+			name: "uncompressed",
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/v1/traces", bytes.NewReader(testBody))
+			},
+			fields: map[string]interface{}{
+				"method":         "POST",
+				"path":           "/v1/traces",
+				"status":         int64(http.StatusAccepted),
+				"received_bytes": int64(len(testBody)),
+				"sent_bytes":     int64(4),
+				"remote_addr":    "192.0.2.1:1234",
+			},
+		},
+		{
+			name: "compressed",
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader(compressed.Bytes()))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+			fields: map[string]interface{}{
+				"method":             "POST",
+				"path":               "/v1/traces",
+				"status":             int64(http.StatusAccepted),
+				"received_bytes":     int64(compressed.Len()),
+				"decompressed_bytes": int64(len(testBody)),
+				"sent_bytes":         int64(4),
+				"remote_addr":        "192.0.2.1:1234",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			h := RequestLogger(HTTPContentDecompressor(handler), zap.New(core))
+			h.ServeHTTP(httptest.NewRecorder(), tt.req())
+
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			assert.Equal(t, zapcore.DebugLevel, entry.Level)
+			fields := entry.ContextMap()
+			assert.Contains(t, fields, "duration")
+			delete(fields, "duration")
+			assert.Equal(t, tt.fields, fields)
+		})
+	}
+}
+
+func TestRequestLoggerLevel(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	RequestLogger(ok, zap.New(core)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, 0, logs.Len())
+
+	RequestLogger(ok, zap.New(core), WithLogLevel(zapcore.InfoLevel)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, int64(http.StatusOK), logs.All()[0].ContextMap()["status"])
+}
+
+func TestRequestLoggerSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RequestLogger(ok, zap.New(core), WithLogSampling(2, 5))
+	for i := 0; i < 12; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	// The first 2 requests and then one every 5: the 7th and the 12th.
+	assert.Equal(t, 4, logs.Len())
+}
+
+func TestRequestLoggerJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	h := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("done"))
+		require.NoError(t, err)
+	}), zap.NewNop(), WithLogLevel(zapcore.InfoLevel), WithJSONFormat(zapcore.AddSync(&buf)))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/traces", strings.NewReader("payload")))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "HTTP request", line["msg"])
+	assert.Equal(t, "POST", line["method"])
+	assert.Equal(t, "/v1/traces", line["path"])
+	assert.EqualValues(t, http.StatusOK, line["status"])
+	assert.EqualValues(t, len("payload"), line["bytes_in"])
+	assert.EqualValues(t, len("done"), line["bytes_out"])
+	assert.Equal(t, "192.0.2.1", line["remote_ip"])
+	assert.Contains(t, line, "duration_ms")
+}
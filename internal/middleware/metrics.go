@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Reasons used to tag the requests rejected by the middlewares.
+const (
+	RejectionReasonCompressionRequired  = "compression_required"
+	RejectionReasonConcurrencyLimit     = "concurrency_limit"
+	RejectionReasonDecompressionFailure = "decompression_failure"
+	RejectionReasonDecompressionLimit   = "decompression_limit"
+	RejectionReasonDigestMismatch       = "digest_mismatch"
+	RejectionReasonHandlerTimeout       = "handler_timeout"
+	RejectionReasonHeaderLimit          = "header_limit"
+	RejectionReasonIdempotencyKeyReuse  = "idempotency_key_reuse"
+	RejectionReasonInflightLimit        = "inflight_limit"
+	RejectionReasonNotFound             = "not_found"
+	RejectionReasonUnsupportedEncoding  = "unsupported_encoding"
+	RejectionReasonUnsupportedMediaType = "unsupported_media_type"
+)
+
+var (
+	tagReason, _ = tag.NewKey("reason")
+
+	statRejectedRequests = stats.Int64(
+		"http.server.rejected_requests",
+		"Number of HTTP requests rejected by the server middlewares",
+		stats.UnitDimensionless)
+
+	statResponseSize = stats.Int64(
+		"http.server.response_size",
+		"Size of the HTTP response bodies written by the server handlers",
+		stats.UnitBytes)
+)
+
+// MetricViews returns the metric views of the HTTP server middlewares.
+func MetricViews() []*view.View {
+	rejectedRequests := &view.View{
+		Name:        statRejectedRequests.Name(),
+		Measure:     statRejectedRequests,
+		Description: statRejectedRequests.Description(),
+		TagKeys:     []tag.Key{tagReason},
+		Aggregation: view.Sum(),
+	}
+	responseSize := &view.View{
+		Name:        statResponseSize.Name(),
+		Measure:     statResponseSize,
+		Description: statResponseSize.Description(),
+		Aggregation: view.Distribution(0, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304),
+	}
+	return []*view.View{rejectedRequests, responseSize}
+}
+
+// recordRejection counts a request rejected by a middleware for the given reason.
+func recordRejection(r *http.Request, reason string) {
+	_ = stats.RecordWithTags(r.Context(), []tag.Mutator{tag.Upsert(tagReason, reason)}, statRejectedRequests.M(1))
+}
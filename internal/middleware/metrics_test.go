@@ -0,0 +1,177 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+// rejectedRequests returns the number of rejected requests recorded per reason.
+func rejectedRequests(t *testing.T) map[string]int64 {
+	rows, err := view.RetrieveData(statRejectedRequests.Name())
+	require.NoError(t, err)
+	got := map[string]int64{}
+	for _, row := range rows {
+		require.Len(t, row.Tags, 1)
+		got[row.Tags[0].Value] = int64(row.Data.(*view.SumData).Value)
+	}
+	return got
+}
+
+func TestRejectedRequestsMetric(t *testing.T) {
+	views := MetricViews()
+	require.NoError(t, view.Register(views...))
+	defer view.Unregister(views...)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	idempotency := Idempotency(ok, "Idempotency-Key", time.Minute, 1)
+	tests := []struct {
+		name    string
+		handler http.Handler
+		req     func() *http.Request
+		reason  string
+	}{
+		{
+			name:    "decompression_failure",
+			handler: HTTPContentDecompressor(ok),
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/", strings.NewReader("not gzip"))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+			reason: RejectionReasonDecompressionFailure,
+		},
+		{
+			name:    "decompression_limit",
+			handler: (&decompressor{slots: make(chan struct{}), errorHandler: defaultErrorHandler}).wrap(ok),
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/", strings.NewReader("gzip"))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+			reason: RejectionReasonDecompressionLimit,
+		},
+		{
+			name:    "digest_mismatch",
+			handler: DigestValidator(ok),
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/", nil)
+				req.Header.Set("Content-MD5", "not base64")
+				return req
+			},
+			reason: RejectionReasonDigestMismatch,
+		},
+		{
+			name:    "concurrency_limit",
+			handler: (&adaptiveLimiter{limit: 0, errorHandler: defaultErrorHandler}).wrap(ok),
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/", nil)
+			},
+			reason: RejectionReasonConcurrencyLimit,
+		},
+		{
+			name:    "compression_required",
+			handler: RequireCompression(ok, 1),
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/", strings.NewReader("uncompressed"))
+			},
+			reason: RejectionReasonCompressionRequired,
+		},
+		{
+			name: "handler_timeout",
+			handler: HandlerTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			}), time.Millisecond),
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/", nil)
+			},
+			reason: RejectionReasonHandlerTimeout,
+		},
+		{
+			name:    "header_limit",
+			handler: HeaderLimiter(ok, 1, 0, 0),
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/", nil)
+				req.Header.Add("X-Header", "a")
+				req.Header.Add("X-Header", "b")
+				return req
+			},
+			reason: RejectionReasonHeaderLimit,
+		},
+		{
+			name:    "idempotency_key_reuse",
+			handler: idempotency,
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/", strings.NewReader("first"))
+				req.Header.Set("Idempotency-Key", "a")
+				idempotency.ServeHTTP(httptest.NewRecorder(), req)
+				req = httptest.NewRequest("POST", "/", strings.NewReader("second"))
+				req.Header.Set("Idempotency-Key", "a")
+				return req
+			},
+			reason: RejectionReasonIdempotencyKeyReuse,
+		},
+		{
+			name:    "inflight_limit",
+			handler: InflightLimiter(ok, 0),
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/", nil)
+			},
+			reason: RejectionReasonInflightLimit,
+		},
+		{
+			name:    "not_found",
+			handler: PathFilter(ok, []string{"/v1/trace"}),
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/", nil)
+			},
+			reason: RejectionReasonNotFound,
+		},
+		{
+			name:    "unsupported_encoding",
+			handler: HTTPContentDecompressor(ok, WithEncodings(nil, []string{"gzip"})),
+			req: func() *http.Request {
+				req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+			reason: RejectionReasonUnsupportedEncoding,
+		},
+		{
+			name:    "unsupported_media_type",
+			handler: ContentTypeFilter(ok, []string{"application/json"}),
+			req: func() *http.Request {
+				return httptest.NewRequest("POST", "/", nil)
+			},
+			reason: RejectionReasonUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := rejectedRequests(t)[tt.reason]
+			tt.handler.ServeHTTP(httptest.NewRecorder(), tt.req())
+			got := rejectedRequests(t)
+			assert.Equal(t, before+1, got[tt.reason])
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+)
+
+type pathFilter struct {
+	paths        map[string]struct{}
+	errorHandler ErrorHandler
+}
+
+type PathFilterOption func(f *pathFilter)
+
+// WithPathFilterErrorHandler overrides the HTTP error handler invoked when a
+// request is rejected because of its path.
+func WithPathFilterErrorHandler(e ErrorHandler) PathFilterOption {
+	return func(f *pathFilter) {
+		f.errorHandler = e
+	}
+}
+
+// PathFilter is a middleware that rejects the requests for a URL path other
+// than the given paths with a 404 status, so that the error handler encodes the
+// error of the unmatched routes like the other errors.
+func PathFilter(h http.Handler, paths []string, opts ...PathFilterOption) http.Handler {
+	f := &pathFilter{paths: make(map[string]struct{}, len(paths))}
+	for _, p := range paths {
+		f.paths[p] = struct{}{}
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	if f.errorHandler == nil {
+		f.errorHandler = defaultErrorHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.paths[r.URL.Path]; !ok {
+			recordRejection(r, RejectionReasonNotFound)
+			f.errorHandler(w, r, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
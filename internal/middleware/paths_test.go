@@ -0,0 +1,49 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathFilter(t *testing.T) {
+	h := PathFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), []string{"/v1/trace", "/v1/metrics"}, WithPathFilterErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		http.Error(w, "custom: "+errorMsg, statusCode)
+	}))
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/v1/trace", wantStatus: http.StatusOK, wantBody: "ok"},
+		{path: "/v1/metrics", wantStatus: http.StatusOK, wantBody: "ok"},
+		{path: "/v1/trace/", wantStatus: http.StatusNotFound, wantBody: "custom: Not Found\n"},
+		{path: "/", wantStatus: http.StatusNotFound, wantBody: "custom: Not Found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
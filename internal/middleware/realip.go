@@ -0,0 +1,106 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RealIP is a middleware that sets the RemoteAddr of the requests received from
+// the trusted proxies to the address of the client, taken from the "Forwarded"
+// header, see RFC 7239, or else from the "X-Forwarded-For" header. The
+// addresses of the header are read from the last one, the closest proxy, and
+// the first address not in trusted is the client, so that the addresses added
+// by the client itself are ignored. The headers of the requests from the other
+// peers are not trusted and their RemoteAddr is kept. The port of RemoteAddr
+// is the one of the forwarded address, or 0 if it has none.
+func RealIP(h http.Handler, trusted []*net.IPNet) http.Handler {
+	isTrusted := func(ip net.IP) bool {
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(peer); err == nil {
+			peer = host
+		}
+		if ip := net.ParseIP(peer); ip == nil || !isTrusted(ip) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		addrs := forwardedFor(r.Header)
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip, port, ok := parseForwardedAddr(addrs[i])
+			if !ok {
+				// An obfuscated or invalid address hides the client.
+				break
+			}
+			if i > 0 && isTrusted(ip) {
+				continue
+			}
+			r.RemoteAddr = net.JoinHostPort(ip.String(), port)
+			break
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the addresses of the "for" parameters of the "Forwarded"
+// header, or of the "X-Forwarded-For" header when there is no "Forwarded"
+// header, ordered from the client to the closest proxy.
+func forwardedFor(header http.Header) []string {
+	var addrs []string
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+						addrs = append(addrs, strings.Trim(pair[4:], `"`))
+					}
+				}
+			}
+		}
+		return addrs
+	}
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			addrs = append(addrs, strings.TrimSpace(addr))
+		}
+	}
+	return addrs
+}
+
+// parseForwardedAddr parses an address of the forwarded headers, an IP with an
+// optional port, with the IPv6 addresses in brackets when there is a port.
+func parseForwardedAddr(addr string) (net.IP, string, bool) {
+	host, port := addr, "0"
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host = h
+		// The obfuscated ports of the "Forwarded" header are ignored.
+		if _, err = strconv.ParseUint(p, 10, 16); err == nil {
+			port = p
+		}
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip, port, ip != nil
+}
@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	_, proxiesV6, err := net.ParseCIDR("fd00::/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{
+			name:       "untrusted_peer",
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "192.0.2.1:1234",
+		},
+		{
+			name:       "no_header",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{},
+			want:       "10.0.0.1:1234",
+		},
+		{
+			name:       "x_forwarded_for",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "198.51.100.1:0",
+		},
+		{
+			name:       "spoofed_x_forwarded_for",
+			remoteAddr: "10.0.0.1:1234",
+			// The client added the first address, the trusted proxies the others.
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1, 198.51.100.1", "10.0.0.2"}},
+			want:   "198.51.100.1:0",
+		},
+		{
+			name:       "all_trusted",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:       "10.0.0.3:0",
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "[fd00::1]:1234",
+			header: http.Header{
+				"Forwarded":       {`for="[2001:db8::1]:4711";proto=https, For=10.0.0.2`},
+				"X-Forwarded-For": {"203.0.113.1"},
+			},
+			want: "[2001:db8::1]:4711",
+		},
+		{
+			name:       "forwarded_obfuscated",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for=198.51.100.1, for=_hidden`}},
+			want:       "10.0.0.1:1234",
+		},
+		{
+			name:       "forwarded_obfuscated_port",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for="198.51.100.1:_port"`}},
+			want:       "198.51.100.1:0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}), []*net.IPNet{proxies, proxiesV6})
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header = tt.header
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
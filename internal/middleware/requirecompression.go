@@ -0,0 +1,58 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type compressionRequirement struct {
+	errorHandler ErrorHandler
+}
+
+type RequireCompressionOption func(c *compressionRequirement)
+
+// WithRequireCompressionErrorHandler overrides the HTTP error handler invoked
+// when a request is rejected because its body is not compressed.
+func WithRequireCompressionErrorHandler(e ErrorHandler) RequireCompressionOption {
+	return func(c *compressionRequirement) {
+		c.errorHandler = e
+	}
+}
+
+// RequireCompression is a middleware that rejects the requests without
+// "Content-Encoding" header, or with only "identity" encodings, and with a
+// "Content-Length" over maxSize with a 412 status, to get the clients to enable
+// the compression. The requests of unknown length, e.g. chunked, are accepted.
+func RequireCompression(h http.Handler, maxSize int64, opts ...RequireCompressionOption) http.Handler {
+	c := &compressionRequirement{}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.errorHandler == nil {
+		c.errorHandler = defaultErrorHandler
+	}
+	msg := fmt.Sprintf("uncompressed request bodies larger than %d bytes are not accepted, the body must be compressed, e.g. with gzip", maxSize)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uncompressed := len(parseContentEncodings(r.Header.Get("Content-Encoding"))) == 0
+		if uncompressed && r.ContentLength > maxSize {
+			recordRejection(r, RejectionReasonCompressionRequired)
+			c.errorHandler(w, r, msg, http.StatusPreconditionFailed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
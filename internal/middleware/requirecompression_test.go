@@ -0,0 +1,88 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireCompression(t *testing.T) {
+	h := RequireCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), 10)
+	tests := []struct {
+		name       string
+		body       string
+		encoding   string
+		chunked    bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "small_uncompressed", body: "0123456789", wantStatus: http.StatusOK, wantBody: "ok"},
+		{
+			name:       "large_uncompressed",
+			body:       "0123456789a",
+			wantStatus: http.StatusPreconditionFailed,
+			wantBody:   "uncompressed request bodies larger than 10 bytes are not accepted, the body must be compressed, e.g. with gzip\n",
+		},
+		{
+			name:       "large_identity",
+			body:       "0123456789a",
+			encoding:   "identity",
+			wantStatus: http.StatusPreconditionFailed,
+			wantBody:   "uncompressed request bodies larger than 10 bytes are not accepted, the body must be compressed, e.g. with gzip\n",
+		},
+		{
+			name:       "large_identity_uppercase",
+			body:       "0123456789a",
+			encoding:   "Identity",
+			wantStatus: http.StatusPreconditionFailed,
+			wantBody:   "uncompressed request bodies larger than 10 bytes are not accepted, the body must be compressed, e.g. with gzip\n",
+		},
+		{
+			name:       "large_identity_repeated",
+			body:       "0123456789a",
+			encoding:   "identity, identity",
+			wantStatus: http.StatusPreconditionFailed,
+			wantBody:   "uncompressed request bodies larger than 10 bytes are not accepted, the body must be compressed, e.g. with gzip\n",
+		},
+		{name: "large_compressed", body: "0123456789a", encoding: "gzip", wantStatus: http.StatusOK, wantBody: "ok"},
+		{name: "unknown_length", body: "0123456789a", chunked: true, wantStatus: http.StatusOK, wantBody: "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.chunked {
+				req = httptest.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader(tt.body)))
+				req.ContentLength = -1
+			} else {
+				req = httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			}
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opencensus.io/stats"
+	"go.uber.org/zap"
+)
+
+// ResponseSizeLimiter is a middleware that records the size of the response
+// bodies written by the next handler(s), see MetricViews. If maxBytes is
+// positive the bodies are truncated to maxBytes and an error is logged with the
+// given logger, the writes beyond the limit are discarded without error so that
+// the handler completes.
+func ResponseSizeLimiter(h http.Handler, maxBytes int64, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseSizeWriter{StatusRecorder: NewStatusRecorder(w), maxBytes: maxBytes}
+		h.ServeHTTP(rw, r)
+
+		stats.Record(r.Context(), statResponseSize.M(rw.size))
+		if rw.truncated {
+			logger.Error("HTTP response body truncated",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int64("size", rw.size),
+				zap.Int64("max_response_size", maxBytes),
+			)
+		}
+	})
+}
+
+type responseSizeWriter struct {
+	*StatusRecorder
+	maxBytes  int64
+	size      int64
+	truncated bool
+}
+
+func (w *responseSizeWriter) WriteHeader(statusCode int) {
+	if !w.WroteHeader() {
+		// A Content-Length over the limit would make the client wait for the
+		// bytes that are never sent.
+		if w.maxBytes > 0 {
+			if cl, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil && cl > w.maxBytes {
+				w.Header().Del("Content-Length")
+			}
+		}
+	}
+	w.StatusRecorder.WriteHeader(statusCode)
+}
+
+// Write counts all the bytes written by the handler, including the discarded ones.
+func (w *responseSizeWriter) Write(b []byte) (int, error) {
+	if !w.WroteHeader() {
+		w.WriteHeader(http.StatusOK)
+	}
+	sent := b
+	if w.maxBytes > 0 {
+		if remaining := w.maxBytes - w.size; int64(len(b)) > remaining {
+			if remaining < 0 {
+				remaining = 0
+			}
+			sent = b[:remaining]
+			w.truncated = true
+		}
+	}
+	w.size += int64(len(b))
+	if len(sent) == 0 {
+		return len(b), nil
+	}
+	n, err := w.StatusRecorder.Write(sent)
+	if err != nil {
+		return n, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,126 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestResponseSizeLimiter(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxBytes      int64
+		writes        []string
+		contentLength string
+		wantBody      string
+		wantTruncated bool
+	}{
+		{
+			name:     "unlimited",
+			writes:   []string{"hello ", "world"},
+			wantBody: "hello world",
+		},
+		{
+			name:     "under_limit",
+			maxBytes: 11,
+			writes:   []string{"hello ", "world"},
+			wantBody: "hello world",
+		},
+		{
+			name:          "truncated",
+			maxBytes:      8,
+			writes:        []string{"hello ", "world", "!"},
+			wantBody:      "hello wo",
+			wantTruncated: true,
+		},
+		{
+			name:          "content_length_over_limit",
+			maxBytes:      5,
+			writes:        []string{"hello world"},
+			contentLength: "11",
+			wantBody:      "hello",
+			wantTruncated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written []int
+			var size int64
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentLength != "" {
+					w.Header().Set("Content-Length", tt.contentLength)
+				}
+				for _, s := range tt.writes {
+					n, err := w.Write([]byte(s))
+					require.NoError(t, err)
+					written = append(written, n)
+					size += int64(len(s))
+				}
+			})
+			core, logs := observer.New(zapcore.InfoLevel)
+			rec := httptest.NewRecorder()
+			ResponseSizeLimiter(handler, tt.maxBytes, zap.New(core)).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+			// The handler is not told about the truncation.
+			for i, s := range tt.writes {
+				assert.Equal(t, len(s), written[i])
+			}
+			if tt.contentLength != "" {
+				assert.Empty(t, rec.Header().Get("Content-Length"))
+			}
+			if !tt.wantTruncated {
+				assert.Zero(t, logs.Len())
+				return
+			}
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			assert.Equal(t, zapcore.ErrorLevel, entry.Level)
+			fields := entry.ContextMap()
+			assert.Equal(t, "/metrics", fields["path"])
+			assert.Equal(t, tt.maxBytes, fields["max_response_size"])
+			assert.Equal(t, size, fields["size"])
+		})
+	}
+}
+
+func TestResponseSizeMetric(t *testing.T) {
+	views := MetricViews()
+	require.NoError(t, view.Register(views...))
+	defer view.Unregister(views...)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write(make([]byte, 2000))
+		require.NoError(t, err)
+	})
+	ResponseSizeLimiter(handler, 1000, zap.NewNop()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	rows, err := view.RetrieveData(statResponseSize.Name())
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	data := rows[0].Data.(*view.DistributionData)
+	assert.Equal(t, int64(1), data.Count)
+	// The size written by the handler is recorded, not the truncated one.
+	assert.Equal(t, float64(2000), data.Sum())
+}
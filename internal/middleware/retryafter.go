@@ -0,0 +1,54 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryAfter is a middleware that sets the "Retry-After" header of the 429 and
+// 503 responses to the given delay, so that the clients back off before retrying.
+// The header is left untouched if it is already set by the next handler(s).
+func RetryAfter(h http.Handler, delay time.Duration) http.Handler {
+	value := retryAfterValue(delay)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&retryAfterWriter{StatusRecorder: NewStatusRecorder(w), value: value}, r)
+	})
+}
+
+// retryAfterValue returns the "Retry-After" header value for the delay, in
+// seconds rounded up and at least 1.
+func retryAfterValue(delay time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(delay.Seconds()))))
+}
+
+type retryAfterWriter struct {
+	*StatusRecorder
+	value string
+}
+
+func (w *retryAfterWriter) WriteHeader(statusCode int) {
+	if !w.WroteHeader() {
+		if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+			if w.Header().Get("Retry-After") == "" {
+				w.Header().Set("Retry-After", w.value)
+			}
+		}
+	}
+	w.StatusRecorder.WriteHeader(statusCode)
+}
@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		header     string
+		want       string
+	}{
+		{
+			name:       "ok",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "too_many_requests",
+			statusCode: http.StatusTooManyRequests,
+			want:       "3",
+		},
+		{
+			name:       "unavailable",
+			statusCode: http.StatusServiceUnavailable,
+			want:       "3",
+		},
+		{
+			name:       "already_set",
+			statusCode: http.StatusServiceUnavailable,
+			header:     "10",
+			want:       "10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RetryAfter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.statusCode)
+			}), 2500*time.Millisecond)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+			assert.Equal(t, tt.statusCode, rec.Code)
+			assert.Equal(t, tt.want, rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestRetryAfterValue(t *testing.T) {
+	assert.Equal(t, "1", retryAfterValue(0))
+	assert.Equal(t, "1", retryAfterValue(time.Millisecond))
+	assert.Equal(t, "1", retryAfterValue(time.Second))
+	assert.Equal(t, "2", retryAfterValue(1001*time.Millisecond))
+	assert.Equal(t, "60", retryAfterValue(time.Minute))
+}
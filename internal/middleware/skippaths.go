@@ -0,0 +1,51 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SkipPaths returns a handler passing the requests whose URL path is under one
+// of the path prefixes directly to next, and the other requests to h, the
+// middleware wrapping next, so that the middleware is only invoked for the
+// matching paths. A prefix matches the path itself and the paths under it,
+// e.g. "/healthz" matches "/healthz" and "/healthz/ready" but not "/healthzs".
+func SkipPaths(h, next http.Handler, prefixes []string) http.Handler {
+	if len(prefixes) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasPathPrefix(r.URL.Path, prefixes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// hasPathPrefix returns whether path is one of the prefixes or under one of them.
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix {
+			return true
+		}
+		if strings.HasPrefix(path, prefix) && (strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipPaths(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	wrapped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := SkipPaths(wrapped, next, []string{"/healthz", "/metrics/"})
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/healthz", wantCode: http.StatusAccepted},
+		{path: "/healthz/ready", wantCode: http.StatusAccepted},
+		{path: "/healthzs", wantCode: http.StatusTeapot},
+		{path: "/metrics/", wantCode: http.StatusAccepted},
+		{path: "/metrics/prometheus", wantCode: http.StatusAccepted},
+		{path: "/metrics", wantCode: http.StatusTeapot},
+		{path: "/v1/traces", wantCode: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, nil))
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+
+	// Without prefixes the middleware handles all the requests.
+	rec := httptest.NewRecorder()
+	SkipPaths(wrapped, next, nil).ServeHTTP(rec, httptest.NewRequest("POST", "/healthz", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
@@ -0,0 +1,119 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder is an http.ResponseWriter recording the status code and the
+// number of bytes of the response written through it, for the middlewares
+// that report them once the handler returns. It forwards the http.Flusher,
+// http.Hijacker and http.Pusher interfaces of the wrapped ResponseWriter, so
+// that the streaming and upgraded responses keep working, and reports
+// http.ErrNotSupported when the wrapped ResponseWriter does not implement them.
+type StatusRecorder struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int64
+	wroteHeader  bool
+	hijacked     bool
+}
+
+var (
+	_ http.Flusher  = (*StatusRecorder)(nil)
+	_ http.Hijacker = (*StatusRecorder)(nil)
+	_ http.Pusher   = (*StatusRecorder)(nil)
+)
+
+// NewStatusRecorder returns a StatusRecorder writing to w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+// Status returns the status code of the response: the code of the first
+// WriteHeader call other than an informational 1xx one, 200 if the handler
+// only called Write or nothing at all, or 101 if the connection was hijacked.
+func (w *StatusRecorder) Status() int {
+	switch {
+	case w.wroteHeader:
+		return w.status
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	default:
+		return http.StatusOK
+	}
+}
+
+// BytesWritten returns the number of bytes of the response body written to
+// the wrapped ResponseWriter.
+func (w *StatusRecorder) BytesWritten() int64 {
+	return w.bytesWritten
+}
+
+// WroteHeader reports whether the status code of the response was written,
+// explicitly or by the first Write call.
+func (w *StatusRecorder) WroteHeader() bool {
+	return w.wroteHeader
+}
+
+func (w *StatusRecorder) WriteHeader(statusCode int) {
+	if !w.wroteHeader && (statusCode < 100 || statusCode >= 200 || statusCode == http.StatusSwitchingProtocols) {
+		w.status = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *StatusRecorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, used by the grpc-gateway for streaming responses.
+func (w *StatusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, used by the handlers taking over the
+// connection, e.g. for the websockets.
+func (w *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Push implements http.Pusher, used to push resources with HTTP/2.
+func (w *StatusRecorder) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
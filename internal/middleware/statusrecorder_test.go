@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    func(w http.ResponseWriter)
+		wantStatus int
+		wantBytes  int64
+	}{
+		{
+			name:       "nothing_written",
+			handler:    func(w http.ResponseWriter) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "implicit_status",
+			handler: func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte("hello"))
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  5,
+		},
+		{
+			name: "first_status",
+			handler: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusAccepted)
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte("hello"))
+			},
+			wantStatus: http.StatusAccepted,
+			wantBytes:  5,
+		},
+		{
+			name: "informational_status",
+			handler: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusNoContent)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := NewStatusRecorder(httptest.NewRecorder())
+			tt.handler(rw)
+			assert.Equal(t, tt.wantStatus, rw.Status())
+			assert.Equal(t, tt.wantBytes, rw.BytesWritten())
+		})
+	}
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewStatusRecorder(rec).Flush()
+	assert.True(t, rec.Flushed)
+}
+
+func TestStatusRecorderNotSupported(t *testing.T) {
+	rw := NewStatusRecorder(httptest.NewRecorder())
+	_, _, err := rw.Hijack()
+	assert.Equal(t, http.ErrNotSupported, err)
+	assert.Equal(t, http.ErrNotSupported, rw.Push("/style.css", nil))
+	assert.Equal(t, http.StatusOK, rw.Status())
+}
+
+func TestStatusRecorderHijack(t *testing.T) {
+	status := make(chan int, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := NewStatusRecorder(w)
+		conn, buf, err := rw.Hijack()
+		require.NoError(t, err)
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		_ = buf.Flush()
+		_ = conn.Close()
+		status <- rw.Status()
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, http.StatusSwitchingProtocols, <-status)
+}
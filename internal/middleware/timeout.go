@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type timeoutHandler struct {
+	handler      http.Handler
+	timeout      time.Duration
+	errorHandler ErrorHandler
+}
+
+type TimeoutOption func(t *timeoutHandler)
+
+// WithTimeoutErrorHandler overrides the HTTP error handler invoked when the
+// handler doesn't complete before the timeout.
+func WithTimeoutErrorHandler(e ErrorHandler) TimeoutOption {
+	return func(t *timeoutHandler) {
+		t.errorHandler = e
+	}
+}
+
+// HandlerTimeout is a middleware that runs h with the given time limit, like
+// http.TimeoutHandler. The response of h is buffered and discarded if h doesn't
+// complete in time, the error handler is invoked instead with a 504 status.
+// Writes of h to its http.ResponseWriter after the timeout fail with
+// http.ErrHandlerTimeout.
+func HandlerTimeout(h http.Handler, timeout time.Duration, opts ...TimeoutOption) http.Handler {
+	t := &timeoutHandler{
+		handler: h,
+		timeout: timeout,
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.errorHandler == nil {
+		t.errorHandler = defaultErrorHandler
+	}
+	return t
+}
+
+func (t *timeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), t.timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	tw := &timeoutWriter{ctx: ctx, header: make(http.Header)}
+	done := make(chan struct{})
+	panicChan := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		t.handler.ServeHTTP(tw, r)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicChan:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// The handler may see the timeout and return before it is selected.
+		if tw.timedOut {
+			recordRejection(r, RejectionReasonHandlerTimeout)
+			t.errorHandler(w, r, "request timed out", http.StatusGatewayTimeout)
+			return
+		}
+		dst := w.Header()
+		for k, vv := range tw.header {
+			dst[k] = vv
+		}
+		if !tw.wroteHeader {
+			tw.code = http.StatusOK
+		}
+		w.WriteHeader(tw.code)
+		_, _ = w.Write(tw.buf.Bytes())
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		if ctx.Err() == context.DeadlineExceeded {
+			recordRejection(r, RejectionReasonHandlerTimeout)
+			t.errorHandler(w, r, "request timed out", http.StatusGatewayTimeout)
+		}
+	}
+}
+
+// timeoutWriter buffers the response of the handler run by timeoutHandler.
+type timeoutWriter struct {
+	ctx         context.Context
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+// expiredLocked reports whether the timeout expired, also before timeoutHandler
+// handles it.
+func (tw *timeoutWriter) expiredLocked() bool {
+	if !tw.timedOut && tw.ctx.Err() == context.DeadlineExceeded {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
@@ -0,0 +1,56 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerTimeout(t *testing.T) {
+	h := HandlerTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "value")
+		w.WriteHeader(http.StatusAccepted)
+		_, err := w.Write([]byte("done"))
+		assert.NoError(t, err)
+	}), time.Minute)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "value", rec.Header().Get("X-Test"))
+	assert.Equal(t, "done", rec.Body.String())
+}
+
+func TestHandlerTimeoutExpired(t *testing.T) {
+	writeErr := make(chan error, 1)
+	h := HandlerTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+	}), time.Millisecond, WithTimeoutErrorHandler(func(w http.ResponseWriter, r *http.Request, errorMsg string, statusCode int) {
+		http.Error(w, "custom: "+errorMsg, statusCode)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, "custom: request timed out\n", rec.Body.String())
+	assert.Equal(t, http.ErrHandlerTimeout, <-writeErr)
+}
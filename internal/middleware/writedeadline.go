@@ -0,0 +1,98 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type connKey struct{}
+
+// ContextWithConn returns a context holding the connection of the requests,
+// to be set as http.Server.ConnContext for SlidingWriteDeadline.
+func ContextWithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// ClearWriteDeadline removes the write deadline set by SlidingWriteDeadline
+// once the connection is idle, to be called from http.Server.ConnState, so that
+// the responses written outside of the middleware are not affected.
+func ClearWriteDeadline(c net.Conn, state http.ConnState) {
+	if state == http.StateIdle {
+		_ = c.SetWriteDeadline(time.Time{})
+	}
+}
+
+// SlidingWriteDeadline is a middleware that sets the write deadline of the
+// connection to timeout after the beginning of the request, then after each
+// write of the response, so that the clients not reading the responses are
+// disconnected while the slow but progressing responses continue. The
+// connection is taken from the request context, see ContextWithConn, the
+// requests without connection and the HTTP/2 requests, whose connection is
+// shared with the other streams, are not limited.
+func SlidingWriteDeadline(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(connKey{}).(net.Conn)
+		if !ok || r.ProtoMajor >= 2 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		dw := &deadlineWriter{ResponseWriter: w, conn: conn, timeout: timeout}
+		dw.extend()
+		h.ServeHTTP(dw, r)
+		// The end of the response is sent after the handler returns.
+		dw.extend()
+	})
+}
+
+type deadlineWriter struct {
+	http.ResponseWriter
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) extend() {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+}
+
+// deadlineChunkSize is the size of the chunks of the large writes, so that the
+// deadline is extended while a large write is progressing.
+const deadlineChunkSize = 32 * 1024
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	written := 0
+	for {
+		chunk := b[written:]
+		if len(chunk) > deadlineChunkSize {
+			chunk = chunk[:deadlineChunkSize]
+		}
+		w.extend()
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil || written == len(b) {
+			return written, err
+		}
+	}
+}
+
+func (w *deadlineWriter) Flush() {
+	w.extend()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWriteDeadlineServer(h http.Handler, timeout time.Duration) *httptest.Server {
+	srv := httptest.NewUnstartedServer(SlidingWriteDeadline(h, timeout))
+	srv.Config.ConnContext = ContextWithConn
+	srv.Config.ConnState = ClearWriteDeadline
+	srv.Start()
+	return srv
+}
+
+func TestSlidingWriteDeadlineSlowReader(t *testing.T) {
+	writeErr := make(chan error, 1)
+	srv := newWriteDeadlineServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := bytes.Repeat([]byte("x"), 64*1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+	}), 50*time.Millisecond)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	// The response is not read.
+	select {
+	case err := <-writeErr:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write to the slow reader did not time out")
+	}
+}
+
+func TestSlidingWriteDeadlineProgressing(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 1024*1024)
+	srv := newWriteDeadlineServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write(body)
+		assert.NoError(t, err)
+	}), 100*time.Millisecond)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	// Reading the whole body takes longer than the timeout, but each chunk is
+	// read before it.
+	var buf bytes.Buffer
+	start := time.Now()
+	chunk := make([]byte, 64*1024)
+	for {
+		n, err := resp.Body.Read(chunk)
+		buf.Write(chunk[:n])
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Greater(t, int64(time.Since(start)), int64(100*time.Millisecond))
+	assert.Equal(t, len(body), buf.Len())
+
+	// The deadline of the idle connection is cleared for the next request.
+	time.Sleep(150 * time.Millisecond)
+	resp, err = http.Get(srv.URL)
+	require.NoError(t, err)
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(body), n)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestSlidingWriteDeadlineWithoutConn(t *testing.T) {
+	h := SlidingWriteDeadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}), time.Millisecond)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "ok", rec.Body.String())
+}
@@ -0,0 +1,50 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the maximum capacity of the buffers put back in
+// bodyBufferPool, so that a few huge requests don't keep their memory.
+const maxPooledBufferSize = 8 << 20
+
+// bodyBufferPool holds the buffers reading the request bodies before their
+// unmarshaling, so that they are not allocated and grown for each request.
+var bodyBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// withPooledBody reads r in a buffer of bodyBufferPool and calls fn with the
+// read bytes, that must not be retained once fn returns: the unmarshaled
+// messages copy the bytes and strings fields.
+func withPooledBody(r io.Reader, fn func(data []byte) error) error {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			buf.Reset()
+			bodyBufferPool.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	return fn(buf.Bytes())
+}
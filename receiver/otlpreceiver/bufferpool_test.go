@@ -0,0 +1,110 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	collectortrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/collector/trace/v1"
+)
+
+func TestWithPooledBody(t *testing.T) {
+	var got string
+	require.NoError(t, withPooledBody(strings.NewReader("first"), func(data []byte) error {
+		got = string(data)
+		return nil
+	}))
+	assert.Equal(t, "first", got)
+
+	// The reused buffer only has the bytes of the next body.
+	require.NoError(t, withPooledBody(strings.NewReader("2nd"), func(data []byte) error {
+		got = string(data)
+		return nil
+	}))
+	assert.Equal(t, "2nd", got)
+
+	errFn := errors.New("unmarshal failed")
+	assert.Equal(t, errFn, withPooledBody(strings.NewReader("body"), func([]byte) error { return errFn }))
+}
+
+func TestXProtobufDecoderPooledBody(t *testing.T) {
+	// The decoded messages don't share the memory of the reused buffers.
+	var reqs []*collectortrace.ExportTraceServiceRequest
+	for i := 0; i < 3; i++ {
+		data, err := proto.Marshal(newTestExportRequest(fmt.Sprint("span", i)))
+		require.NoError(t, err)
+		req := &collectortrace.ExportTraceServiceRequest{}
+		require.NoError(t, (&xProtobufMarshaler{}).NewDecoder(bytes.NewReader(data)).Decode(req))
+		reqs = append(reqs, req)
+	}
+	for i, req := range reqs {
+		assert.Equal(t, fmt.Sprint("span", i), req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans[0].Name)
+	}
+}
+
+func benchmarkExportRequest(b *testing.B) []byte {
+	req := newTestExportRequest("span")
+	spans := req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans
+	for i := 0; i < 1000; i++ {
+		spans = append(spans, spans[0])
+	}
+	req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans = spans
+	data, err := proto.Marshal(req)
+	require.NoError(b, err)
+	return data
+}
+
+// BenchmarkXProtobufDecoderReadAll decodes with a buffer allocated for each
+// request, as runtime.ProtoMarshaller does, to compare with
+// BenchmarkXProtobufDecoderPooledBody.
+func BenchmarkXProtobufDecoderReadAll(b *testing.B) {
+	data := benchmarkExportRequest(b)
+	m := &runtime.ProtoMarshaller{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body, err := ioutil.ReadAll(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = m.Unmarshal(body, &collectortrace.ExportTraceServiceRequest{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkXProtobufDecoderPooledBody(b *testing.B) {
+	data := benchmarkExportRequest(b)
+	m := &xProtobufMarshaler{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := m.NewDecoder(bytes.NewReader(data)).Decode(&collectortrace.ExportTraceServiceRequest{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
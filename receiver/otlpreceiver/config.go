@@ -31,4 +31,9 @@ type Config struct {
 
 	// Protocols is the configuration for the supported protocols, currently gRPC and HTTP (Proto and JSON).
 	Protocols `mapstructure:"protocols"`
+
+	// StrictJSON rejects the HTTP/JSON requests with fields unknown to the OTLP
+	// messages with an INVALID_ARGUMENT status, to catch the client bugs. By
+	// default the unknown fields are ignored. (optional, default false)
+	StrictJSON bool `mapstructure:"strict_json"`
 }
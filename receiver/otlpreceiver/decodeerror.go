@@ -0,0 +1,145 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+const (
+	decodeErrorReason        = "DECODE_ERROR"
+	decompressionErrorReason = "DECOMPRESSION_ERROR"
+	decodeErrorDomain        = "opentelemetry.io"
+
+	// maxDecodeDetailLength bounds the length of the description of the decode
+	// errors returned to the clients.
+	maxDecodeDetailLength = 256
+)
+
+// decodeError is returned by the decoders when the request body cannot be
+// unmarshaled, with the offset in the body where the decoding failed, or -1 if
+// unknown, and the sanitized error of the unmarshaler.
+type decodeError struct {
+	format string
+	offset int64
+	detail string
+}
+
+func newDecodeError(format string, offset int64, err error) *decodeError {
+	if offset < 0 {
+		offset = decodeErrorOffset(err)
+	}
+	return &decodeError{format: format, offset: offset, detail: sanitizeDecodeDetail(err.Error())}
+}
+
+func (e *decodeError) Error() string {
+	if e.offset < 0 {
+		return fmt.Sprintf("failed to decode the %s request body: %s", e.format, e.detail)
+	}
+	return fmt.Sprintf("failed to decode the %s request body at offset %d: %s", e.format, e.offset, e.detail)
+}
+
+// The grpc-gateway only keeps the message of the errors returned by the decoders,
+// this is used to recover the decodeError from its message.
+var decodeErrorRegexp = regexp.MustCompile(`^failed to decode the (\w+) request body(?: at offset (\d+))?: `)
+
+// decodeErrorInfo returns the ErrorInfo detail describing the decodeError
+// with the given message, or nil if it is not the message of a decodeError.
+func decodeErrorInfo(msg string) *errdetails.ErrorInfo {
+	matches := decodeErrorRegexp.FindStringSubmatch(msg)
+	if matches == nil {
+		return nil
+	}
+	info := &errdetails.ErrorInfo{
+		Reason:   decodeErrorReason,
+		Domain:   decodeErrorDomain,
+		Metadata: map[string]string{"format": matches[1]},
+	}
+	if matches[2] != "" {
+		info.Metadata["offset"] = matches[2]
+	}
+	return info
+}
+
+// decompressionErrorRegexp matches the message of a middleware.DecompressionError,
+// with its encoding, whether the body was truncated or corrupt and the number of
+// bytes decompressed before the failure.
+var decompressionErrorRegexp = regexp.MustCompile(`^failed to decompress the ([\w, ]+) request body, (truncated|corrupt) after (\d+) decompressed bytes: `)
+
+// decompressionErrorInfo returns the ErrorInfo detail describing the
+// middleware.DecompressionError with the given message, or nil if it is not the
+// message of a DecompressionError.
+func decompressionErrorInfo(msg string) *errdetails.ErrorInfo {
+	matches := decompressionErrorRegexp.FindStringSubmatch(msg)
+	if matches == nil {
+		return nil
+	}
+	return &errdetails.ErrorInfo{
+		Reason: decompressionErrorReason,
+		Domain: decodeErrorDomain,
+		Metadata: map[string]string{
+			"encoding":           matches[1],
+			"truncated":          strconv.FormatBool(matches[2] == "truncated"),
+			"decompressed_bytes": matches[3],
+		},
+	}
+}
+
+// decodeErrorOffset returns the offset of the JSON errors that have one.
+func decodeErrorOffset(err error) int64 {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset
+	}
+	return -1
+}
+
+// quotedRegexp matches the quoted strings of the error messages, which may be
+// values of the request.
+var (
+	quotedRegexp     = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	identifierRegexp = regexp.MustCompile(`^"[A-Za-z_][A-Za-z0-9_.\[\]]{0,63}"$`)
+)
+
+// sanitizeDecodeDetail removes the quoted values of the request from the error
+// message, keeping the quoted names like the field names, and truncates it to
+// maxDecodeDetailLength bytes.
+func sanitizeDecodeDetail(detail string) string {
+	detail = quotedRegexp.ReplaceAllStringFunc(detail, func(quoted string) string {
+		if identifierRegexp.MatchString(quoted) {
+			return quoted
+		}
+		return `"<redacted>"`
+	})
+	if len(detail) <= maxDecodeDetailLength {
+		return detail
+	}
+	cut := maxDecodeDetailLength
+	for cut > 0 && !utf8.RuneStart(detail[cut]) {
+		cut--
+	}
+	return detail[:cut] + "..."
+}
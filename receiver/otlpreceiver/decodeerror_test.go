@@ -0,0 +1,195 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+
+	collectortrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/collector/trace/v1"
+	"go.opentelemetry.io/collector/internal/middleware"
+)
+
+func TestSanitizeDecodeDetail(t *testing.T) {
+	tests := []struct {
+		name   string
+		detail string
+		want   string
+	}{
+		{
+			name:   "field_name",
+			detail: `unknown field "spanKind" in v1.Span`,
+			want:   `unknown field "spanKind" in v1.Span`,
+		},
+		{
+			name:   "value",
+			detail: `strconv.ParseInt: parsing "my secret token": invalid syntax`,
+			want:   `strconv.ParseInt: parsing "<redacted>": invalid syntax`,
+		},
+		{
+			name:   "escaped_quote",
+			detail: `bad value "a\"b c"`,
+			want:   `bad value "<redacted>"`,
+		},
+		{
+			name:   "truncated",
+			detail: strings.Repeat("é", maxDecodeDetailLength),
+			want:   strings.Repeat("é", maxDecodeDetailLength/2) + "...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeDecodeDetail(tt.detail))
+		})
+	}
+}
+
+func TestDecodeErrorInfo(t *testing.T) {
+	var syntaxErr error = &json.SyntaxError{Offset: 12}
+	tests := []struct {
+		name     string
+		err      *decodeError
+		wantMsg  string
+		metadata map[string]string
+	}{
+		{
+			name:     "json_offset",
+			err:      newDecodeError("JSON", -1, syntaxErr),
+			wantMsg:  "failed to decode the JSON request body at offset 12: ",
+			metadata: map[string]string{"format": "JSON", "offset": "12"},
+		},
+		{
+			name:     "protobuf",
+			err:      newDecodeError("protobuf", -1, errors.New("proto: illegal wireType 7")),
+			wantMsg:  "failed to decode the protobuf request body: proto: illegal wireType 7",
+			metadata: map[string]string{"format": "protobuf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, strings.HasPrefix(tt.err.Error(), tt.wantMsg), tt.err.Error())
+			info := decodeErrorInfo(tt.err.Error())
+			require.NotNil(t, info)
+			assert.Equal(t, decodeErrorReason, info.Reason)
+			assert.Equal(t, tt.metadata, info.Metadata)
+		})
+	}
+	assert.Nil(t, decodeErrorInfo("gzip: invalid header"))
+}
+
+func TestDecompressionErrorInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      *middleware.DecompressionError
+		metadata map[string]string
+	}{
+		{
+			name:     "truncated",
+			err:      &middleware.DecompressionError{Encoding: "gzip", DecompressedBytes: 1024, Truncated: true, Err: io.ErrUnexpectedEOF},
+			metadata: map[string]string{"encoding": "gzip", "truncated": "true", "decompressed_bytes": "1024"},
+		},
+		{
+			name:     "corrupt_stacked",
+			err:      &middleware.DecompressionError{Encoding: "gzip, zstd", Err: errors.New("gzip: invalid checksum")},
+			metadata: map[string]string{"encoding": "gzip, zstd", "truncated": "false", "decompressed_bytes": "0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := decompressionErrorInfo(tt.err.Error())
+			require.NotNil(t, info)
+			assert.Equal(t, decompressionErrorReason, info.Reason)
+			assert.Equal(t, tt.metadata, info.Metadata)
+		})
+	}
+	assert.Nil(t, decompressionErrorInfo("gzip: invalid header"))
+}
+
+func TestDecodeErrors(t *testing.T) {
+	invalid := []byte{0x0a, 0x05, 0xff}
+	var delimited []byte
+	delimited = appendDelimited(t, delimited, newTestExportRequest("first"))
+	firstLength := len(delimited)
+	delimited = append(delimited, byte(len(invalid)))
+	delimited = append(delimited, invalid...)
+
+	tests := []struct {
+		name       string
+		decode     func() error
+		wantPrefix string
+	}{
+		{
+			name: "protobuf",
+			decode: func() error {
+				return (&xProtobufMarshaler{}).NewDecoder(bytes.NewReader(invalid)).Decode(&collectortrace.ExportTraceServiceRequest{})
+			},
+			wantPrefix: "failed to decode the protobuf request body: ",
+		},
+		{
+			name: "protobuf_delimited",
+			decode: func() error {
+				return (&xProtobufDelimitedMarshaler{&xProtobufMarshaler{}}).NewDecoder(bytes.NewReader(delimited)).Decode(&collectortrace.ExportTraceServiceRequest{})
+			},
+			wantPrefix: "failed to decode the protobuf request body at offset " + strconv.Itoa(firstLength) + ": ",
+		},
+		{
+			name: "json",
+			decode: func() error {
+				return (&jsonPbFieldErrors{JSONPb: &JSONPb{}}).NewDecoder(strings.NewReader(`{"resourceSpans": [}`)).Decode(&collectortrace.ExportTraceServiceRequest{})
+			},
+			wantPrefix: "failed to decode the JSON request body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.decode()
+			require.Error(t, err)
+			var decodeErr *decodeError
+			require.True(t, errors.As(err, &decodeErr), err.Error())
+			assert.True(t, strings.HasPrefix(err.Error(), tt.wantPrefix), err.Error())
+		})
+	}
+}
+
+func TestGatewayErrorHandlerDecodeError(t *testing.T) {
+	err := newDecodeError("protobuf", 7, errors.New("proto: illegal wireType 7"))
+	rec := httptest.NewRecorder()
+	newGatewayErrorHandler(0)(context.Background(), nil, &xProtobufMarshaler{}, rec, nil, status.Error(codes.InvalidArgument, err.Error()))
+
+	sp := &spb.Status{}
+	require.NoError(t, protov2.Unmarshal(rec.Body.Bytes(), sp))
+	s := status.FromProto(sp)
+	assert.Equal(t, codes.InvalidArgument, s.Code())
+	assert.Equal(t, "failed to decode the protobuf request body at offset 7: proto: illegal wireType 7", s.Message())
+	require.Len(t, s.Details(), 1)
+	info, ok := s.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok, "Unexpected status detail %v", s.Details()[0])
+	assert.Equal(t, map[string]string{"format": "protobuf", "offset": "7"}, info.Metadata)
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/configgrpc"
@@ -117,11 +118,11 @@ func customUnmarshaler(componentViperSection *viper.Viper, intoCfg interface{})
 // CreateTraceReceiver creates a  trace receiver based on provided config.
 func createTraceReceiver(
 	ctx context.Context,
-	_ component.ReceiverCreateParams,
+	params component.ReceiverCreateParams,
 	cfg configmodels.Receiver,
 	nextConsumer consumer.TraceConsumer,
 ) (component.TraceReceiver, error) {
-	r, err := createReceiver(cfg)
+	r, err := createReceiver(cfg, params.Logger)
 	if err != nil {
 		return nil, err
 	}
@@ -134,11 +135,11 @@ func createTraceReceiver(
 // CreateMetricsReceiver creates a metrics receiver based on provided config.
 func createMetricsReceiver(
 	ctx context.Context,
-	_ component.ReceiverCreateParams,
+	params component.ReceiverCreateParams,
 	cfg configmodels.Receiver,
 	consumer consumer.MetricsConsumer,
 ) (component.MetricsReceiver, error) {
-	r, err := createReceiver(cfg)
+	r, err := createReceiver(cfg, params.Logger)
 	if err != nil {
 		return nil, err
 	}
@@ -151,11 +152,11 @@ func createMetricsReceiver(
 // CreateLogReceiver creates a log receiver based on provided config.
 func createLogReceiver(
 	ctx context.Context,
-	_ component.ReceiverCreateParams,
+	params component.ReceiverCreateParams,
 	cfg configmodels.Receiver,
 	consumer consumer.LogsConsumer,
 ) (component.LogsReceiver, error) {
-	r, err := createReceiver(cfg)
+	r, err := createReceiver(cfg, params.Logger)
 	if err != nil {
 		return nil, err
 	}
@@ -165,7 +166,7 @@ func createLogReceiver(
 	return r, nil
 }
 
-func createReceiver(cfg configmodels.Receiver) (*otlpReceiver, error) {
+func createReceiver(cfg configmodels.Receiver, logger *zap.Logger) (*otlpReceiver, error) {
 	rCfg := cfg.(*Config)
 
 	// There must be one receiver for both metrics and traces. We maintain a map of
@@ -176,7 +177,7 @@ func createReceiver(cfg configmodels.Receiver) (*otlpReceiver, error) {
 	if !ok {
 		var err error
 		// We don't have a receiver, so create one.
-		receiver, err = newOtlpReceiver(rCfg)
+		receiver, err = newOtlpReceiver(rCfg, logger)
 		if err != nil {
 			return nil, err
 		}
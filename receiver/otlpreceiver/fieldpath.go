@@ -0,0 +1,186 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+// fieldViolationError is returned by the decoders when the field of the
+// request that failed to decode could be located.
+type fieldViolationError struct {
+	field string
+	err   error
+}
+
+func (e *fieldViolationError) Error() string {
+	return fmt.Sprintf("invalid value for field %q: %v", e.field, e.err)
+}
+
+// The grpc-gateway only keeps the message of the errors returned by the decoders,
+// this is used to recover the field from the message of a fieldViolationError.
+var fieldViolationRegexp = regexp.MustCompile(`^invalid value for field ("(?:[^"\\]|\\.)*"): (.*)$`)
+
+// parseFieldViolation returns the field and the description of the violation
+// from the message of a fieldViolationError.
+func parseFieldViolation(msg string) (field string, description string, ok bool) {
+	matches := fieldViolationRegexp.FindStringSubmatch(msg)
+	if matches == nil {
+		return "", "", false
+	}
+	field, err := strconv.Unquote(matches[1])
+	if err != nil {
+		return "", "", false
+	}
+	return field, matches[2], true
+}
+
+const (
+	// maxFieldLocationSize is the size of the data above which only the top-level
+	// invalid field is located by locateInvalidField.
+	maxFieldLocationSize = 64 << 10
+	// maxFieldLocationDecodes is the maximum number of fields decoded on their
+	// own by locateInvalidField, the path of the invalid field located so far is
+	// returned past it.
+	maxFieldLocationDecodes = 256
+)
+
+// locateInvalidField returns the path (e.g.: resourceSpans[0].resource) of the
+// innermost field of the JSON encoded data that cannot be decoded into msg,
+// or an empty string if the invalid field cannot be located.
+//
+// Each field is decoded on its own into an empty message of the enclosing type,
+// so this is expensive and only meant to be used after decoding failed. The
+// work is bounded by maxFieldLocationSize and maxFieldLocationDecodes.
+func locateInvalidField(data []byte, msg proto.Message) string {
+	t := reflect.TypeOf(msg)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	l := &fieldLocator{decodes: maxFieldLocationDecodes}
+	if len(data) > maxFieldLocationSize {
+		l.maxDepth = 1
+	}
+	return l.locate(data, t.Elem(), "", 0)
+}
+
+// fieldLocator bounds the search of locateInvalidField: at most decodes fields
+// are decoded, and only maxDepth levels of fields if it is not zero.
+type fieldLocator struct {
+	decodes  int
+	maxDepth int
+}
+
+// locate returns the path of the invalid field of data, of type t at the given
+// depth, or an empty string if it is not located within the limits.
+func (l *fieldLocator) locate(data []byte, t reflect.Type, path string, depth int) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return path
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if l.decodes <= 0 {
+			return ""
+		}
+		l.decodes--
+		single, err := json.Marshal(map[string]json.RawMessage{key: fields[key]})
+		if err != nil {
+			return ""
+		}
+		if unmarshalJSONPb(single, reflect.New(t).Interface()) == nil {
+			continue
+		}
+
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		if l.maxDepth > 0 && depth+1 >= l.maxDepth {
+			return fieldPath
+		}
+		elemType, repeated, ok := messageFieldType(t, key)
+		if !ok {
+			return fieldPath
+		}
+		if !repeated {
+			if p := l.locate(fields[key], elemType, fieldPath, depth+1); p != "" {
+				return p
+			}
+			return fieldPath
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(fields[key], &elems); err != nil {
+			return fieldPath
+		}
+		for i, elem := range elems {
+			if p := l.locate(elem, elemType, fmt.Sprintf("%s[%d]", fieldPath, i), depth+1); p != "" {
+				return p
+			}
+			if l.decodes <= 0 {
+				break
+			}
+		}
+		return fieldPath
+	}
+	return ""
+}
+
+// messageFieldType returns the struct type of the message field of t with the
+// given JSON or original proto name, and whether the field is repeated.
+func messageFieldType(t reflect.Type, name string) (reflect.Type, bool, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !hasProtoName(f.Tag.Get("protobuf"), name) {
+			continue
+		}
+		ft := f.Type
+		repeated := false
+		if ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+			repeated = true
+		}
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || !reflect.PtrTo(ft).Implements(typeProtoMessage) {
+			return nil, false, false
+		}
+		return ft, repeated, true
+	}
+	return nil, false, false
+}
+
+func hasProtoName(tag string, name string) bool {
+	for _, p := range strings.Split(tag, ",") {
+		if p == "name="+name || p == "json="+name {
+			return true
+		}
+	}
+	return false
+}
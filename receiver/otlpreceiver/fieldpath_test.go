@@ -0,0 +1,101 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	collectortrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/collector/trace/v1"
+)
+
+func TestLocateInvalidField(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			name: "valid",
+			json: `{"resourceSpans": [{"instrumentationLibrarySpans": [{"spans": [{"name": "ok"}]}]}]}`,
+			want: "",
+		},
+		{
+			name: "not_an_object",
+			json: `[]`,
+			want: "",
+		},
+		{
+			name: "repeated_field_not_a_list",
+			json: `{"resourceSpans": {}}`,
+			want: "resourceSpans",
+		},
+		{
+			name: "nested_enum",
+			json: `{"resourceSpans": [{}, {"instrumentationLibrarySpans": [{"spans": [{"kind": true}]}]}]}`,
+			want: "resourceSpans[1].instrumentationLibrarySpans[0].spans[0].kind",
+		},
+		{
+			name: "original_proto_name",
+			json: `{"resource_spans": [{"resource": {"dropped_attributes_count": "NaN"}}]}`,
+			want: "resource_spans[0].resource.dropped_attributes_count",
+		},
+		{
+			name: "scalar_field",
+			json: `{"resourceSpans": [{"instrumentationLibrarySpans": [{"spans": [{"name": 1}]}]}]}`,
+			want: "resourceSpans[0].instrumentationLibrarySpans[0].spans[0].name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, locateInvalidField([]byte(tt.json), &collectortrace.ExportTraceServiceRequest{}))
+		})
+	}
+}
+
+func TestLocateInvalidFieldLimits(t *testing.T) {
+	invalid := `{"resourceSpans": [{"instrumentationLibrarySpans": [{"spans": [{"name": 1}]}]}]}`
+	// Only the top-level field of the large bodies is located.
+	large := `{"resourceSpans": [` + strings.Repeat(`{"instrumentationLibrarySpans": [{"spans": [{"name": "ok"}]}]}, `, maxFieldLocationSize/60) +
+		`{"instrumentationLibrarySpans": [{"spans": [{"name": 1}]}]}]}`
+	require.Greater(t, len(large), maxFieldLocationSize)
+	assert.Equal(t, "resourceSpans", locateInvalidField([]byte(large), &collectortrace.ExportTraceServiceRequest{}))
+
+	// Past the decodes, the path located so far is returned.
+	msg := reflect.TypeOf(collectortrace.ExportTraceServiceRequest{})
+	l := &fieldLocator{decodes: 2}
+	assert.Equal(t, "resourceSpans[0].instrumentationLibrarySpans", l.locate([]byte(invalid), msg, "", 0))
+	l = &fieldLocator{decodes: 1}
+	assert.Equal(t, "resourceSpans", l.locate([]byte(invalid), msg, "", 0))
+	many := `{"resourceSpans": [` + strings.Repeat(`{"instrumentationLibrarySpans": []}, `, 10) + `{"instrumentationLibrarySpans": {}}]}`
+	l = &fieldLocator{decodes: 5}
+	assert.Equal(t, "resourceSpans", l.locate([]byte(many), msg, "", 0))
+}
+
+func TestParseFieldViolation(t *testing.T) {
+	err := &fieldViolationError{field: `spans[0]."quoted"`, err: errors.New("bad: value")}
+	field, desc, ok := parseFieldViolation(err.Error())
+	assert.True(t, ok)
+	assert.Equal(t, `spans[0]."quoted"`, field)
+	assert.Equal(t, "bad: value", desc)
+
+	_, _, ok = parseFieldViolation("gzip: invalid header")
+	assert.False(t, ok)
+}
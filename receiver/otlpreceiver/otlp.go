@@ -22,6 +22,7 @@ import (
 	"sync"
 
 	gatewayruntime "github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 
 	"go.opentelemetry.io/collector/component"
@@ -39,6 +40,7 @@ import (
 // otlpReceiver is the type that exposes Trace and Metrics reception.
 type otlpReceiver struct {
 	cfg        *Config
+	logger     *zap.Logger
 	serverGRPC *grpc.Server
 	gatewayMux *gatewayruntime.ServeMux
 	serverHTTP *http.Server
@@ -54,9 +56,10 @@ type otlpReceiver struct {
 // newOtlpReceiver just creates the OpenTelemetry receiver services. It is the caller's
 // responsibility to invoke the respective Start*Reception methods as well
 // as the various Stop*Reception methods to end it.
-func newOtlpReceiver(cfg *Config) (*otlpReceiver, error) {
+func newOtlpReceiver(cfg *Config, logger *zap.Logger) (*otlpReceiver, error) {
 	r := &otlpReceiver{
-		cfg: cfg,
+		cfg:    cfg,
+		logger: logger,
 	}
 	if cfg.GRPC != nil {
 		opts, err := cfg.GRPC.ToServerOption()
@@ -75,8 +78,10 @@ func newOtlpReceiver(cfg *Config) (*otlpReceiver, error) {
 			OrigName:     true,
 		}
 		r.gatewayMux = gatewayruntime.NewServeMux(
-			gatewayruntime.WithMarshalerOption("application/x-protobuf", &xProtobufMarshaler{}),
-			gatewayruntime.WithMarshalerOption(gatewayruntime.MIMEWildcard, jsonpb),
+			gatewayruntime.WithMarshalerOption(pbContentType, &xProtobufMarshaler{}),
+			gatewayruntime.WithMarshalerOption(pbDelimitedContentType, &xProtobufDelimitedMarshaler{&xProtobufMarshaler{}}),
+			gatewayruntime.WithMarshalerOption(gatewayruntime.MIMEWildcard, &jsonPbFieldErrors{JSONPb: jsonpb, strict: cfg.StrictJSON}),
+			gatewayruntime.WithProtoErrorHandler(newGatewayErrorHandler(cfg.HTTP.RetryAfter)),
 		)
 	}
 
@@ -106,32 +111,37 @@ func (r *otlpReceiver) Start(_ context.Context, host component.Host) error {
 		}
 		if r.cfg.HTTP != nil {
 			r.serverHTTP = r.cfg.HTTP.ToServer(
-				r.gatewayMux,
-				confighttp.WithErrorHandler(OTLPErrorHandler),
+				contextBodyHandler(partialSuccessHandler(r.gatewayMux)),
+				confighttp.WithErrorHandler(otlpErrorHandler(r.cfg.HTTP.RetryAfter)),
+				confighttp.WithLogger(r.logger),
+				confighttp.WithPaths(r.httpPaths()...),
+				confighttp.WithDefaultContentTypes(pbContentType, jsonContentType, pbDelimitedContentType),
 			)
-			var hln net.Listener
-			hln, err = r.cfg.HTTP.ToListener()
+			var hlns []net.Listener
+			hlns, err = r.cfg.HTTP.ToListeners()
 			if err != nil {
 				return
 			}
-			go func() {
-				if errHTTP := r.serverHTTP.Serve(hln); errHTTP != nil {
-					host.ReportFatalError(errHTTP)
-				}
-			}()
+			for _, hln := range hlns {
+				go func(hln net.Listener) {
+					if errHTTP := r.serverHTTP.Serve(hln); errHTTP != nil {
+						host.ReportFatalError(errHTTP)
+					}
+				}(hln)
+			}
 		}
 	})
 	return err
 }
 
 // Shutdown is a method to turn off receiving.
-func (r *otlpReceiver) Shutdown(context.Context) error {
+func (r *otlpReceiver) Shutdown(ctx context.Context) error {
 	var err error
 	r.stopOnce.Do(func() {
 		err = nil
 
 		if r.serverHTTP != nil {
-			err = r.serverHTTP.Close()
+			err = r.cfg.HTTP.Shutdown(ctx, r.serverHTTP)
 		}
 
 		if r.serverGRPC != nil {
@@ -141,6 +151,28 @@ func (r *otlpReceiver) Shutdown(context.Context) error {
 	return err
 }
 
+// URL paths of the OTLP/HTTP services, see the grpc-gateway handlers.
+const (
+	traceHTTPPath   = "/v1/trace"
+	metricsHTTPPath = "/v1/metrics"
+	logsHTTPPath    = "/v1/logs"
+)
+
+// httpPaths returns the URL paths of the services registered in the gateway.
+func (r *otlpReceiver) httpPaths() []string {
+	var paths []string
+	if r.traceReceiver != nil {
+		paths = append(paths, traceHTTPPath)
+	}
+	if r.metricsReceiver != nil {
+		paths = append(paths, metricsHTTPPath)
+	}
+	if r.logReceiver != nil {
+		paths = append(paths, logsHTTPPath)
+	}
+	return paths
+}
+
 func (r *otlpReceiver) registerTraceConsumer(ctx context.Context, tc consumer.TraceConsumer) error {
 	if tc == nil {
 		return componenterror.ErrNilNextConsumer
@@ -18,20 +18,29 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
@@ -68,6 +77,10 @@ func TestGrpcGateway_endToEnd(t *testing.T) {
 			name:     "JSONGzipCompressed",
 			encoding: "gzip",
 		},
+		{
+			name:     "JSONIdentityEncoded",
+			encoding: "identity",
+		},
 	}
 	addr := testutil.GetAvailableLocalAddress(t)
 
@@ -212,6 +225,10 @@ func TestProtoHttp(t *testing.T) {
 			name:     "ProtoGzipCompressed",
 			encoding: "gzip",
 		},
+		{
+			name:     "ProtoIdentityEncoded",
+			encoding: "identity",
+		},
 	}
 	addr := testutil.GetAvailableLocalAddress(t)
 
@@ -364,6 +381,325 @@ func TestOTLPReceiverInvalidContentEncoding(t *testing.T) {
 	}
 }
 
+func TestOTLPReceiverDeniedContentEncoding(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.SetName(otlpReceiverName)
+	cfg.HTTP.Endpoint = addr
+	cfg.HTTP.DeniedEncodings = []string{"zstd"}
+	cfg.GRPC = nil
+	ocr := newReceiver(t, factory, cfg, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString("{}"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "zstd")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 501, resp.StatusCode, "Unexpected return status")
+	assert.NotContains(t, resp.Header.Get("Accept-Encoding"), "zstd")
+	assert.Contains(t, resp.Header.Get("Accept-Encoding"), "gzip")
+	sp := &spb.Status{}
+	require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+	assert.Equal(t, codes.Unimplemented, status.FromProto(sp).Code())
+	assert.Empty(t, tSink.AllTraces())
+}
+
+func TestOTLPReceiverUnsupportedContentEncoding(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	ocr := newHTTPReceiver(t, addr, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString("{}"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "lz4")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 501, resp.StatusCode, "Unexpected return status")
+	assert.Contains(t, resp.Header.Get("Accept-Encoding"), "gzip")
+	sp := &spb.Status{}
+	require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+	st := status.FromProto(sp)
+	assert.Equal(t, codes.Unimplemented, st.Code())
+	assert.Contains(t, st.Message(), `unsupported content encoding "lz4", supported encodings: `)
+	assert.Empty(t, tSink.AllTraces())
+}
+
+func TestOTLPReceiverTruncatedCompressedBody(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	ocr := newHTTPReceiver(t, addr, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	traceBytes, err := (&collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: pdata.TracesToOtlp(testdata.GenerateTraceDataOneSpan()),
+	}).Marshal()
+	require.NoError(t, err)
+	compressed, err := compressGzip(traceBytes)
+	require.NoError(t, err)
+
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(compressed.Bytes()[:compressed.Len()-4]))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 400, resp.StatusCode, "Unexpected return status")
+	sp := &spb.Status{}
+	require.NoError(t, protov2.Unmarshal(respBytes, sp))
+	st := status.FromProto(sp)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok, "Unexpected status detail %v", st.Details()[0])
+	assert.Equal(t, "DECOMPRESSION_ERROR", info.Reason)
+	assert.Equal(t, map[string]string{
+		"encoding":           "gzip",
+		"truncated":          "true",
+		"decompressed_bytes": strconv.Itoa(len(traceBytes)),
+	}, info.Metadata)
+	assert.Empty(t, tSink.AllTraces())
+}
+
+func TestOTLPReceiverHeaderLimits(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.HTTP.Endpoint = addr
+	cfg.HTTP.MaxRequestHeaderValueLength = 32
+	cfg.GRPC = nil
+	ocr := newReceiver(t, factory, cfg, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString("{}"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", strings.Repeat("a", 33))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 431, resp.StatusCode, "Unexpected return status")
+	sp := &spb.Status{}
+	require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+	st := status.FromProto(sp)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, `the value of the "X-Tenant" header is longer than 32 bytes`, st.Message())
+	assert.Empty(t, tSink.AllTraces())
+}
+
+func TestOTLPReceiverFieldViolation(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	ocr := newHTTPReceiver(t, addr, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	body := `{"resourceSpans": [{"instrumentationLibrarySpans": [{"spans": [{"name": "ok"}, {"name": "bad", "kind": "NOT_A_KIND"}]}]}]}`
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 400, resp.StatusCode, "Unexpected return status")
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Unexpected response Content-Type")
+
+	sp := &spb.Status{}
+	require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+	s := status.FromProto(sp)
+	assert.Equal(t, codes.InvalidArgument, s.Code())
+	require.Len(t, s.Details(), 1)
+	badRequest, ok := s.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok, "Unexpected status detail %v", s.Details()[0])
+	require.Len(t, badRequest.FieldViolations, 1)
+	assert.Equal(t, "resourceSpans[0].instrumentationLibrarySpans[0].spans[1].kind", badRequest.FieldViolations[0].Field)
+	assert.NotEmpty(t, badRequest.FieldViolations[0].Description)
+	assert.Empty(t, tSink.AllTraces())
+}
+
+func TestOTLPReceiverDelimitedProtobuf(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	ocr := newHTTPReceiver(t, addr, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	var body []byte
+	body = appendDelimited(t, body, newTestExportRequest("first"))
+	body = appendDelimited(t, body, newTestExportRequest("second"))
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	resp, err := http.Post(url, pbDelimitedContentType, bytes.NewReader(body))
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 200, resp.StatusCode, "Unexpected return status")
+	assert.Equal(t, "application/x-protobuf", resp.Header.Get("Content-Type"), "Unexpected response Content-Type")
+	require.Len(t, tSink.AllTraces(), 1)
+	assert.Equal(t, 2, tSink.AllTraces()[0].SpanCount())
+}
+
+func TestOTLPReceiverNotFound(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	ocr := newHTTPReceiver(t, addr, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	tests := []struct {
+		path        string
+		contentType string
+	}{
+		{path: "/v1/unknown", contentType: "application/json"},
+		// No metrics consumer is registered.
+		{path: "/v1/metrics", contentType: "application/x-protobuf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			url := fmt.Sprintf("http://%s%s", addr, tt.path)
+			resp, err := http.Post(url, tt.contentType, bytes.NewBufferString("{}"))
+			require.NoError(t, err, "Error posting to grpc-gateway server: %v", err)
+			respBytes, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err, "Error reading response from grpc-gateway")
+			require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+			require.Equal(t, 404, resp.StatusCode, "Unexpected return status")
+			require.Equal(t, tt.contentType, resp.Header.Get("Content-Type"), "Unexpected response Content-Type")
+			sp := &spb.Status{}
+			if tt.contentType == "application/json" {
+				require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+			} else {
+				require.NoError(t, protov2.Unmarshal(respBytes, sp))
+			}
+			assert.Equal(t, codes.NotFound, status.FromProto(sp).Code())
+		})
+	}
+}
+
+func TestOTLPReceiverUnsupportedContentType(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	ocr := newHTTPReceiver(t, addr, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	resp, err := http.Post(url, "text/plain", bytes.NewBufferString("{}"))
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 415, resp.StatusCode, "Unexpected return status")
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Unexpected response Content-Type")
+	sp := &spb.Status{}
+	require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+	s := status.FromProto(sp)
+	assert.Equal(t, codes.InvalidArgument, s.Code())
+	assert.Equal(t, `unsupported content type "text/plain", supported content types: application/x-protobuf, application/json, application/x-protobuf-delimited`, s.Message())
+	assert.Empty(t, tSink.AllTraces())
+}
+
+func TestOTLPReceiverDigestMismatch(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tSink := new(exportertest.SinkTraceExporter)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.SetName(otlpReceiverName)
+	cfg.HTTP.Endpoint = addr
+	cfg.HTTP.DigestValidation = &confighttp.DigestValidationSettings{}
+	cfg.GRPC = nil
+	ocr := newReceiver(t, factory, cfg, tSink, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	sum := sha256.Sum256([]byte("other"))
+	url := fmt.Sprintf("http://%s/v1/trace", addr)
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString("{}"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "Error posting trace to grpc-gateway server: %v", err)
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Error reading response from trace grpc-gateway")
+	require.NoError(t, resp.Body.Close(), "Error closing response body")
+
+	require.Equal(t, 400, resp.StatusCode, "Unexpected return status")
+	sp := &spb.Status{}
+	require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(respBytes), sp))
+	s := status.FromProto(sp)
+	assert.Equal(t, codes.InvalidArgument, s.Code())
+	assert.Equal(t, "the request body does not match its digest", s.Message())
+	assert.Empty(t, tSink.AllTraces())
+}
+
 func TestGRPCNewPortAlreadyUsed(t *testing.T) {
 	addr := testutil.GetAvailableLocalAddress(t)
 	ln, err := net.Listen("tcp", addr)
@@ -544,7 +880,7 @@ func TestGRPCInvalidTLSCredentials(t *testing.T) {
 	}
 
 	// TLS is resolved during Creation of the receiver for GRPC.
-	_, err := createReceiver(cfg)
+	_, err := createReceiver(cfg, zap.NewNop())
 	assert.EqualError(t, err,
 		`failed to load TLS config: for auth via TLS, either both certificate and key must be supplied, or neither`)
 }
@@ -591,7 +927,7 @@ func newHTTPReceiver(t *testing.T, endpoint string, tc consumer.TraceConsumer, m
 }
 
 func newReceiver(t *testing.T, factory component.ReceiverFactory, cfg *Config, tc consumer.TraceConsumer, mc consumer.MetricsConsumer) *otlpReceiver {
-	r, err := createReceiver(cfg)
+	r, err := createReceiver(cfg, zap.NewNop())
 	require.NoError(t, err)
 	if tc != nil {
 		params := component.ReceiverCreateParams{}
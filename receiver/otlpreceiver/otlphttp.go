@@ -15,16 +15,41 @@
 package otlpreceiver
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/gogo/protobuf/jsonpb"
+	gogojsonpb "github.com/gogo/protobuf/jsonpb"
+	gogoproto "github.com/gogo/protobuf/proto"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	pbContentType   = "application/x-protobuf"
+	jsonContentType = "application/json"
+	// pbDelimitedContentType is the content type of the requests with a body
+	// made of a stream of varint length-delimited protobuf messages, which are
+	// merged into a single request. The responses are encoded as pbContentType.
+	// The grpc-gateway chooses the marshaler with the media type only, so the
+	// streaming can't be signaled by a parameter of pbContentType.
+	pbDelimitedContentType = "application/x-protobuf-delimited"
+)
+
 // xProtobufMarshaler is a Marshaler which wraps runtime.ProtoMarshaller
 // and sets ContentType to application/x-protobuf
 type xProtobufMarshaler struct {
@@ -33,31 +58,261 @@ type xProtobufMarshaler struct {
 
 // ContentType always returns "application/x-protobuf".
 func (*xProtobufMarshaler) ContentType() string {
-	return "application/x-protobuf"
+	return pbContentType
+}
+
+// NewDecoder returns a Decoder which reads the whole protobuf message from "r",
+// like runtime.ProtoMarshaller but in a pooled buffer, and reports the
+// unmarshaling errors as a decodeError.
+func (m *xProtobufMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		return withPooledBody(r, func(data []byte) error {
+			if err := m.ProtoMarshaller.Unmarshal(data, v); err != nil {
+				return newDecodeError("protobuf", -1, err)
+			}
+			return nil
+		})
+	})
+}
+
+// xProtobufDelimitedMarshaler is an xProtobufMarshaler which decodes a stream of
+// length-delimited messages. The grpc-gateway buffers the request body before
+// decoding it, but unlike runtime.ProtoMarshaller each message is read and
+// unmarshaled on its own, so the body is not copied whole a second time.
+type xProtobufDelimitedMarshaler struct {
+	*xProtobufMarshaler
+}
+
+// NewDecoder returns a Decoder which merges the length-delimited messages read
+// from "r" into the decoded message.
+func (*xProtobufDelimitedMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		msg, ok := v.(gogoproto.Message)
+		if !ok {
+			return fmt.Errorf("%T is not a proto.Message", v)
+		}
+		msg.Reset()
+		br := bufio.NewReader(r)
+		var buf bytes.Buffer
+		// offset is the offset in the body of the current message.
+		var offset int64
+		for {
+			size, err := binary.ReadUvarint(br)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read the length of a delimited message: %w", err)
+			}
+			// bytes.Buffer only grows with the data actually read, so that an
+			// invalid size doesn't allocate more than the size of the body.
+			buf.Reset()
+			if _, err = io.CopyN(&buf, br, int64(size)); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("failed to read a delimited message: %w", err)
+			}
+			if err = gogoproto.UnmarshalMerge(buf.Bytes(), msg); err != nil {
+				return newDecodeError("protobuf", offset, err)
+			}
+			var sizeBuf [binary.MaxVarintLen64]byte
+			offset += int64(binary.PutUvarint(sizeBuf[:], size)) + int64(size)
+		}
+	})
+}
+
+// contextBodyHandler stops reading the request body of the requests handled by h
+// once their context is done, so a request cancelled while its body is buffered
+// for decoding doesn't keep reading a large payload.
+func contextBodyHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &contextReadCloser{ctx: r.Context(), ReadCloser: r.Body}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type contextReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (c *contextReadCloser) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.ReadCloser.Read(p)
+}
+
+// jsonPbFieldErrors is a JSONPb that reports the path of the field that failed
+// to decode as a fieldViolationError, when it can be located.
+type jsonPbFieldErrors struct {
+	*JSONPb
+	// strict rejects the messages with unknown fields, instead of ignoring them.
+	strict bool
 }
 
+// NewDecoder returns a Decoder which reads the whole JSON message from "r", in a
+// pooled buffer.
+func (j *jsonPbFieldErrors) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		return withPooledBody(r, func(data []byte) error {
+			err := j.unmarshal(data, v)
+			if err != nil && err != io.EOF {
+				if msg, ok := v.(gogoproto.Message); ok {
+					if field := locateInvalidField(data, msg); field != "" {
+						return &fieldViolationError{field: field, err: errors.New(sanitizeDecodeDetail(err.Error()))}
+					}
+				}
+				return newDecodeError("JSON", -1, err)
+			}
+			return err
+		})
+	})
+}
+
+// unmarshal decodes the JSON message in v, see JSONPb.Unmarshal, rejecting the
+// unknown fields of the messages when strict is set.
+func (j *jsonPbFieldErrors) unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(gogoproto.Message)
+	if !j.strict || !ok {
+		return j.Unmarshal(data, v)
+	}
+	unmarshaler := &gogojsonpb.Unmarshaler{AllowUnknownFields: false}
+	return unmarshaler.UnmarshalNext(json.NewDecoder(bytes.NewReader(data)), msg)
+}
+
+// Status messages must be marshaled with github.com/golang/protobuf since the
+// details are registered there and not in github.com/gogo/protobuf.
 var jsonMarshaller = &jsonpb.Marshaler{}
 
 // OTLPErrorHandler encodes the HTTP error message inside a rpc.Status message as required
 // by the OTLP protocol.
 func OTLPErrorHandler(w http.ResponseWriter, r *http.Request, errMsg string, statusCode int) {
+	handleOTLPError(w, r, errMsg, statusCode, 0)
+}
+
+// otlpErrorHandler returns an OTLPErrorHandler which adds a RetryInfo detail with
+// the retryAfter delay to the statuses of the errors that can be retried.
+func otlpErrorHandler(retryAfter time.Duration) func(w http.ResponseWriter, r *http.Request, errMsg string, statusCode int) {
+	return func(w http.ResponseWriter, r *http.Request, errMsg string, statusCode int) {
+		handleOTLPError(w, r, errMsg, statusCode, retryAfter)
+	}
+}
+
+func handleOTLPError(w http.ResponseWriter, r *http.Request, errMsg string, statusCode int, retryAfter time.Duration) {
+	var s *status.Status
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusRequestHeaderFieldsTooLarge:
+		s = status.New(codes.InvalidArgument, errMsg)
+	case http.StatusNotFound:
+		s = status.New(codes.NotFound, errMsg)
+	case http.StatusPreconditionFailed:
+		s = status.New(codes.FailedPrecondition, errMsg)
+	case http.StatusNotImplemented:
+		s = status.New(codes.Unimplemented, errMsg)
+	case http.StatusTooManyRequests:
+		s = status.New(codes.ResourceExhausted, errMsg)
+	case http.StatusServiceUnavailable:
+		s = status.New(codes.Unavailable, errMsg)
+	case http.StatusGatewayTimeout:
+		s = status.New(codes.DeadlineExceeded, errMsg)
+	default:
+		s = status.New(codes.Internal, errMsg)
+	}
+
+	contentType := negotiateContentType(r)
+	writeStatus(w, withRetryInfo(s, retryAfter), statusCode, contentType, contentType == jsonContentType)
+}
+
+// withRetryInfo adds a RetryInfo detail with the retryAfter delay to the status
+// if its code is one of the codes of the retryable errors, UNAVAILABLE and
+// RESOURCE_EXHAUSTED, and the delay is positive.
+func withRetryInfo(s *status.Status, retryAfter time.Duration) *status.Status {
+	if retryAfter <= 0 || (s.Code() != codes.Unavailable && s.Code() != codes.ResourceExhausted) {
+		return s
+	}
+	ds, err := s.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(retryAfter)})
+	if err != nil {
+		return s
+	}
+	return ds
+}
+
+// negotiateContentType returns the content type of the response to r, chosen the
+// same way as the grpc-gateway chooses the marshaler of the response: the Accept
+// header if it lists one of the OTLP content types, otherwise the type of the
+// request. JSON is used for requests of any other content type.
+func negotiateContentType(r *http.Request) string {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, v := range strings.Split(accept, ",") {
+			if mediaType, _, err := mime.ParseMediaType(v); err == nil {
+				switch mediaType {
+				case pbContentType, jsonContentType:
+					return mediaType
+				}
+			}
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		if mediaType == pbContentType || mediaType == pbDelimitedContentType {
+			return pbContentType
+		}
+	}
+	return jsonContentType
+}
+
+// newGatewayErrorHandler returns a runtime.ProtoErrorHandlerFunc that encodes the
+// errors returned by the grpc-gateway handlers inside a rpc.Status message. Decoding
+// errors of a known field are reported as a BadRequest field violation detail,
+// the other decoding errors as an ErrorInfo detail with the offset if known, the
+// decompression errors of the body as an ErrorInfo detail with the number of
+// bytes decompressed, and the retryAfter delay as a RetryInfo detail of the retryable errors.
+func newGatewayErrorHandler(retryAfter time.Duration) runtime.ProtoErrorHandlerFunc {
+	return func(_ context.Context, _ *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+		s, ok := status.FromError(err)
+		if !ok {
+			s = status.New(codes.Unknown, err.Error())
+		}
+		if s.Code() == codes.InvalidArgument {
+			if field, desc, ok := parseFieldViolation(s.Message()); ok {
+				violation := &errdetails.BadRequest_FieldViolation{Field: field, Description: desc}
+				if ds, errDetails := s.WithDetails(&errdetails.BadRequest{
+					FieldViolations: []*errdetails.BadRequest_FieldViolation{violation},
+				}); errDetails == nil {
+					s = ds
+				}
+			} else if info := decodeErrorInfo(s.Message()); info != nil {
+				if ds, errDetails := s.WithDetails(info); errDetails == nil {
+					s = ds
+				}
+			} else if info := decompressionErrorInfo(s.Message()); info != nil {
+				if ds, errDetails := s.WithDetails(info); errDetails == nil {
+					s = ds
+				}
+			}
+		}
+
+		s = withRetryInfo(s, retryAfter)
+
+		contentType := marshaler.ContentType()
+		writeStatus(w, s, runtime.HTTPStatusFromCode(s.Code()), contentType, contentType != pbContentType)
+	}
+}
+
+// writeStatus writes the status marshaled as JSON or as binary protobuf.
+func writeStatus(w http.ResponseWriter, s *status.Status, statusCode int, contentType string, asJSON bool) {
 	var (
 		msg []byte
-		s   *status.Status
 		err error
 	)
 	// Pre-computed status with code=Internal to be used in case of a marshaling error.
 	fallbackMsg := []byte(`{"code": 13, "message": "failed to marshal error message"}`)
 	fallbackContentType := "application/json"
 
-	if statusCode == http.StatusBadRequest {
-		s = status.New(codes.InvalidArgument, errMsg)
-	} else {
-		s = status.New(codes.Internal, errMsg)
-	}
-
-	contentType := r.Header.Get("Content-Type")
-	if contentType == "application/json" {
+	if asJSON {
 		buf := new(bytes.Buffer)
 		err = jsonMarshaller.Marshal(buf, s.Proto())
 		msg = buf.Bytes()
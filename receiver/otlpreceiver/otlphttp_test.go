@@ -0,0 +1,325 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+
+	collectortrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/collector/trace/v1"
+	otlptrace "go.opentelemetry.io/collector/internal/data/opentelemetry-proto-gen/trace/v1"
+)
+
+// cancelingReader cancels the context after the first read.
+type cancelingReader struct {
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (c *cancelingReader) Read(p []byte) (int, error) {
+	c.reads++
+	c.cancel()
+	return copy(p, "x"), nil
+}
+
+func TestContextBodyHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &cancelingReader{cancel: cancel}
+	var readErr error
+	handler := contextBodyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+	}))
+
+	req := httptest.NewRequest("POST", "/v1/trace", body).WithContext(ctx)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, context.Canceled, readErr)
+	assert.Equal(t, 1, body.reads)
+}
+
+func TestContextBodyHandlerCompleted(t *testing.T) {
+	var got string
+	handler := contextBodyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		got = string(b)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/trace", strings.NewReader("payload")))
+	assert.Equal(t, "payload", got)
+}
+
+func TestOTLPErrorHandlerContentNegotiation(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		accept          string
+		wantContentType string
+	}{
+		{
+			name:            "protobuf",
+			contentType:     "application/x-protobuf",
+			wantContentType: "application/x-protobuf",
+		},
+		{
+			name:            "json",
+			contentType:     "application/json",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "json_with_charset",
+			contentType:     "application/json; charset=utf-8",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "accept_protobuf",
+			contentType:     "application/json",
+			accept:          "application/x-protobuf",
+			wantContentType: "application/x-protobuf",
+		},
+		{
+			name:            "accept_list",
+			contentType:     "application/x-protobuf",
+			accept:          "text/html, application/json;q=0.9",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "protobuf_delimited",
+			contentType:     "application/x-protobuf-delimited",
+			wantContentType: "application/x-protobuf",
+		},
+		{
+			name:            "unknown",
+			contentType:     "text/plain",
+			wantContentType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/trace", nil)
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			OTLPErrorHandler(rec, req, "gzip: invalid header", http.StatusBadRequest)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			s := status.New(codes.InvalidArgument, "gzip: invalid header")
+			var want []byte
+			var err error
+			if tt.wantContentType == "application/json" {
+				want, err = json.Marshal(s.Proto())
+			} else {
+				want, err = proto.Marshal(s.Proto())
+			}
+			require.NoError(t, err)
+			assert.Equal(t, want, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestOTLPErrorHandlerStatusCodes(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		wantCode   codes.Code
+	}{
+		{statusCode: http.StatusBadRequest, wantCode: codes.InvalidArgument},
+		{statusCode: http.StatusUnsupportedMediaType, wantCode: codes.InvalidArgument},
+		{statusCode: http.StatusNotFound, wantCode: codes.NotFound},
+		{statusCode: http.StatusPreconditionFailed, wantCode: codes.FailedPrecondition},
+		{statusCode: http.StatusServiceUnavailable, wantCode: codes.Unavailable},
+		{statusCode: http.StatusGatewayTimeout, wantCode: codes.DeadlineExceeded},
+		{statusCode: http.StatusInternalServerError, wantCode: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.statusCode), func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/trace", nil)
+			req.Header.Set("Content-Type", "application/x-protobuf")
+			rec := httptest.NewRecorder()
+			OTLPErrorHandler(rec, req, "error message", tt.statusCode)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			want, err := proto.Marshal(status.New(tt.wantCode, "error message").Proto())
+			require.NoError(t, err)
+			assert.Equal(t, want, rec.Body.Bytes())
+		})
+	}
+}
+
+func newTestExportRequest(spanName string) *collectortrace.ExportTraceServiceRequest {
+	return &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*otlptrace.ResourceSpans{
+			{
+				InstrumentationLibrarySpans: []*otlptrace.InstrumentationLibrarySpans{
+					{
+						Spans: []*otlptrace.Span{{Name: spanName}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func appendDelimited(t *testing.T, buf []byte, msg proto.Message) []byte {
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	var size [binary.MaxVarintLen64]byte
+	buf = append(buf, size[:binary.PutUvarint(size[:], uint64(len(data)))]...)
+	return append(buf, data...)
+}
+
+func TestXProtobufDelimitedDecoder(t *testing.T) {
+	var stream []byte
+	stream = appendDelimited(t, stream, newTestExportRequest("first"))
+	stream = appendDelimited(t, stream, newTestExportRequest("second"))
+
+	tests := []struct {
+		name    string
+		body    []byte
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "single",
+			body: appendDelimited(t, nil, newTestExportRequest("first")),
+			want: []string{"first"},
+		},
+		{
+			name: "stream",
+			body: stream,
+			want: []string{"first", "second"},
+		},
+		{
+			name:    "truncated",
+			body:    stream[:len(stream)-1],
+			wantErr: "failed to read a delimited message: unexpected EOF",
+		},
+		{
+			name:    "invalid_size",
+			body:    []byte{0xff},
+			wantErr: "failed to read the length of a delimited message: unexpected EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The decoded message is reset, like with runtime.ProtoMarshaller.
+			req := newTestExportRequest("previous")
+			err := (&xProtobufDelimitedMarshaler{}).NewDecoder(bytes.NewReader(tt.body)).Decode(req)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, rs := range req.ResourceSpans {
+				got = append(got, rs.InstrumentationLibrarySpans[0].Spans[0].Name)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJSONPbFieldErrorsStrict(t *testing.T) {
+	const body = `{"resourceSpans": [{"instrumentationLibrarySpans": [{"spans": [{"name": "span", "unknownField": 1}]}]}]}`
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprint(strict), func(t *testing.T) {
+			req := &collectortrace.ExportTraceServiceRequest{}
+			err := (&jsonPbFieldErrors{JSONPb: &JSONPb{}, strict: strict}).NewDecoder(strings.NewReader(body)).Decode(req)
+			if strict {
+				assert.EqualError(t, err, `failed to decode the JSON request body: unknown field "unknownField" in v1.Span`)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "span", req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans[0].Name)
+		})
+	}
+
+	// The known fields are decoded as in the lenient mode.
+	req := &collectortrace.ExportTraceServiceRequest{}
+	err := (&jsonPbFieldErrors{JSONPb: &JSONPb{}, strict: true}).NewDecoder(strings.NewReader(`{"resourceSpans": [{}]}`)).Decode(req)
+	require.NoError(t, err)
+	assert.Len(t, req.ResourceSpans, 1)
+}
+
+func TestOTLPErrorRetryInfo(t *testing.T) {
+	handlers := map[string]func(w http.ResponseWriter, statusCode int){
+		"error_handler": func(w http.ResponseWriter, statusCode int) {
+			req := httptest.NewRequest("POST", "/v1/trace", nil)
+			req.Header.Set("Content-Type", "application/x-protobuf")
+			otlpErrorHandler(5*time.Second)(w, req, "error message", statusCode)
+		},
+		"gateway_error_handler": func(w http.ResponseWriter, statusCode int) {
+			code := map[int]codes.Code{
+				http.StatusBadRequest:         codes.InvalidArgument,
+				http.StatusTooManyRequests:    codes.ResourceExhausted,
+				http.StatusServiceUnavailable: codes.Unavailable,
+			}[statusCode]
+			newGatewayErrorHandler(5*time.Second)(context.Background(), nil, &xProtobufMarshaler{}, w, nil, status.Error(code, "error message"))
+		},
+	}
+	tests := []struct {
+		statusCode    int
+		wantRetryInfo bool
+	}{
+		{statusCode: http.StatusBadRequest},
+		{statusCode: http.StatusTooManyRequests, wantRetryInfo: true},
+		{statusCode: http.StatusServiceUnavailable, wantRetryInfo: true},
+	}
+	for name, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(name+"/"+http.StatusText(tt.statusCode), func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				handler(rec, tt.statusCode)
+				assert.Equal(t, tt.statusCode, rec.Code)
+
+				sp := &spb.Status{}
+				require.NoError(t, protov2.Unmarshal(rec.Body.Bytes(), sp))
+				details := status.FromProto(sp).Details()
+				if !tt.wantRetryInfo {
+					assert.Empty(t, details)
+					return
+				}
+				require.Len(t, details, 1)
+				retryInfo, ok := details[0].(*errdetails.RetryInfo)
+				require.True(t, ok, "Unexpected status detail %v", details[0])
+				delay, err := ptypes.Duration(retryInfo.RetryDelay)
+				require.NoError(t, err)
+				assert.Equal(t, 5*time.Second, delay)
+			})
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"go.opentelemetry.io/collector/internal/middleware"
+)
+
+// PartialSuccess describes the items of an export request rejected while the
+// others were accepted, e.g. because of a quota or of a validation, returned in
+// the "partial_success" field of the OTLP export responses.
+type PartialSuccess struct {
+	// RejectedItems is the number of rejected spans, data points or log records.
+	RejectedItems int64
+	// ErrorMessage describes why the items were rejected.
+	ErrorMessage string
+}
+
+type partialSuccessKey struct{}
+
+// partialSuccessHolder holds the partial success set while handling a request.
+type partialSuccessHolder struct {
+	mu sync.Mutex
+	ps *PartialSuccess
+}
+
+// SetPartialSuccess sets the partial success returned in the 200 response to
+// the OTLP/HTTP request of ctx, serialized in the content type of the response,
+// that may be called by the consumers of the receiver before they return
+// without error. It returns false if ctx is not the context of an OTLP/HTTP
+// request, the gRPC responses have no partial success.
+func SetPartialSuccess(ctx context.Context, ps PartialSuccess) bool {
+	holder, ok := ctx.Value(partialSuccessKey{}).(*partialSuccessHolder)
+	if !ok {
+		return false
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	holder.ps = &ps
+	return true
+}
+
+// partialSuccessHandler writes the partial success set by SetPartialSuccess in
+// place of the empty export response written by the grpc-gateway.
+func partialSuccessHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		holder := &partialSuccessHolder{}
+		rw := &partialSuccessWriter{StatusRecorder: middleware.NewStatusRecorder(w), holder: holder, path: r.URL.Path}
+		h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), partialSuccessKey{}, holder)))
+	})
+}
+
+type partialSuccessWriter struct {
+	*middleware.StatusRecorder
+	holder      *partialSuccessHolder
+	path        string
+	wroteHeader bool
+	replaced    bool
+}
+
+func (w *partialSuccessWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		w.StatusRecorder.WriteHeader(statusCode)
+		return
+	}
+	w.wroteHeader = true
+	w.holder.mu.Lock()
+	ps := w.holder.ps
+	w.holder.mu.Unlock()
+	if statusCode != http.StatusOK || ps == nil {
+		w.StatusRecorder.WriteHeader(statusCode)
+		return
+	}
+	var body []byte
+	if mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); mediaType == jsonContentType {
+		body = marshalPartialSuccessJSON(w.path, ps)
+	} else {
+		body = marshalPartialSuccessProto(ps)
+	}
+	w.replaced = true
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.StatusRecorder.WriteHeader(statusCode)
+	_, _ = w.StatusRecorder.Write(body)
+}
+
+// Write discards the export response when it is replaced by the partial success.
+func (w *partialSuccessWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.StatusRecorder.Write(b)
+}
+
+// marshalPartialSuccessProto returns the export response with the partial
+// success in its field 1, with the number of rejected items in the field 1 and
+// the error message in the field 2, the same for all the signals.
+func marshalPartialSuccessProto(ps *PartialSuccess) []byte {
+	var msg []byte
+	if ps.RejectedItems != 0 {
+		msg = protowire.AppendTag(msg, 1, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(ps.RejectedItems))
+	}
+	if ps.ErrorMessage != "" {
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendString(msg, ps.ErrorMessage)
+	}
+	resp := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(resp, msg)
+}
+
+// marshalPartialSuccessJSON returns the export response with the partial
+// success in the protobuf JSON mapping, where the name of the number of
+// rejected items depends on the signal of the path.
+func marshalPartialSuccessJSON(path string, ps *PartialSuccess) []byte {
+	rejectedField := "rejectedSpans"
+	switch path {
+	case metricsHTTPPath:
+		rejectedField = "rejectedDataPoints"
+	case logsHTTPPath:
+		rejectedField = "rejectedLogRecords"
+	}
+	partialSuccess := map[string]string{}
+	if ps.RejectedItems != 0 {
+		// The 64-bit integers are strings in the JSON mapping.
+		partialSuccess[rejectedField] = strconv.FormatInt(ps.RejectedItems, 10)
+	}
+	if ps.ErrorMessage != "" {
+		partialSuccess["errorMessage"] = ps.ErrorMessage
+	}
+	body, _ := json.Marshal(map[string]interface{}{"partialSuccess": partialSuccess})
+	return body
+}
@@ -0,0 +1,107 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlpreceiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/pdata"
+	"go.opentelemetry.io/collector/testutil"
+)
+
+// partialSuccessConsumer accepts the traces with a partial success.
+type partialSuccessConsumer struct {
+	ps  PartialSuccess
+	set bool
+}
+
+func (c *partialSuccessConsumer) ConsumeTraces(ctx context.Context, _ pdata.Traces) error {
+	c.set = SetPartialSuccess(ctx, c.ps)
+	return nil
+}
+
+func TestOTLPReceiverPartialSuccess(t *testing.T) {
+	addr := testutil.GetAvailableLocalAddress(t)
+	tc := &partialSuccessConsumer{ps: PartialSuccess{RejectedItems: 3, ErrorMessage: "quota exceeded"}}
+	ocr := newHTTPReceiver(t, addr, tc, nil)
+
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()), "Failed to start trace receiver")
+	defer ocr.Shutdown(context.Background())
+
+	// Wait for the servers to start
+	<-time.After(10 * time.Millisecond)
+
+	pbBody, err := proto.Marshal(newTestExportRequest("span"))
+	require.NoError(t, err)
+	// partial_success (1) {rejected_spans (1): 3, error_message (2): "quota exceeded"}
+	wantPb := append([]byte{0x0a, 18, 0x08, 3, 0x12, 14}, "quota exceeded"...)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        string
+	}{
+		{
+			name:        "protobuf",
+			contentType: "application/x-protobuf",
+			body:        pbBody,
+			want:        string(wantPb),
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        []byte(`{"resourceSpans": [{"instrumentationLibrarySpans": [{"spans": [{"name": "span"}]}]}]}`),
+			want:        `{"partialSuccess":{"errorMessage":"quota exceeded","rejectedSpans":"3"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc.set = false
+			url := fmt.Sprintf("http://%s/v1/trace", addr)
+			resp, err := http.Post(url, tt.contentType, bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			respBytes, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.True(t, tc.set)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tt.want, string(respBytes))
+		})
+	}
+}
+
+func TestSetPartialSuccessWithoutRequest(t *testing.T) {
+	assert.False(t, SetPartialSuccess(context.Background(), PartialSuccess{RejectedItems: 1}))
+}
+
+func TestMarshalPartialSuccessJSON(t *testing.T) {
+	ps := &PartialSuccess{RejectedItems: 2}
+	assert.Equal(t, `{"partialSuccess":{"rejectedDataPoints":"2"}}`, string(marshalPartialSuccessJSON(metricsHTTPPath, ps)))
+	assert.Equal(t, `{"partialSuccess":{"rejectedLogRecords":"2"}}`, string(marshalPartialSuccessJSON(logsHTTPPath, ps)))
+}
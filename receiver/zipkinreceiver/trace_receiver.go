@@ -190,10 +190,10 @@ func (zr *ZipkinReceiver) deserializeFromJSON(jsonBlob []byte, debugWasSet bool)
 // Shutdown tells the receiver that should stop reception,
 // giving it a chance to perform any necessary clean-up and shutting down
 // its HTTP server.
-func (zr *ZipkinReceiver) Shutdown(context.Context) error {
+func (zr *ZipkinReceiver) Shutdown(ctx context.Context) error {
 	var err = componenterror.ErrAlreadyStopped
 	zr.stopOnce.Do(func() {
-		err = zr.server.Close()
+		err = zr.config.HTTPServerSettings.Shutdown(ctx, zr.server)
 	})
 	return err
 }